@@ -0,0 +1,84 @@
+package api
+
+import (
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/wg"
+)
+
+const (
+	// PeerStateHealthy means, that the peer synced recently
+	PeerStateHealthy = "healthy"
+	// PeerStateStale means, that the peer did not sync recently, but was seen not long ago
+	PeerStateStale = "stale"
+	// PeerStateDead means, that the peer was not seen for a long time, or never
+	PeerStateDead = "dead"
+)
+
+// SyncTracker returns the time of the last successful sync of the peer
+type SyncTracker interface {
+	LastSync(peer string) (time.Time, bool)
+}
+
+// PeerHealth describes the connectivity of a peer
+type PeerHealth struct {
+	LastSync      *time.Time `json:"last_sync"`
+	LastHandshake *time.Time `json:"last_handshake"`
+	ReceiveBytes  *int64     `json:"rx_bytes"`
+	TransmitBytes *int64     `json:"tx_bytes"`
+	State         string     `json:"state"`
+}
+
+// peerHealthChecker derives the health of the peers from their syncs and Wireguard statistics
+type peerHealthChecker struct {
+	syncs      SyncTracker
+	stats      wg.StatsProvider
+	staleAfter time.Duration
+	deadAfter  time.Duration
+}
+
+// statsByKey returns the Wireguard statistics of the peers mapped to their public keys, or an
+// empty map, if they are not available
+func (h *peerHealthChecker) statsByKey() (map[string]wg.PeerStats, error) {
+	byKey := map[string]wg.PeerStats{}
+	if h.stats == nil {
+		return byKey, nil
+	}
+	stats, statsErr := h.stats.Stats()
+	if statsErr != nil {
+		return nil, statsErr
+	}
+	for _, peerStats := range stats {
+		byKey[peerStats.PublicKey] = peerStats
+	}
+	return byKey, nil
+}
+
+// health returns the health of the peer. The peer is healthy if it synced within staleAfter,
+// stale if it synced or made a Wireguard handshake within deadAfter and dead otherwise.
+func (h *peerHealthChecker) health(name string, stats wg.PeerStats, hasStats bool, now time.Time) PeerHealth {
+	health := PeerHealth{State: PeerStateDead}
+	var lastSeen time.Time
+	if h.syncs != nil {
+		if lastSync, synced := h.syncs.LastSync(name); synced {
+			health.LastSync = &lastSync
+			lastSeen = lastSync
+			if now.Sub(lastSync) <= h.staleAfter {
+				health.State = PeerStateHealthy
+			}
+		}
+	}
+	if hasStats {
+		health.ReceiveBytes, health.TransmitBytes = &stats.ReceiveBytes, &stats.TransmitBytes
+		if !stats.LastHandshake.IsZero() {
+			health.LastHandshake = &stats.LastHandshake
+			if stats.LastHandshake.After(lastSeen) {
+				lastSeen = stats.LastHandshake
+			}
+		}
+	}
+	if health.State != PeerStateHealthy && !lastSeen.IsZero() && now.Sub(lastSeen) <= h.deadAfter {
+		health.State = PeerStateStale
+	}
+	return health
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSyncTracker map[string]time.Time
+
+func (t mockSyncTracker) LastSync(peer string) (time.Time, bool) {
+	lastSync, ok := t[peer]
+	return lastSync, ok
+}
+
+type mockStatsProvider struct {
+	stats []wg.PeerStats
+	err   error
+}
+
+func (p *mockStatsProvider) Stats() ([]wg.PeerStats, error) {
+	return p.stats, p.err
+}
+
+func TestPeerHealth(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		lastSync      *time.Time
+		lastHandshake time.Time
+		hasStats      bool
+		expected      string
+	}{
+		{name: "never seen", expected: PeerStateDead},
+		{name: "never seen, with stats", hasStats: true, expected: PeerStateDead},
+		{name: "synced recently", lastSync: timePtr(now.Add(-time.Second)), expected: PeerStateHealthy},
+		{name: "synced exactly at stale threshold", lastSync: timePtr(now.Add(-time.Minute)), expected: PeerStateHealthy},
+		{
+			name:     "synced just after stale threshold",
+			lastSync: timePtr(now.Add(-time.Minute - time.Nanosecond)),
+			expected: PeerStateStale,
+		},
+		{name: "synced exactly at dead threshold", lastSync: timePtr(now.Add(-5 * time.Minute)), expected: PeerStateStale},
+		{
+			name:     "synced just after dead threshold",
+			lastSync: timePtr(now.Add(-5*time.Minute - time.Nanosecond)),
+			expected: PeerStateDead,
+		},
+		{
+			name:          "handshake only, recently",
+			lastHandshake: now.Add(-time.Second),
+			hasStats:      true,
+			expected:      PeerStateStale,
+		},
+		{
+			name:          "handshake only, exactly at dead threshold",
+			lastHandshake: now.Add(-5 * time.Minute),
+			hasStats:      true,
+			expected:      PeerStateStale,
+		},
+		{
+			name:          "handshake only, just after dead threshold",
+			lastHandshake: now.Add(-5*time.Minute - time.Nanosecond),
+			hasStats:      true,
+			expected:      PeerStateDead,
+		},
+		{
+			name:          "old sync, recent handshake",
+			lastSync:      timePtr(now.Add(-time.Hour)),
+			lastHandshake: now.Add(-time.Second),
+			hasStats:      true,
+			expected:      PeerStateStale,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			syncs := mockSyncTracker{}
+			if tt.lastSync != nil {
+				syncs["client1"] = *tt.lastSync
+			}
+			checker := &peerHealthChecker{syncs: syncs, staleAfter: time.Minute, deadAfter: 5 * time.Minute}
+
+			// when
+			health := checker.health("client1", wg.PeerStats{LastHandshake: tt.lastHandshake}, tt.hasStats, now)
+
+			// then
+			assert.Equal(t, tt.expected, health.State)
+			assert.Equal(t, tt.lastSync, health.LastSync)
+			if tt.lastHandshake.IsZero() {
+				assert.Nil(t, health.LastHandshake)
+			} else {
+				assert.Equal(t, tt.lastHandshake, *health.LastHandshake)
+			}
+			assert.Equal(t, tt.hasStats, health.ReceiveBytes != nil)
+		})
+	}
+}
+
+func TestPeerHealthStatsByKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		stats       wg.StatsProvider
+		expected    map[string]wg.PeerStats
+		expectedErr bool
+	}{
+		{name: "stats not available", expected: map[string]wg.PeerStats{}},
+		{
+			name: "stats of multiple peers",
+			stats: &mockStatsProvider{stats: []wg.PeerStats{
+				{PublicKey: "key1", ReceiveBytes: 1},
+				{PublicKey: "key2", ReceiveBytes: 2},
+			}},
+			expected: map[string]wg.PeerStats{
+				"key1": {PublicKey: "key1", ReceiveBytes: 1},
+				"key2": {PublicKey: "key2", ReceiveBytes: 2},
+			},
+		},
+		{name: "stats failed", stats: &mockStatsProvider{err: errors.New("no device")}, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			checker := &peerHealthChecker{stats: tt.stats}
+
+			// when
+			byKey, statsErr := checker.statsByKey()
+
+			// then
+			if tt.expectedErr {
+				assert.Error(t, statsErr)
+				return
+			}
+			assert.NoError(t, statsErr)
+			assert.Equal(t, tt.expected, byKey)
+		})
+	}
+}
+
+func TestPeerHealthFallsBackToSyncsWhenStatsFail(t *testing.T) {
+	// given
+	controller := &PeerController{health: &peerHealthChecker{
+		syncs:      mockSyncTracker{"peer1": time.Now()},
+		stats:      &mockStatsProvider{err: errors.New("no device")},
+		staleAfter: time.Minute,
+		deadAfter:  5 * time.Minute,
+	}}
+
+	// when
+	health := controller.healthOf([]pairing.PeerInfo{
+		{Name: "peer1", PublicKey: "key1"},
+		{Name: "peer2", PublicKey: "key2"},
+	})
+
+	// then
+	assert.Equal(t, PeerStateHealthy, health["peer1"].State)
+	assert.NotNil(t, health["peer1"].LastSync)
+	assert.Nil(t, health["peer1"].ReceiveBytes)
+	assert.Equal(t, PeerStateDead, health["peer2"].State)
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glothriel/wormhole/pkg/pairing"
+)
+
+// InvitesController is a controller for managing invites
+type InvitesController struct {
+	invites pairing.InviteStorage
+}
+
+// CreateInviteRequest is a request for creating a new invite
+type CreateInviteRequest struct {
+	Name string `json:"name" binding:"required"`
+	// ExpiresIn is a duration, for example `24h`. Empty value means the invite never expires
+	ExpiresIn string `json:"expires_in"`
+	MaxUses   int    `json:"max_uses"`
+	Peer      string `json:"peer"`
+}
+
+func (i *InvitesController) createInvite(req CreateInviteRequest) (pairing.Invite, error) {
+	if req.MaxUses < 0 {
+		return pairing.Invite{}, errors.New("max_uses must not be negative")
+	}
+	if _, getErr := i.invites.GetByName(req.Name); getErr == nil {
+		return pairing.Invite{}, errors.New("invite with this name already exists")
+	}
+	token, tokenErr := pairing.GenerateInviteToken()
+	if tokenErr != nil {
+		return pairing.Invite{}, tokenErr
+	}
+	invite := pairing.Invite{
+		Name:    req.Name,
+		Token:   token,
+		MaxUses: req.MaxUses,
+		Peer:    req.Peer,
+	}
+	if req.ExpiresIn != "" {
+		expiresIn, parseErr := time.ParseDuration(req.ExpiresIn)
+		if parseErr != nil {
+			return pairing.Invite{}, parseErr
+		}
+		invite.ExpiresAt = time.Now().Add(expiresIn)
+	}
+	return invite, i.invites.Store(invite)
+}
+
+func (i *InvitesController) registerRoutes(r *gin.Engine, s ServerSettings) {
+	protected := r.Group("/api/invites")
+	protected.Use(RequireBasicAuth(s))
+
+	protected.GET("v1", func(c *gin.Context) {
+		invites, err := i.invites.List()
+		if err != nil {
+			c.JSON(500, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if len(invites) > 0 {
+			c.JSON(200, invites)
+			return
+		}
+		c.JSON(200, []string{})
+	})
+
+	protected.POST("v1", func(c *gin.Context) {
+		var req CreateInviteRequest
+		if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+			c.JSON(400, gin.H{
+				"error": bindErr.Error(),
+			})
+			return
+		}
+		invite, err := i.createInvite(req)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(201, invite)
+	})
+
+	protected.DELETE("v1/:name", func(c *gin.Context) {
+		err := i.invites.DeleteByName(c.Param("name"))
+		if err != nil {
+			c.JSON(500, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(204, nil)
+	})
+}
+
+// NewInvitesController allows creating and revoking invites
+func NewInvitesController(invites pairing.InviteStorage) Controller {
+	return &InvitesController{
+		invites: invites,
+	}
+}
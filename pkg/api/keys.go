@@ -0,0 +1,37 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// KeyRotator replaces the Wireguard key pair of the peer
+type KeyRotator interface {
+	Rotate() error
+}
+
+// KeysController is a controller for managing Wireguard keys of the peer
+type KeysController struct {
+	rotator KeyRotator
+}
+
+func (k *KeysController) registerRoutes(r *gin.Engine, s ServerSettings) {
+	protected := r.Group("/api/keys")
+	protected.Use(RequireBasicAuth(s))
+
+	protected.POST("v1/rotate", func(c *gin.Context) {
+		if err := k.rotator.Rotate(); err != nil {
+			c.JSON(500, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(204, nil)
+	})
+}
+
+// NewKeysController allows rotating the Wireguard keys of the peer
+func NewKeysController(rotator KeyRotator) Controller {
+	return &KeysController{
+		rotator: rotator,
+	}
+}
@@ -1,42 +1,75 @@
 package api
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/glothriel/wormhole/pkg/apps"
 	"github.com/glothriel/wormhole/pkg/pairing"
 	"github.com/glothriel/wormhole/pkg/syncing"
 	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/sirupsen/logrus"
 )
 
 // PeerController is a controller for managing peers
 type PeerController struct {
-	peers    pairing.PeerStorage
-	wgConfig *wg.Config
-	watcher  *wg.Watcher
+	peers   pairing.PeerStorage
+	deleter *pairing.PeerDeleter
+	apps    PeerAppsWithdrawer
 
 	metadata syncing.MetadataStorage
+	health   *peerHealthChecker
+}
+
+// PeerAppsWithdrawer withdraws all the apps of a deleted peer
+type PeerAppsWithdrawer interface {
+	ForgetPeer(name string) []apps.App
+}
+
+// DeletedPeer is the response of the peer deletion
+type DeletedPeer struct {
+	Name          string     `json:"name"`
+	WithdrawnApps []apps.App `json:"withdrawn_apps"`
 }
 
-func (p *PeerController) deletePeer(name string) error {
-	peerInfo, err := p.peers.GetByName(name)
-	if err != nil {
-		return err
+func (p *PeerController) deletePeer(name string) (DeletedPeer, error) {
+	if _, err := p.deleter.Delete(name); err != nil {
+		return DeletedPeer{}, err
 	}
-	p.wgConfig.DeleteByPublicKey(peerInfo.PublicKey)
-	err = p.watcher.Update(*p.wgConfig)
-	if err != nil {
-		return err
+	withdrawn := p.apps.ForgetPeer(name)
+	if withdrawn == nil {
+		withdrawn = []apps.App{}
 	}
-	err = p.peers.DeleteByName(name)
-	if err != nil {
-		return err
+	return DeletedPeer{Name: name, WithdrawnApps: withdrawn}, nil
+}
+
+// healthOf returns the health of the given peers, mapped to their names. If the Wireguard
+// statistics cannot be read, the health is derived from the syncs only.
+func (p *PeerController) healthOf(peers []pairing.PeerInfo) map[string]PeerHealth {
+	stats, statsErr := p.health.statsByKey()
+	if statsErr != nil {
+		logrus.Errorf("Failed to read Wireguard statistics: %v", statsErr)
+	}
+	now := time.Now()
+	health := make(map[string]PeerHealth, len(peers))
+	for _, peer := range peers {
+		peerStats, hasStats := stats[peer.PublicKey]
+		health[peer.Name] = p.health.health(peer.Name, peerStats, hasStats, now)
 	}
-	return nil
+	return health
+}
+
+// PeersV1ListItem is a struct for the v1 peers list
+type PeersV1ListItem struct {
+	pairing.PeerInfo
+	PeerHealth
 }
 
 // PeersV2ListItem is a struct for the v2 peers list
 type PeersV2ListItem struct {
 	Name     string           `json:"name"`
 	Metadata syncing.Metadata `json:"metadata"`
+	PeerHealth
 }
 
 func (p *PeerController) registerRoutes(r *gin.Engine, s ServerSettings) {
@@ -48,11 +81,15 @@ func (p *PeerController) registerRoutes(r *gin.Engine, s ServerSettings) {
 			})
 			return
 		}
-		if len(peerList) > 0 {
-			c.JSON(200, peerList)
-			return
+		health := p.healthOf(peerList)
+		peerListItems := make([]PeersV1ListItem, 0, len(peerList))
+		for _, peer := range peerList {
+			peerListItems = append(peerListItems, PeersV1ListItem{
+				PeerInfo:   peer,
+				PeerHealth: health[peer.Name],
+			})
 		}
-		c.JSON(200, []string{})
+		c.JSON(200, peerListItems)
 	})
 
 	r.GET("/api/peers/v2", func(c *gin.Context) {
@@ -63,6 +100,7 @@ func (p *PeerController) registerRoutes(r *gin.Engine, s ServerSettings) {
 			})
 			return
 		}
+		health := p.healthOf(peerList)
 		var peerListItems []PeersV2ListItem
 		for _, peer := range peerList {
 			metadata, err := p.metadata.Get(peer.Name)
@@ -73,8 +111,9 @@ func (p *PeerController) registerRoutes(r *gin.Engine, s ServerSettings) {
 				return
 			}
 			peerListItems = append(peerListItems, PeersV2ListItem{
-				Name:     peer.Name,
-				Metadata: metadata,
+				Name:       peer.Name,
+				Metadata:   metadata,
+				PeerHealth: health[peer.Name],
 			})
 		}
 		c.JSON(200, peerListItems)
@@ -84,32 +123,54 @@ func (p *PeerController) registerRoutes(r *gin.Engine, s ServerSettings) {
 
 	protected.DELETE("v1/:name", func(c *gin.Context) {
 		name := c.Param("name")
-		err := p.deletePeer(name)
+		deleted, err := p.deletePeer(name)
 		if err != nil {
 			c.JSON(500, gin.H{
 				"error": err.Error(),
 			})
 			return
 		}
-		c.JSON(204, nil)
+		c.JSON(200, deleted)
 	})
 }
 
 // PeerControllerSettings is a type for setting up the PeerController
 type PeerControllerSettings func(*PeerController)
 
-// NewPeersController allows querying and manipulation of the connected peers
+// WithPeerHealth reports the health of the peers, derived from their syncs and, if stats are
+// not nil, their Wireguard handshakes. Peers are stale if they did not sync for staleAfter
+// and dead if they were not seen for deadAfter.
+func WithPeerHealth(
+	syncs SyncTracker, stats wg.StatsProvider, staleAfter, deadAfter time.Duration,
+) PeerControllerSettings {
+	return func(p *PeerController) {
+		p.health = &peerHealthChecker{
+			syncs:      syncs,
+			stats:      stats,
+			staleAfter: staleAfter,
+			deadAfter:  deadAfter,
+		}
+	}
+}
+
+// NewPeersController allows querying and manipulation of the connected peers. The apps of the
+// deleted peers are withdrawn using the withdrawer.
 func NewPeersController(
 	peers pairing.PeerStorage,
-	wgConfig *wg.Config,
-	watcher *wg.Watcher,
+	deleter *pairing.PeerDeleter,
 	metadata syncing.MetadataStorage,
+	withdrawer PeerAppsWithdrawer,
+	settings ...PeerControllerSettings,
 ) Controller {
 	theController := &PeerController{
 		peers:    peers,
-		wgConfig: wgConfig,
-		watcher:  watcher,
+		deleter:  deleter,
+		apps:     withdrawer,
 		metadata: metadata,
+		health:   &peerHealthChecker{staleAfter: time.Minute, deadAfter: 5 * time.Minute},
+	}
+	for _, setting := range settings {
+		setting(theController)
 	}
 	return theController
 }
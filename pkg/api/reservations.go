@@ -0,0 +1,71 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/glothriel/wormhole/pkg/pairing"
+)
+
+// ReservationsController is a controller for managing static IP addresses of the peers
+type ReservationsController struct {
+	ipam pairing.IPAM
+}
+
+func (r *ReservationsController) registerRoutes(e *gin.Engine, s ServerSettings) {
+	e.GET("/api/reservations/v1", func(c *gin.Context) {
+		reservations, err := r.ipam.Reservations()
+		if err != nil {
+			c.JSON(500, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if len(reservations) > 0 {
+			c.JSON(200, reservations)
+			return
+		}
+		c.JSON(200, []string{})
+	})
+
+	protected := e.Group("/api/reservations")
+	protected.Use(RequireBasicAuth(s))
+
+	protected.POST("v1", func(c *gin.Context) {
+		var reservation pairing.IPReservation
+		if bindErr := c.ShouldBindJSON(&reservation); bindErr != nil {
+			c.JSON(400, gin.H{
+				"error": bindErr.Error(),
+			})
+			return
+		}
+		if reservation.Name == "" || reservation.IP == "" {
+			c.JSON(400, gin.H{
+				"error": "name and ip are required",
+			})
+			return
+		}
+		if err := r.ipam.Reserve(reservation); err != nil {
+			c.JSON(400, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(201, reservation)
+	})
+
+	protected.DELETE("v1/:name", func(c *gin.Context) {
+		if err := r.ipam.Unreserve(c.Param("name")); err != nil {
+			c.JSON(500, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(204, nil)
+	})
+}
+
+// NewReservationsController allows reserving static IP addresses for the peers
+func NewReservationsController(ipam pairing.IPAM) Controller {
+	return &ReservationsController{
+		ipam: ipam,
+	}
+}
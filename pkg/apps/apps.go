@@ -1,6 +1,15 @@
 // Package apps defines basic structures for apps
 package apps
 
+import "slices"
+
+const (
+	// ProtocolTCP is used for apps exposing TCP ports
+	ProtocolTCP = "TCP"
+	// ProtocolUDP is used for apps exposing UDP ports
+	ProtocolUDP = "UDP"
+)
+
 // App represents an application that can be peered
 type App struct {
 	Name    string `json:"name"`
@@ -9,6 +18,43 @@ type App struct {
 
 	OriginalPort int32  `json:"originalPort"`
 	TargetLabels string `json:"targetLabels"`
+	Protocol     string `json:"protocol,omitempty"`
+
+	// AllowedPeers lists the peers, that may consume the app. Empty list means all peers.
+	AllowedPeers []string `json:"allowedPeers,omitempty"`
+}
+
+// ProtocolOf returns the protocol of the app, apps without the protocol set (for example
+// sent by peers running older versions) are TCP
+func ProtocolOf(app App) string {
+	if app.Protocol == "" {
+		return ProtocolTCP
+	}
+	return app.Protocol
+}
+
+// IsAllowedFor checks if the app may be consumed by the given peer
+func IsAllowedFor(app App, peer string) bool {
+	if len(app.AllowedPeers) == 0 {
+		return true
+	}
+	for _, allowedPeer := range app.AllowedPeers {
+		if allowedPeer == peer {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal checks if both apps have exactly the same properties
+func Equal(a, b App) bool {
+	return a.Name == b.Name &&
+		a.Address == b.Address &&
+		a.Peer == b.Peer &&
+		a.OriginalPort == b.OriginalPort &&
+		a.TargetLabels == b.TargetLabels &&
+		a.Protocol == b.Protocol &&
+		slices.Equal(a.AllowedPeers, b.AllowedPeers)
 }
 
 // WithAddress returns a new App with the given address
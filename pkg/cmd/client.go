@@ -2,18 +2,23 @@
 package cmd
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/glothriel/wormhole/pkg/api"
-	"github.com/glothriel/wormhole/pkg/k8s"
 	"github.com/glothriel/wormhole/pkg/listeners"
 	"github.com/glothriel/wormhole/pkg/nginx"
 	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/glothriel/wormhole/pkg/proxy"
 	"github.com/glothriel/wormhole/pkg/syncing"
 	"github.com/glothriel/wormhole/pkg/wg"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
 )
 
 var helloRetryIntervalFlag *cli.DurationFlag = &cli.DurationFlag{
@@ -24,15 +29,26 @@ var helloRetryIntervalFlag *cli.DurationFlag = &cli.DurationFlag{
 var pairingServerURL *cli.StringFlag = &cli.StringFlag{
 	Name:  "server",
 	Value: "http://localhost:8080",
+	Usage: ("URL of the pairing server, use grpc://host:port (grpcs://host:port with TLS) for servers " +
+		"running with --transport grpc"),
+}
+
+var pairingEncodingFlag *cli.StringFlag = &cli.StringFlag{
+	Name:  "pairing-encoding",
+	Value: "protobuf",
+	Usage: ("Encoding of the pairing requests, json or protobuf. The client falls back to json if the server " +
+		"does not accept protobuf"),
 }
 
 var clientCommand *cli.Command = &cli.Command{
 	Name: "client",
 	Flags: []cli.Flag{
 		pairingServerURL,
+		pairingEncodingFlag,
 		basicAuthUsernameFlag,
 		basicAuthPasswordFlag,
 		inviteTokenFlag,
+		pskLegacyFlag,
 		kubernetesFlag,
 		stateManagerPathFlag,
 		kubernetesNamespaceFlag,
@@ -43,111 +59,132 @@ var clientCommand *cli.Command = &cli.Command{
 		helloRetryIntervalFlag,
 		nginxExposerConfdPathFlag,
 		wireguardConfigFilePathFlag,
+		wireguardUserspaceFlag,
 		pairingClientCacheDBPath,
 		keyStorageDBFlag,
+		kubernetesStorageFlag,
+		keyRotationIntervalFlag,
+		tlsServerCAFlag,
+		tlsCertFlag,
+		tlsKeyFlag,
+		cleanupOnShutdownFlag,
 	},
 	Action: func(c *cli.Context) error {
-		privateKey, publicKey, keyErr := wg.GetOrGenerateKeyPair(getKeyStorage(c))
+		keyStorage, keyStorageErr := getKeyStorage(c)
+		if keyStorageErr != nil {
+			return keyStorageErr
+		}
+		defer closeStorages(keyStorage)
+		privateKey, publicKey, keyErr := wg.GetOrGenerateKeyPair(keyStorage)
 		if keyErr != nil {
-			logrus.Fatalf("Failed to get key pair: %v", keyErr)
+			return fmt.Errorf("failed to get key pair: %w", keyErr)
 		}
 		startPrometheusServer(c)
+		stopTracing, tracingErr := startTracing(c)
+		if tracingErr != nil {
+			return tracingErr
+		}
+		defer stopTracing()
+		ctx, stop := shutdownContext(c)
+		defer stop()
 
-		remoteNginxExposer := nginx.NewNginxExposer(
-			c.String(nginxExposerConfdPathFlag.Name),
-			"remote",
-			nginx.NewDefaultReloader(),
-			nginx.NewRangePortAllocator(25001, 30000),
-			nginx.NewAllAcceptWireguardListener(),
-		)
-		var effectiveExposer listeners.Exposer = remoteNginxExposer
-
-		if c.Bool(kubernetesFlag.Name) {
-			namespace := c.String(kubernetesNamespaceFlag.Name)
-			rawLabels := c.String(kubernetesLabelsFlag.Name)
-			if namespace == "" || rawLabels == "" {
-				logrus.Fatalf(
-					"Namespace (--%s) and labels (--%s) must be set when using kubernetes integration",
-					kubernetesNamespaceFlag.Name,
-					kubernetesLabelsFlag.Name,
-				)
-			}
-			effectiveExposer = k8s.NewK8sExposer(
-				c.String(kubernetesNamespaceFlag.Name),
-				k8s.CSVToMap(c.String(kubernetesLabelsFlag.Name)),
-				c.Bool(enableNetworkPoliciesFlag.Name),
-				remoteNginxExposer,
-			)
+		var wgReloader wg.WireguardConfigReloader
+		var userspaceDevice *wg.UserspaceDevice
+		if c.Bool(wireguardUserspaceFlag.Name) {
+			userspaceDevice = wg.NewUserspaceDevice()
+			wgReloader = userspaceDevice
+		} else {
+			// The device reloader does not address the interface, so it is only supported on the server
+			wgReloader = wg.NewWatcher(c.String(wireguardConfigFilePathFlag.Name))
 		}
-		remoteListenerRegistry := listeners.NewApps(effectiveExposer)
+
+		remoteNginxExposer := getRemoteExposer(c, userspaceDevice)
+		effectiveExposer, exposerErr := getKubernetesExposer(c, remoteNginxExposer)
+		if exposerErr != nil {
+			return exposerErr
+		}
+		remoteListenerRegistry := listeners.NewApps(effectiveExposer, listeners.WithName("remote"))
 
 		appStateChangeGenerator := syncing.NewAppStateChangeGenerator()
 
-		transport := pairing.NewHTTPClientPairingTransport(c.String(pairingServerURL.Name))
+		transport, transportErr := getClientPairingTransport(c)
+		if transportErr != nil {
+			return transportErr
+		}
 		if c.String(inviteTokenFlag.Name) != "" {
 			transport = pairing.NewPSKClientPairingTransport(
 				c.String(inviteTokenFlag.Name),
 				transport,
+				getPSKOptions(c)...,
 			)
 		}
 
-		pairingKeyCache := pairing.NewInMemoryKeyCachingPairingClientStorage()
-		if c.String(pairingClientCacheDBPath.Name) != "" {
-			var err error
-			pairingKeyCache, err = pairing.NewBoltKeyCachingPairingClientStorage(c.String(pairingClientCacheDBPath.Name))
-			if err != nil {
-				logrus.Fatalf("Failed to create pairing key cache: %v", err)
-			}
+		pairingKeyCache, cacheErr := getPairingClientCache(c)
+		if cacheErr != nil {
+			return cacheErr
 		}
-		wgReloader := wg.NewWatcher(c.String(wireguardConfigFilePathFlag.Name))
+		defer closeStorages(pairingKeyCache)
 		wgConfig := &wg.Config{
 			PrivateKey: privateKey,
-			Subnet:     "32",
 		}
 		keyPair := pairing.KeyPair{
 			PublicKey:  publicKey,
 			PrivateKey: privateKey,
 		}
+		pairingEncoder, encoderErr := pairing.NewEncoder(c.String(pairingEncodingFlag.Name))
+		if encoderErr != nil {
+			return encoderErr
+		}
+		pairingClient := pairing.NewDefaultPairingClient(
+			c.String(peerNameFlag.Name),
+			wgConfig,
+			keyPair,
+			wgReloader,
+			pairingEncoder,
+			transport,
+			pairing.WithFallbackEncoder(pairing.NewJSONPairingEncoder()),
+		)
 		client := pairing.NewKeyCachingPairingClient(
 			pairingKeyCache,
 			wgConfig,
 			wgReloader,
-			pairing.NewDefaultPairingClient(
-				c.String(peerNameFlag.Name),
-				wgConfig,
-				keyPair,
-				wgReloader,
-				pairing.NewJSONPairingEncoder(),
-				transport,
-			),
+			pairingClient,
 		)
+		keyRotator := pairing.NewKeyRotator(pairingClient, pairingKeyCache, keyStorage)
 
 		var pairingResponse pairing.Response
 		for {
-			var err error
-			if pairingResponse, err = client.Pair(); err != nil {
-				logrus.Error(err)
-				time.Sleep(c.Duration(helloRetryIntervalFlag.Name))
-				continue
+			err := keyRotator.Resume()
+			if err == nil {
+				if pairingResponse, err = client.Pair(); err == nil {
+					break
+				}
+			}
+			logrus.Error(err)
+			select {
+			case <-time.After(c.Duration(helloRetryIntervalFlag.Name)):
+			case <-ctx.Done():
+				return nil
 			}
-			break
 		}
-		localListenerRegistry := listeners.NewApps(nginx.NewNginxExposer(
-			c.String(nginxExposerConfdPathFlag.Name),
-			"local",
-			nginx.NewDefaultReloader(),
-			nginx.NewRangePortAllocator(20000, 25000),
-			nginx.NewOnlyGivenAddressListener(pairingResponse.AssignedIP),
-		))
+		localListenerRegistry := listeners.NewApps(
+			getLocalExposer(c, userspaceDevice, pairingResponse.AssignedIP), listeners.WithName("local"),
+		)
 
 		logrus.Infof("Paired with server, assigned IP: %s", pairingResponse.AssignedIP)
-		go localListenerRegistry.Watch(getAppStateChangeGenerator(c).Changes(), make(chan bool))
-		go remoteListenerRegistry.Watch(appStateChangeGenerator.Changes(), make(chan bool))
+		registries := newRegistryWatcher()
+		defer registries.stop(c.Bool(cleanupOnShutdownFlag.Name))
+		registries.watch(localListenerRegistry, getAppStateChangeGenerator(ctx, c).Changes())
+		registries.watch(remoteListenerRegistry, appStateChangeGenerator.Changes())
 
+		metadata, metadataErr := getClientMetadata(c)
+		if metadataErr != nil {
+			return metadataErr
+		}
 		sc, scErr := syncing.NewHTTPClient(
 			c.String(peerNameFlag.Name),
 			appStateChangeGenerator,
-			syncing.NewJSONSyncingEncoder(),
+			syncing.NegotiateEncoder(pairingResponse),
 			time.Second*5,
 			syncing.NewAddressEnrichingAppSource(
 				pairingResponse.AssignedIP,
@@ -157,34 +194,110 @@ var clientCommand *cli.Command = &cli.Command{
 				),
 			),
 			pairingResponse,
-			syncing.NewStaticMetadataFactory(getClientMetadata(c)),
+			syncing.NewStaticMetadataFactory(metadata),
+			getSyncingClientOptions(userspaceDevice,
+				syncing.WithChangeNotifier(localListenerRegistry),
+				syncing.WithRequestTraces(localListenerRegistry),
+				syncing.WithMetadataObserver(pairing.NewServerKeyFollower(ctx, wgConfig, wgReloader, pairingKeyCache)),
+			)...,
 		)
 		if scErr != nil {
-			logrus.Fatalf("Failed to create syncing client: %v", scErr)
+			return fmt.Errorf("failed to create syncing client: %w", scErr)
 		}
 
-		go func() {
-			err := api.NewAdminAPI([]api.Controller{
+		g, ctx := errgroup.WithContext(ctx)
+		if c.Duration(keyRotationIntervalFlag.Name) > 0 {
+			g.Go(func() error {
+				keyRotator.RotateEvery(ctx, c.Duration(keyRotationIntervalFlag.Name))
+				return nil
+			})
+		}
+		g.Go(func() error {
+			return serveAdminAPI(ctx, api.NewAdminAPI([]api.Controller{
 				api.NewAppsController(
 					remoteListenerRegistry,
 				),
-			}, configureAPIServer(c)).Run(":8082")
-			if err != nil {
-				logrus.Fatalf("Failed to start admin API: %v", err)
-			}
-		}()
+				api.NewKeysController(keyRotator),
+			}, configureAPIServer(c)))
+		})
+		g.Go(func() error {
+			return sc.Start(ctx)
+		})
 
-		return sc.Start()
+		return g.Wait()
 	},
 }
 
-func getClientMetadata(c *cli.Context) syncing.Metadata {
+// getRemoteExposer returns the exposer of the apps of the server. With the userspace Wireguard
+// interface, the connections are accepted by the kernel and proxied over the tunnel.
+func getRemoteExposer(c *cli.Context, userspaceDevice *wg.UserspaceDevice) listeners.Exposer {
+	if userspaceDevice != nil {
+		return proxy.NewExposer(
+			"", nginx.NewRangePortAllocator(25001, 30000), net.Listen, userspaceDevice.DialContext,
+		)
+	}
+	return nginx.NewNginxExposer(
+		c.String(nginxExposerConfdPathFlag.Name),
+		"remote",
+		nginx.NewDefaultReloader(),
+		nginx.NewRangePortAllocator(25001, 30000),
+		nginx.NewAllAcceptWireguardListener(),
+	)
+}
+
+// getLocalExposer returns the exposer of the apps of the client. With the userspace Wireguard
+// interface, the connections are accepted over the tunnel and proxied by the kernel.
+func getLocalExposer(c *cli.Context, userspaceDevice *wg.UserspaceDevice, assignedIP string) listeners.Exposer {
+	if userspaceDevice != nil {
+		return proxy.NewExposer(
+			assignedIP, nginx.NewRangePortAllocator(20000, 25000), userspaceDevice.Listen, (&net.Dialer{}).DialContext,
+		)
+	}
+	return nginx.NewNginxExposer(
+		c.String(nginxExposerConfdPathFlag.Name),
+		"local",
+		nginx.NewDefaultReloader(),
+		nginx.NewRangePortAllocator(20000, 25000),
+		nginx.NewOnlyGivenAddressListener(assignedIP),
+	)
+}
+
+func getSyncingClientOptions(
+	userspaceDevice *wg.UserspaceDevice, opts ...syncing.ClientOption,
+) []syncing.ClientOption {
+	if userspaceDevice != nil {
+		opts = append(opts, syncing.WithDialer(userspaceDevice.DialContext))
+	}
+	return opts
+}
+
+func getClientMetadata(c *cli.Context) (syncing.Metadata, error) {
 	metadata := syncing.Metadata{}
 	if c.String(clientMetadataFlag.Name) != "" {
 		unmarshalErr := json.Unmarshal([]byte(c.String(clientMetadataFlag.Name)), &metadata)
 		if unmarshalErr != nil {
-			logrus.Fatalf("Failed to unmarshal metadata: %v", unmarshalErr)
+			return nil, fmt.Errorf("failed to unmarshal metadata: %w", unmarshalErr)
+		}
+	}
+	return metadata, nil
+}
+
+func getClientPairingTransport(c *cli.Context) (pairing.ClientTransport, error) {
+	var tlsConfig *tls.Config
+	if c.String(tlsServerCAFlag.Name) != "" || c.String(tlsCertFlag.Name) != "" || c.String(tlsKeyFlag.Name) != "" {
+		var tlsErr error
+		tlsConfig, tlsErr = pairing.NewClientTLSConfig(
+			c.String(tlsServerCAFlag.Name),
+			c.String(tlsCertFlag.Name),
+			c.String(tlsKeyFlag.Name),
+		)
+		if tlsErr != nil {
+			return nil, tlsErr
 		}
 	}
-	return metadata
+	serverURL := c.String(pairingServerURL.Name)
+	if strings.HasPrefix(serverURL, pairing.GRPCURLPrefix) || strings.HasPrefix(serverURL, pairing.GRPCTLSURLPrefix) {
+		return pairing.NewGRPCClientPairingTransport(serverURL, tlsConfig)
+	}
+	return pairing.NewHTTPClientPairingTransport(serverURL, tlsConfig), nil
 }
@@ -1,6 +1,10 @@
 package cmd
 
-import "github.com/urfave/cli/v2"
+import (
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
 
 var nginxExposerConfdPathFlag *cli.StringFlag = &cli.StringFlag{
 	Name:  "nginx-confd-path",
@@ -12,11 +16,39 @@ var wireguardConfigFilePathFlag *cli.StringFlag = &cli.StringFlag{
 	Value: "/storage/wireguard/wg0.conf",
 }
 
+var wireguardDeviceFlag *cli.StringFlag = &cli.StringFlag{
+	Name: "wg-device",
+	Usage: ("Name of an existing Wireguard interface, for example wg0, to configure directly using wgctrl " +
+		"instead of writing the --wg-config file. Requires NET_ADMIN capability"),
+}
+
+var wireguardReconcileIntervalFlag *cli.DurationFlag = &cli.DurationFlag{
+	Name:  "wg-reconcile-interval",
+	Value: time.Minute,
+	Usage: "How often the configuration is applied again to the --wg-device interface, 0 disables it",
+}
+
+var wireguardUserspaceFlag *cli.BoolFlag = &cli.BoolFlag{
+	Name: "wg-userspace",
+	Usage: ("Run the Wireguard interface in the process using wireguard-go and a userspace network stack, " +
+		"does not require the kernel module nor privileges, but supports only TCP apps"),
+}
+
 var peerStorageDBFlag *cli.StringFlag = &cli.StringFlag{
 	Name:  "peer-storage-db",
 	Value: "",
 }
 
+var inviteStorageDBFlag *cli.StringFlag = &cli.StringFlag{
+	Name:  "invite-storage-db",
+	Value: "",
+}
+
+var ipReservationStorageDBFlag *cli.StringFlag = &cli.StringFlag{
+	Name:  "ip-reservation-storage-db",
+	Value: "",
+}
+
 var peerMetadataStorageDBFlag *cli.StringFlag = &cli.StringFlag{
 	Name:  "peer-metadata-storage-db",
 	Value: "",
@@ -39,6 +71,12 @@ var pairingClientCacheDBPath *cli.StringFlag = &cli.StringFlag{
 	Value: "",
 }
 
+var kubernetesStorageFlag *cli.StringFlag = &cli.StringFlag{
+	Name: "kubernetes-storage",
+	Usage: ("Keep the peers, keys, IP reservations, invites, metadata and pairing cache in Kubernetes Secrets " +
+		"in --kubernetes-namespace, named with the given prefix, instead of the *-db files"),
+}
+
 var kubernetesFlag *cli.BoolFlag = &cli.BoolFlag{
 	Name:  "kubernetes",
 	Usage: "Use kubernetes to create proxy services",
@@ -70,6 +108,18 @@ var inviteTokenFlag *cli.StringFlag = &cli.StringFlag{
 	Value:   "",
 }
 
+var pskLegacyFlag *cli.BoolFlag = &cli.BoolFlag{
+	Name:  "psk-legacy",
+	Usage: "Enables the legacy, replayable PSK scheme, for compatibility with older servers and clients",
+	Value: false,
+}
+
+var invitesFlag *cli.BoolFlag = &cli.BoolFlag{
+	Name:  "invites",
+	Usage: "Enables per-client invite tokens, managed using the admin API",
+	Value: false,
+}
+
 var peerNameFlag *cli.StringFlag = &cli.StringFlag{
 	Name:     "name",
 	Required: true,
@@ -94,3 +144,42 @@ var basicAuthPasswordFlag *cli.StringFlag = &cli.StringFlag{
 	EnvVars: []string{"BASIC_AUTH_PASSWORD"},
 	Value:   "",
 }
+
+var tlsCertFlag *cli.StringFlag = &cli.StringFlag{
+	Name:  "tls-cert",
+	Value: "",
+	Usage: ("Certificate file used for TLS on the external pairing endpoint (server) or for authenticating " +
+		"to the server (client), reloaded when changed"),
+}
+
+var tlsKeyFlag *cli.StringFlag = &cli.StringFlag{
+	Name:  "tls-key",
+	Value: "",
+	Usage: "Private key file of the --tls-cert certificate",
+}
+
+var tlsClientCAFlag *cli.StringFlag = &cli.StringFlag{
+	Name:  "tls-client-ca",
+	Value: "",
+	Usage: ("CA file used to verify client certificates. When set, clients must present a certificate " +
+		"issued for their name, which may be used instead of the invite token"),
+}
+
+var tlsServerCAFlag *cli.StringFlag = &cli.StringFlag{
+	Name:  "tls-server-ca",
+	Value: "",
+	Usage: "CA file used to verify the server certificate instead of the system CAs",
+}
+
+var keyRotationIntervalFlag *cli.DurationFlag = &cli.DurationFlag{
+	Name:  "key-rotation-interval",
+	Value: 0,
+	Usage: ("Interval of Wireguard key pair rotation, 0 disables scheduled rotation. The keys may be also " +
+		"rotated using the admin API"),
+}
+
+var cleanupOnShutdownFlag *cli.BoolFlag = &cli.BoolFlag{
+	Name: "cleanup-on-shutdown",
+	Usage: ("Withdraw the exposed apps on shutdown, removing their NGINX configs and Kubernetes services. " +
+		"By default they are kept, so the apps stay reachable while wormhole restarts"),
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/k8s/svcdetector"
+	"github.com/glothriel/wormhole/pkg/listeners"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const adminAPIAddress = ":8082"
+
+// shutdownContext returns a context, that is done when wormhole receives SIGTERM or SIGINT.
+// The second signal terminates wormhole immediately.
+func shutdownContext(c *cli.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(c.Context, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		logrus.Info("Shutting down, waiting for the requests in progress")
+		stop()
+	}()
+	return ctx, stop
+}
+
+// registryWatcher runs Watch of the registries. They are stopped separately from the other
+// components, as the syncs in progress still change the apps while shutting down.
+type registryWatcher struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	registries []*listeners.Registry
+}
+
+func (w *registryWatcher) watch(registry *listeners.Registry, changes chan svcdetector.AppStateChange) {
+	w.registries = append(w.registries, registry)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		registry.Watch(w.ctx, changes)
+	}()
+}
+
+// stop stops watching the changes and, if cleanup is set, withdraws the apps of the registries
+func (w *registryWatcher) stop(cleanup bool) {
+	w.cancel()
+	w.wg.Wait()
+	if !cleanup {
+		return
+	}
+	for _, registry := range w.registries {
+		if withdrawErr := registry.WithdrawAll(); withdrawErr != nil {
+			logrus.Errorf("Failed to withdraw the exposed apps: %v", withdrawErr)
+		}
+	}
+}
+
+func newRegistryWatcher() *registryWatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &registryWatcher{ctx: ctx, cancel: cancel}
+}
+
+// serveAdminAPI serves the admin API until the context is done
+func serveAdminAPI(ctx context.Context, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              adminAPIAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Second * 5,
+	}
+	go func() {
+		<-ctx.Done()
+		if shutdownErr := server.Shutdown(context.Background()); shutdownErr != nil {
+			logrus.Errorf("Failed to stop admin API: %v", shutdownErr)
+		}
+	}()
+	if serveErr := server.ListenAndServe(); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		return fmt.Errorf("failed to start admin API: %w", serveErr)
+	}
+	return nil
+}
+
+// closeStorages closes the storages holding resources, like bolt databases
+func closeStorages(storages ...any) {
+	for _, storage := range storages {
+		if closer, ok := storage.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil {
+				logrus.Errorf("Failed to close storage: %v", closeErr)
+			}
+		}
+	}
+}
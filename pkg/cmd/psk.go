@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/urfave/cli/v2"
+)
+
+func getPSKOptions(c *cli.Context) []pairing.PSKOption {
+	if c.Bool(pskLegacyFlag.Name) {
+		return []pairing.PSKOption{pairing.WithLegacyPSK()}
+	}
+	return nil
+}
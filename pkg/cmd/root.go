@@ -44,6 +44,19 @@ func Run() {
 				Name:  "metrics-port",
 				Value: 8090,
 			},
+			&cli.BoolFlag{
+				Name:  "tracing",
+				Usage: "Export OpenTelemetry traces of the pairing, syncs and exposing of the apps using OTLP over gRPC",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "tracing-endpoint",
+				Usage: "host:port of the OTLP collector, defaults to OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317",
+			},
+			&cli.BoolFlag{
+				Name:  "tracing-insecure",
+				Usage: "Connect to the OTLP collector without TLS",
+			},
 		},
 
 		Before: setLogLevel,
@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/glothriel/wormhole/pkg/api"
@@ -13,8 +19,8 @@ import (
 	"github.com/glothriel/wormhole/pkg/listeners"
 	"github.com/glothriel/wormhole/pkg/nginx"
 	"github.com/glothriel/wormhole/pkg/wg"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
 )
 
 var (
@@ -47,6 +53,76 @@ var (
 		Name:  "int-server-listen-port",
 		Value: 8081,
 	}
+
+	syncLongPollTimeoutFlag *cli.DurationFlag = &cli.DurationFlag{
+		Name:  "sync-long-poll-timeout",
+		Value: time.Second * 25,
+		Usage: ("How long the server may hold sync requests of clients, that wait for changes of the apps. " +
+			"Set to 0 to make the clients poll periodically instead"),
+	}
+
+	transportFlag *cli.StringFlag = &cli.StringFlag{
+		Name:  "transport",
+		Value: "http",
+		Usage: ("Transport used for pairing and syncing. Allowed values: http, grpc. " +
+			"Clients connect to grpc transport using grpc:// scheme in --server URL"),
+	}
+
+	keyRotationGracePeriodFlag *cli.DurationFlag = &cli.DurationFlag{
+		Name:  "key-rotation-grace-period",
+		Value: time.Minute * 10,
+		Usage: ("How long the next Wireguard key of the server is announced to the clients before the server " +
+			"switches to it. Should be much longer than --sync-long-poll-timeout"),
+	}
+
+	peerStaleAfterFlag *cli.DurationFlag = &cli.DurationFlag{
+		Name:  "peer-stale-after",
+		Value: time.Minute,
+		Usage: "Peers, that did not sync for this long, are reported as stale by the admin API",
+	}
+
+	peerDeadAfterFlag *cli.DurationFlag = &cli.DurationFlag{
+		Name:  "peer-dead-after",
+		Value: time.Minute * 5,
+		Usage: "Peers, that did not sync nor make a Wireguard handshake for this long, are reported as dead",
+	}
+
+	peerAppsTTLFlag *cli.DurationFlag = &cli.DurationFlag{
+		Name:  "peer-apps-ttl",
+		Usage: "Apps of the peers, that did not sync for this long, are withdrawn. 0 disables it",
+	}
+
+	peerTTLFlag *cli.DurationFlag = &cli.DurationFlag{
+		Name: "peer-ttl",
+		Usage: ("Peers, that did not sync for this long, are deleted and their IPs are freed. Should be longer " +
+			"than --peer-apps-ttl. 0 disables it"),
+	}
+
+	leaderElectionFlag *cli.BoolFlag = &cli.BoolFlag{
+		Name: "leader-election",
+		Usage: ("Run in active/passive mode. The replicas elect the active one using a Kubernetes Lease in " +
+			"--kubernetes-namespace, its pod is labeled with " + k8s.LeaderLabel + "=true, the others stand by. " +
+			"Requires --kubernetes-storage"),
+	}
+
+	leaderElectionLeaseFlag *cli.StringFlag = &cli.StringFlag{
+		Name:  "leader-election-lease",
+		Value: "wormhole-server",
+		Usage: "Name of the Lease used for the leader election",
+	}
+
+	podNameFlag *cli.StringFlag = &cli.StringFlag{
+		Name:    "pod-name",
+		EnvVars: []string{"POD_NAME"},
+		Usage:   "Name of the pod running wormhole, identifies the replica in the leader election. Defaults to the hostname",
+	}
+
+	relayPolicyFlag *cli.StringFlag = &cli.StringFlag{
+		Name:  "relay-policy",
+		Value: "none",
+		Usage: ("Decides which clients can see apps exposed by other clients, that do not list their " +
+			"allowed peers, the traffic is relayed through the server. Allowed values: none, all"),
+	}
 )
 
 var serverCommand *cli.Command = &cli.Command{
@@ -54,12 +130,18 @@ var serverCommand *cli.Command = &cli.Command{
 	Flags: []cli.Flag{
 		kubernetesFlag,
 		inviteTokenFlag,
+		invitesFlag,
+		pskLegacyFlag,
+		inviteStorageDBFlag,
+		ipReservationStorageDBFlag,
 		basicAuthUsernameFlag,
 		basicAuthPasswordFlag,
 		stateManagerPathFlag,
 		nginxExposerConfdPathFlag,
 		wgPublicHostFlag,
 		wireguardConfigFilePathFlag,
+		wireguardDeviceFlag,
+		wireguardReconcileIntervalFlag,
 		extServerListenAddress,
 		intServerListenPort,
 		kubernetesNamespaceFlag,
@@ -72,139 +154,318 @@ var serverCommand *cli.Command = &cli.Command{
 		wgSubnetFlag,
 		wgPortFlag,
 		keyStorageDBFlag,
+		kubernetesStorageFlag,
+		relayPolicyFlag,
+		syncLongPollTimeoutFlag,
+		keyRotationGracePeriodFlag,
+		peerStaleAfterFlag,
+		peerDeadAfterFlag,
+		peerAppsTTLFlag,
+		peerTTLFlag,
+		transportFlag,
+		tlsCertFlag,
+		tlsKeyFlag,
+		tlsClientCAFlag,
+		cleanupOnShutdownFlag,
+		leaderElectionFlag,
+		leaderElectionLeaseFlag,
+		podNameFlag,
 	},
 	Action: func(c *cli.Context) error {
 		startPrometheusServer(c)
-
-		privateKey, publicKey, keyErr := wg.GetOrGenerateKeyPair(getKeyStorage(c))
-		if keyErr != nil {
-			logrus.Fatalf("Failed to get or generate key pair: %v", keyErr)
+		stopTracing, tracingErr := startTracing(c)
+		if tracingErr != nil {
+			return tracingErr
+		}
+		defer stopTracing()
+		ctx, stop := shutdownContext(c)
+		defer stop()
+		if !c.Bool(leaderElectionFlag.Name) {
+			return runServer(ctx, c)
 		}
+		election, electionErr := getLeaderElection(c)
+		if electionErr != nil {
+			return electionErr
+		}
+		return election.Run(ctx, func(ctx context.Context) error {
+			return runServer(ctx, c)
+		})
+	},
+}
 
-		appsExposedHere := listeners.NewApps(nginx.NewNginxExposer(
-			c.String(nginxExposerConfdPathFlag.Name),
-			"local",
-			nginx.NewDefaultReloader(),
-			nginx.NewRangePortAllocator(20000, 25000),
-			nginx.NewOnlyGivenAddressListener(c.String(wgAddressFlag.Name)),
-		))
+// runServer runs the server until the context is done
+func runServer(ctx context.Context, c *cli.Context) error { // nolint: funlen
+	g, ctx := errgroup.WithContext(ctx)
 
-		remoteNginxExposer := nginx.NewNginxExposer(
-			c.String(nginxExposerConfdPathFlag.Name),
-			"remote",
-			nginx.NewDefaultReloader(),
-			nginx.NewRangePortAllocator(25001, 30000),
-			nginx.NewAllAcceptWireguardListener(),
-		)
-		var effectiveExposer listeners.Exposer = remoteNginxExposer
-
-		if c.Bool(kubernetesFlag.Name) {
-			namespace := c.String(kubernetesNamespaceFlag.Name)
-			rawLabels := c.String(kubernetesLabelsFlag.Name)
-			if namespace == "" || rawLabels == "" {
-				logrus.Fatalf(
-					"Namespace (--%s) and labels (--%s) must be set when using kubernetes integration",
-					kubernetesNamespaceFlag.Name,
-					kubernetesLabelsFlag.Name,
-				)
-			}
-			effectiveExposer = k8s.NewK8sExposer(
-				c.String(kubernetesNamespaceFlag.Name),
-				k8s.CSVToMap(c.String(kubernetesLabelsFlag.Name)),
-				c.Bool(enableNetworkPoliciesFlag.Name),
-				remoteNginxExposer,
-			)
-		}
-		appsExposedFromRemote := listeners.NewApps(effectiveExposer)
+	keyStorage, keyStorageErr := getKeyStorage(c)
+	if keyStorageErr != nil {
+		return keyStorageErr
+	}
+	defer closeStorages(keyStorage)
+	privateKey, publicKey, keyErr := wg.GetOrGenerateKeyPair(keyStorage)
+	if keyErr != nil {
+		return fmt.Errorf("failed to get or generate key pair: %w", keyErr)
+	}
 
-		go appsExposedHere.Watch(getAppStateChangeGenerator(c).Changes(), make(chan bool))
+	appsExposedHere := listeners.NewApps(nginx.NewNginxExposer(
+		c.String(nginxExposerConfdPathFlag.Name),
+		"local",
+		nginx.NewDefaultReloader(),
+		nginx.NewRangePortAllocator(20000, 25000),
+		nginx.NewOnlyGivenAddressListener(c.String(wgAddressFlag.Name)),
+	), listeners.WithName("local"))
 
-		remoteNginxAdapter := syncing.NewAppStateChangeGenerator()
-		go appsExposedFromRemote.Watch(remoteNginxAdapter.Changes(), make(chan bool))
+	remoteNginxExposer := nginx.NewNginxExposer(
+		c.String(nginxExposerConfdPathFlag.Name),
+		"remote",
+		nginx.NewDefaultReloader(),
+		nginx.NewRangePortAllocator(25001, 30000),
+		nginx.NewAllAcceptWireguardListener(),
+	)
+	effectiveExposer, exposerErr := getKubernetesExposer(c, remoteNginxExposer)
+	if exposerErr != nil {
+		return exposerErr
+	}
+	appsExposedFromRemote := listeners.NewApps(effectiveExposer, listeners.WithName("remote"))
 
-		wgConfig := &wg.Config{
-			Address:    c.String(wgAddressFlag.Name),
-			Subnet:     c.String(wgSubnetFlag.Name),
-			ListenPort: c.Int(wgPortFlag.Name),
-			PrivateKey: privateKey,
-		}
-		peerStorage := getPeerStorage(c)
-		savedPeers, peersErr := peerStorage.List()
-		if peersErr != nil {
-			logrus.Panicf("failed to list peers: %v", peersErr)
-		}
-		for _, savedPeer := range savedPeers {
-			wgConfig.Upsert(wg.Peer{
-				Name:       savedPeer.Name,
-				PublicKey:  savedPeer.PublicKey,
-				AllowedIPs: fmt.Sprintf("%s/32,%s/32", savedPeer.IP, wgConfig.Address),
-			})
-		}
-		syncTransport := syncing.NewHTTPServerSyncingTransport(&http.Server{
-			Addr:              fmt.Sprintf("%s:%d", c.String(wgAddressFlag.Name), c.Int(intServerListenPort.Name)),
-			ReadHeaderTimeout: time.Second * 5,
+	registries := newRegistryWatcher()
+	defer registries.stop(c.Bool(cleanupOnShutdownFlag.Name))
+	registries.watch(appsExposedHere, getAppStateChangeGenerator(ctx, c).Changes())
+
+	remoteNginxAdapter := syncing.NewAppStateChangeGenerator()
+	registries.watch(appsExposedFromRemote, remoteNginxAdapter.Changes())
+
+	wgConfig := &wg.Config{
+		Address:    c.String(wgAddressFlag.Name),
+		Subnet:     c.String(wgSubnetFlag.Name),
+		ListenPort: c.Int(wgPortFlag.Name),
+		PrivateKey: privateKey,
+	}
+	peerStorage, peerStorageErr := getPeerStorage(c)
+	if peerStorageErr != nil {
+		return peerStorageErr
+	}
+	defer closeStorages(peerStorage)
+	savedPeers, peersErr := peerStorage.List()
+	if peersErr != nil {
+		return fmt.Errorf("failed to list peers: %w", peersErr)
+	}
+	for _, savedPeer := range savedPeers {
+		wgConfig.Upsert(wg.Peer{
+			Name:       savedPeer.Name,
+			PublicKey:  savedPeer.PublicKey,
+			AllowedIPs: fmt.Sprintf("%s,%s", wg.HostCIDR(savedPeer.IP), wg.HostCIDR(wgConfig.Address)),
 		})
+	}
+	syncTransport, peerTransport, transportErr := getServerTransports(ctx, c)
+	if transportErr != nil {
+		return transportErr
+	}
+
+	appSource := syncing.NewAddressEnrichingAppSource(
+		wgConfig.Address,
+		syncing.NewPeerEnrichingAppSource(c.String(peerNameFlag.Name), appsExposedHere),
+	)
+
+	metadataStorage, metadataErr := getPeerMetadataStorage(c)
+	if metadataErr != nil {
+		return metadataErr
+	}
+	defer closeStorages(metadataStorage)
+
+	watcher, watcherErr := getWireguardReloader(ctx, c)
+	if watcherErr != nil {
+		return watcherErr
+	}
+	serverKeyPair := pairing.KeyPair{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+	}
+	// Guards the Wireguard config, that is modified by the pairing server, the key rotator and the deleter
+	configLock := &sync.Mutex{}
+	keyRotator := pairing.NewServerKeyRotator(
+		ctx, serverKeyPair, keyStorage, wgConfig, configLock, watcher, c.Duration(keyRotationGracePeriodFlag.Name),
+	)
+	if resumeErr := keyRotator.Resume(); resumeErr != nil {
+		return fmt.Errorf("failed to resume server key rotation: %w", resumeErr)
+	}
+	peerDeleter := pairing.NewPeerDeleter(peerStorage, wgConfig, configLock, watcher)
 
-		appSource := syncing.NewAddressEnrichingAppSource(
-			wgConfig.Address,
-			syncing.NewPeerEnrichingAppSource("server", appsExposedHere),
+	syncingServerOpts := []syncing.ServerOption{
+		syncing.WithEncoders(syncing.NewProtobufSyncingEncoder()),
+		syncing.WithResponseMetadata(keyRotator),
+		syncing.WithResponseTraces(appsExposedHere),
+	}
+	changeNotifiers := []syncing.ChangeNotifier{appsExposedHere}
+	relayPolicy, policyErr := syncing.NewAppPolicy(c.String(relayPolicyFlag.Name))
+	if policyErr != nil {
+		return policyErr
+	}
+	relayNginxAdapter := syncing.NewAppStateChangeGenerator()
+	appsRelayed := listeners.NewApps(nginx.NewNginxExposer(
+		c.String(nginxExposerConfdPathFlag.Name),
+		"relay",
+		nginx.NewDefaultReloader(),
+		nginx.NewRangePortAllocator(30001, 35000),
+		nginx.NewOnlyGivenAddressListener(c.String(wgAddressFlag.Name)),
+	), listeners.WithName("relay"))
+	registries.watch(appsRelayed, relayNginxAdapter.Changes())
+	changeNotifiers = append(changeNotifiers, appsRelayed)
+	syncingServerOpts = append(syncingServerOpts, syncing.WithRelay(syncing.NewRelay(
+		relayNginxAdapter,
+		syncing.NewAddressEnrichingAppSource(wgConfig.Address, appsRelayed),
+		relayPolicy,
+	)))
+	if c.Duration(peerAppsTTLFlag.Name) > 0 || c.Duration(peerTTLFlag.Name) > 0 {
+		syncingServerOpts = append(syncingServerOpts, syncing.WithPeerExpiry(
+			c.Duration(peerAppsTTLFlag.Name),
+			c.Duration(peerTTLFlag.Name),
+			peerDeleter,
+		))
+	}
+	if c.Duration(syncLongPollTimeoutFlag.Name) > 0 {
+		syncingServerOpts = append(syncingServerOpts, syncing.WithLongPolling(
+			c.Duration(syncLongPollTimeoutFlag.Name),
+			changeNotifiers...,
+		))
+	}
+
+	ss := syncing.NewServer(
+		c.String(peerNameFlag.Name),
+		remoteNginxAdapter,
+		appSource,
+		syncing.NewJSONSyncingEncoder(),
+		syncTransport,
+		peerStorage,
+		metadataStorage,
+		syncingServerOpts...,
+	)
+	updateErr := watcher.Update(*wgConfig)
+	if updateErr != nil {
+		return fmt.Errorf("failed to bootstrap wireguard config: %w", updateErr)
+	}
+	reservationStorage, reservationsErr := getIPReservationStorage(c)
+	if reservationsErr != nil {
+		return reservationsErr
+	}
+	defer closeStorages(reservationStorage)
+	ipam, ipamErr := pairing.NewIPPool(
+		fmt.Sprintf("%s/%s", c.String(wgAddressFlag.Name), c.String(wgSubnetFlag.Name)),
+		peerStorage,
+		reservationStorage,
+	)
+	if ipamErr != nil {
+		return ipamErr
+	}
+	pairingServerOpts := []pairing.ServerOption{
+		pairing.WithServerKeyRotator(keyRotator),
+		pairing.WithConfigLock(configLock),
+	}
+	controllers := []api.Controller{
+		api.NewAppsController(appsExposedFromRemote),
+		api.NewPeersController(peerStorage, peerDeleter, metadataStorage, ss, getPeerHealth(c, ss, watcher)),
+		api.NewKeysController(keyRotator),
+		api.NewReservationsController(ipam),
+	}
+	if c.Bool(invitesFlag.Name) {
+		inviteStorage, invitesErr := getInviteStorage(c)
+		if invitesErr != nil {
+			return invitesErr
+		}
+		defer closeStorages(inviteStorage)
+		peerTransport = pairing.NewInvitesPSKPairingServerTransport(
+			c.String(inviteTokenFlag.Name),
+			inviteStorage,
+			peerTransport,
+			getPSKOptions(c)...,
+		)
+		pairingServerOpts = append(pairingServerOpts, pairing.WithInvites(inviteStorage))
+		controllers = append(controllers, api.NewInvitesController(inviteStorage))
+	} else if c.String(inviteTokenFlag.Name) != "" {
+		peerTransport = pairing.NewPSKPairingServerTransport(
+			c.String(inviteTokenFlag.Name),
+			peerTransport,
+			getPSKOptions(c)...,
 		)
+	}
+	ps := pairing.NewServer(
+		"server",
+		net.JoinHostPort(c.String(wgPublicHostFlag.Name), strconv.Itoa(c.Int(wgPortFlag.Name))),
+		wgConfig,
+		serverKeyPair,
+		watcher,
+		pairing.NewJSONPairingEncoder(),
+		peerTransport,
+		ipam,
+		peerStorage,
+		[]pairing.MetadataEnricher{syncTransport, ss},
+		append(pairingServerOpts, pairing.WithEncoders(pairing.NewProtobufPairingEncoder()))...,
+	)
+	g.Go(func() error {
+		return ss.Start(ctx)
+	})
+	g.Go(func() error {
+		return ps.Start(ctx)
+	})
+	g.Go(func() error {
+		return serveAdminAPI(ctx, api.NewAdminAPI(controllers, configureAPIServer(c)))
+	})
 
-		metadataStorage := getPeerMetadataStorage(c)
+	return g.Wait()
+}
 
-		ss := syncing.NewServer(
-			c.String(peerNameFlag.Name),
-			remoteNginxAdapter,
-			appSource,
-			syncing.NewJSONSyncingEncoder(),
-			syncTransport,
-			peerStorage,
-			metadataStorage,
+func getServerTransports(
+	ctx context.Context, c *cli.Context,
+) (syncing.ServerTransport, pairing.ServerTransport, error) {
+	syncAddress := net.JoinHostPort(c.String(wgAddressFlag.Name), strconv.Itoa(c.Int(intServerListenPort.Name)))
+	var tlsConfig *tls.Config
+	if c.String(tlsCertFlag.Name) != "" || c.String(tlsKeyFlag.Name) != "" {
+		var tlsErr error
+		tlsConfig, tlsErr = pairing.NewServerTLSConfig(
+			c.String(tlsCertFlag.Name),
+			c.String(tlsKeyFlag.Name),
+			c.String(tlsClientCAFlag.Name),
 		)
-		watcher := wg.NewWatcher(c.String(wireguardConfigFilePathFlag.Name))
-		updateErr := watcher.Update(*wgConfig)
-		if updateErr != nil {
-			return fmt.Errorf("failed to bootstrap wireguard config: %w", updateErr)
+		if tlsErr != nil {
+			return nil, nil, tlsErr
 		}
-		peerTransport := pairing.NewHTTPServerPairingTransport(&http.Server{
+	} else if c.String(tlsClientCAFlag.Name) != "" {
+		return nil, nil, fmt.Errorf("--%s requires --%s and --%s", tlsClientCAFlag.Name, tlsCertFlag.Name, tlsKeyFlag.Name)
+	}
+	switch c.String(transportFlag.Name) {
+	case "http":
+		syncTransport := syncing.NewHTTPServerSyncingTransport(ctx, &http.Server{
+			Addr:              syncAddress,
+			ReadHeaderTimeout: time.Second * 5,
+		})
+		peerTransport := pairing.NewHTTPServerPairingTransport(ctx, &http.Server{
 			Addr:              c.String(extServerListenAddress.Name),
 			ReadHeaderTimeout: time.Second * 5,
+			TLSConfig:         tlsConfig,
 		})
-		if c.String(inviteTokenFlag.Name) != "" {
-			peerTransport = pairing.NewPSKPairingServerTransport(
-				c.String(inviteTokenFlag.Name),
-				peerTransport,
-			)
-		}
-		ps := pairing.NewServer(
-			"server",
-			fmt.Sprintf("%s:%d", c.String(wgPublicHostFlag.Name), c.Int(wgPortFlag.Name)),
-			wgConfig,
-			pairing.KeyPair{
-				PublicKey:  publicKey,
-				PrivateKey: privateKey,
-			},
-			watcher,
-			pairing.NewJSONPairingEncoder(),
-			peerTransport,
-			pairing.NewIPPool(c.String(wgAddressFlag.Name), pairing.NewReservedAddressLister(
-				peerStorage,
-			)),
-			peerStorage,
-			[]pairing.MetadataEnricher{syncTransport},
+		return syncTransport, peerTransport, nil
+	case "grpc":
+		return syncing.NewGRPCServerSyncingTransport(ctx, syncAddress),
+			pairing.NewGRPCServerPairingTransport(ctx, c.String(extServerListenAddress.Name), tlsConfig), nil
+	}
+	return nil, nil, fmt.Errorf("unknown transport: %s", c.String(transportFlag.Name))
+}
+
+func getLeaderElection(c *cli.Context) (*k8s.LeaderElection, error) {
+	if !c.Bool(kubernetesFlag.Name) || c.String(kubernetesNamespaceFlag.Name) == "" ||
+		c.String(kubernetesStorageFlag.Name) == "" {
+		// The replicas share the state, which is not safe with BoltDB files
+		return nil, fmt.Errorf(
+			"--%s requires --%s, --%s and --%s", leaderElectionFlag.Name,
+			kubernetesFlag.Name, kubernetesNamespaceFlag.Name, kubernetesStorageFlag.Name,
 		)
-		go ss.Start()
-		go func() {
-			err := api.NewAdminAPI([]api.Controller{
-				api.NewAppsController(appsExposedFromRemote),
-				api.NewPeersController(peerStorage, wgConfig, watcher, metadataStorage),
-			}, configureAPIServer(c)).Run(":8082")
-			if err != nil {
-				logrus.Fatalf("Failed to start admin API: %v", err)
-			}
-		}()
-
-		ps.Start()
-		return nil
-	},
+	}
+	pod := c.String(podNameFlag.Name)
+	if pod == "" {
+		var hostnameErr error
+		if pod, hostnameErr = os.Hostname(); hostnameErr != nil {
+			return nil, fmt.Errorf("failed to get the name of the pod: %w", hostnameErr)
+		}
+	}
+	return k8s.NewLeaderElection(c.String(kubernetesNamespaceFlag.Name), c.String(leaderElectionLeaseFlag.Name), pod)
 }
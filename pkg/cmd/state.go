@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"time"
 
+	"github.com/glothriel/wormhole/pkg/k8s"
 	"github.com/glothriel/wormhole/pkg/k8s/svcdetector"
+	"github.com/glothriel/wormhole/pkg/listeners"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
 	"github.com/urfave/cli/v2"
@@ -11,7 +15,7 @@ import (
 	"k8s.io/client-go/rest"
 )
 
-func getAppStateChangeGenerator(c *cli.Context) svcdetector.AppStateManager {
+func getAppStateChangeGenerator(ctx context.Context, c *cli.Context) svcdetector.AppStateManager {
 	if c.Bool(kubernetesFlag.Name) {
 		config, inClusterConfigErr := rest.InClusterConfig()
 		if inClusterConfigErr != nil {
@@ -22,11 +26,13 @@ func getAppStateChangeGenerator(c *cli.Context) svcdetector.AppStateManager {
 			logrus.Panic(clientSetErr)
 		}
 		return svcdetector.NewK8sAppStateManager(
+			ctx,
 			svcdetector.NewDefaultServiceRepository(dynamicClient),
 			time.Second*30,
 		)
 	} else if c.String(stateManagerPathFlag.Name) != "" {
 		return svcdetector.NewDirectoryMonitoringAppStateManager(
+			ctx,
 			c.String(stateManagerPathFlag.Name),
 			afero.NewOsFs(),
 		)
@@ -34,3 +40,24 @@ func getAppStateChangeGenerator(c *cli.Context) svcdetector.AppStateManager {
 	logrus.Fatalf("No state manager specified, use --%s or --%s", kubernetesFlag.Name, stateManagerPathFlag.Name)
 	return nil
 }
+
+// getKubernetesExposer decorates the exposer of the remote apps, so that it also creates the
+// Kubernetes services, when the kubernetes integration is enabled
+func getKubernetesExposer(c *cli.Context, exposer listeners.Exposer) (listeners.Exposer, error) {
+	if !c.Bool(kubernetesFlag.Name) {
+		return exposer, nil
+	}
+	if c.String(kubernetesNamespaceFlag.Name) == "" || c.String(kubernetesLabelsFlag.Name) == "" {
+		return nil, fmt.Errorf(
+			"namespace (--%s) and labels (--%s) must be set when using kubernetes integration",
+			kubernetesNamespaceFlag.Name,
+			kubernetesLabelsFlag.Name,
+		)
+	}
+	return k8s.NewK8sExposer(
+		c.String(kubernetesNamespaceFlag.Name),
+		k8s.CSVToMap(c.String(kubernetesLabelsFlag.Name)),
+		c.Bool(enableNetworkPoliciesFlag.Name),
+		exposer,
+	), nil
+}
@@ -1,37 +1,122 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/glothriel/wormhole/pkg/k8s"
 	"github.com/glothriel/wormhole/pkg/pairing"
 	"github.com/glothriel/wormhole/pkg/syncing"
 	"github.com/glothriel/wormhole/pkg/wg"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
 
-func getPeerStorage(c *cli.Context) pairing.PeerStorage {
+// getSecretStorage returns the storage keeping the state in Kubernetes Secrets, or nil when
+// it is not enabled
+func getSecretStorage(c *cli.Context) (*k8s.SecretStorage, error) {
+	if c.String(kubernetesStorageFlag.Name) == "" {
+		return nil, nil
+	}
+	if c.String(kubernetesNamespaceFlag.Name) == "" {
+		return nil, fmt.Errorf("--%s requires --%s", kubernetesStorageFlag.Name, kubernetesNamespaceFlag.Name)
+	}
+	storage, storageErr := k8s.NewSecretStorage(
+		c.String(kubernetesNamespaceFlag.Name), c.String(kubernetesStorageFlag.Name),
+	)
+	if storageErr != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes storage: %w", storageErr)
+	}
+	return storage, nil
+}
+
+func getPeerStorage(c *cli.Context) (pairing.PeerStorage, error) {
+	secretStorage, secretErr := getSecretStorage(c)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secretStorage != nil {
+		// Peers are read on every sync, so they are cached to spare the Kubernetes API
+		return pairing.NewCachingPeerStorage(secretStorage.Peers()), nil
+	}
 	if c.String(peerStorageDBFlag.Name) == "" {
-		return pairing.NewInMemoryPeerStorage()
+		return pairing.NewInMemoryPeerStorage(), nil
+	}
+	return pairing.NewBoltPeerStorage(c.String(peerStorageDBFlag.Name)), nil
+}
+
+func getInviteStorage(c *cli.Context) (pairing.InviteStorage, error) {
+	secretStorage, secretErr := getSecretStorage(c)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secretStorage != nil {
+		return secretStorage.Invites(), nil
+	}
+	if c.String(inviteStorageDBFlag.Name) == "" {
+		return pairing.NewInMemoryInviteStorage(), nil
+	}
+	return pairing.NewBoltInviteStorage(c.String(inviteStorageDBFlag.Name)), nil
+}
+
+func getIPReservationStorage(c *cli.Context) (pairing.IPReservationStorage, error) {
+	secretStorage, secretErr := getSecretStorage(c)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secretStorage != nil {
+		return secretStorage.IPReservations(), nil
 	}
-	return pairing.NewBoltPeerStorage(c.String(peerStorageDBFlag.Name))
+	if c.String(ipReservationStorageDBFlag.Name) == "" {
+		return pairing.NewInMemoryIPReservationStorage(), nil
+	}
+	return pairing.NewBoltIPReservationStorage(c.String(ipReservationStorageDBFlag.Name)), nil
 }
 
-func getKeyStorage(c *cli.Context) wg.KeyStorage {
+func getKeyStorage(c *cli.Context) (wg.KeyStorage, error) {
+	secretStorage, secretErr := getSecretStorage(c)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secretStorage != nil {
+		return secretStorage.Keys(), nil
+	}
 	if c.String(keyStorageDBFlag.Name) == "" {
-		return wg.NewInMemoryKeyStorage()
+		return wg.NewInMemoryKeyStorage(), nil
 	}
-	return wg.NewBoltKeyStorage(c.String(keyStorageDBFlag.Name))
+	return wg.NewBoltKeyStorage(c.String(keyStorageDBFlag.Name)), nil
 }
 
-func getPeerMetadataStorage(c *cli.Context) syncing.MetadataStorage {
-	theStorage := syncing.NewInMemoryMetadataStorage()
-	if c.String(peerMetadataStorageDBFlag.Name) != "" {
-		boltStorage, boltMetadataStorage := syncing.NewBoltMetadataStorage(c.String(peerMetadataStorageDBFlag.Name))
-		if boltMetadataStorage != nil {
-			logrus.Fatalf("Failed to create metadata storage: %v", boltMetadataStorage)
-		}
-		theStorage = syncing.NewCachingMetadataStorage(
-			boltStorage,
-		)
-	}
-	return theStorage
+func getPeerMetadataStorage(c *cli.Context) (syncing.MetadataStorage, error) {
+	secretStorage, secretErr := getSecretStorage(c)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secretStorage != nil {
+		return syncing.NewCachingMetadataStorage(secretStorage.Metadata()), nil
+	}
+	if c.String(peerMetadataStorageDBFlag.Name) == "" {
+		return syncing.NewInMemoryMetadataStorage(), nil
+	}
+	boltStorage, boltErr := syncing.NewBoltMetadataStorage(c.String(peerMetadataStorageDBFlag.Name))
+	if boltErr != nil {
+		return nil, fmt.Errorf("failed to create metadata storage: %w", boltErr)
+	}
+	return syncing.NewCachingMetadataStorage(boltStorage), nil
+}
+
+func getPairingClientCache(c *cli.Context) (pairing.KeyCachingPairingClientStorage, error) {
+	secretStorage, secretErr := getSecretStorage(c)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secretStorage != nil {
+		return secretStorage.PairingCache(), nil
+	}
+	if c.String(pairingClientCacheDBPath.Name) == "" {
+		return pairing.NewInMemoryKeyCachingPairingClientStorage(), nil
+	}
+	storage, storageErr := pairing.NewBoltKeyCachingPairingClientStorage(c.String(pairingClientCacheDBPath.Name))
+	if storageErr != nil {
+		return nil, fmt.Errorf("failed to create pairing key cache: %w", storageErr)
+	}
+	return storage, nil
 }
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/glothriel/wormhole/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+// startTracing sets up exporting the traces, the returned function flushes the remaining spans
+func startTracing(c *cli.Context) (func(), error) {
+	if !c.Bool("tracing") {
+		return func() {}, nil
+	}
+	shutdown, setupErr := tracing.Setup(
+		context.Background(), c.String(peerNameFlag.Name), c.String("tracing-endpoint"), c.Bool("tracing-insecure"),
+	)
+	if setupErr != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %w", setupErr)
+	}
+	logrus.Info("Exporting OpenTelemetry traces")
+	return func() {
+		if shutdownErr := shutdown(context.Background()); shutdownErr != nil {
+			logrus.Errorf("Failed to flush traces: %v", shutdownErr)
+		}
+	}, nil
+}
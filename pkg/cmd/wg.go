@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/glothriel/wormhole/pkg/api"
+	"github.com/glothriel/wormhole/pkg/metrics"
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+// getWireguardReloader returns the reloader configuring the --wg-device interface, if set,
+// or the one writing the --wg-config file otherwise. The interface is reconciled until the
+// context is done.
+func getWireguardReloader(ctx context.Context, c *cli.Context) (wg.WireguardConfigReloader, error) {
+	if c.String(wireguardDeviceFlag.Name) == "" {
+		return wg.NewWatcher(c.String(wireguardConfigFilePathFlag.Name)), nil
+	}
+	reloader, reloaderErr := wg.NewDeviceReloader(c.String(wireguardDeviceFlag.Name))
+	if reloaderErr != nil {
+		return nil, fmt.Errorf("failed to create Wireguard device reloader: %w", reloaderErr)
+	}
+	if registerErr := metrics.RegisterWireguardCollector(reloader); registerErr != nil {
+		logrus.Errorf("Failed to register Wireguard metrics: %v", registerErr)
+	}
+	if c.Duration(wireguardReconcileIntervalFlag.Name) > 0 {
+		go reloader.ReconcileEvery(ctx, c.Duration(wireguardReconcileIntervalFlag.Name))
+	}
+	return reloader, nil
+}
+
+// getPeerHealth configures the health of the peers reported by the admin API. Wireguard
+// statistics are available only if the reloader is able to read them.
+func getPeerHealth(
+	c *cli.Context, syncs api.SyncTracker, reloader wg.WireguardConfigReloader,
+) api.PeerControllerSettings {
+	stats, _ := reloader.(wg.StatsProvider)
+	return api.WithPeerHealth(syncs, stats, c.Duration(peerStaleAfterFlag.Name), c.Duration(peerDeadAfterFlag.Name))
+}
@@ -2,14 +2,20 @@
 package k8s
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 
 	"github.com/glothriel/wormhole/pkg/apps"
 	"github.com/glothriel/wormhole/pkg/listeners"
+	"github.com/glothriel/wormhole/pkg/metrics"
+	"github.com/glothriel/wormhole/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/multierr"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -39,30 +45,36 @@ type k8sResourceExposer struct {
 	clientProvider clientProvider
 }
 
-func (exp *k8sResourceExposer) Add(app apps.App) (apps.App, error) {
+func (exp *k8sResourceExposer) Add(ctx context.Context, app apps.App) (apps.App, error) {
 	clientset, clientSetErr := exp.clientProvider.New()
 	if clientSetErr != nil {
 		return apps.App{}, clientSetErr
 	}
-	addedApp, childFactoryErr := exp.child.Add(app)
+	addedApp, childFactoryErr := exp.child.Add(ctx, app)
 	if childFactoryErr != nil {
 		return apps.App{}, childFactoryErr
 	}
 	entityName := capName(fmt.Sprintf("%s-%s", app.Peer, app.Name))
 	for _, managedResource := range exp.managedResources {
-		addErr := managedResource.Add(k8sResourceMetadata{
+		spanCtx, span := tracing.Tracer().Start(ctx, "k8s.upsert", trace.WithAttributes(
+			attribute.String("k8s.kind", managedResource.Kind()),
+			attribute.String("k8s.name", entityName),
+		))
+		addErr := managedResource.Add(spanCtx, k8sResourceMetadata{
 			entityName:      entityName,
 			originalApp:     app,
 			afterExposedApp: addedApp,
 		}, clientset)
+		tracing.End(span, addErr)
 		if addErr != nil {
-			return apps.App{}, multierr.Combine(addErr, exp.child.Withdraw(app))
+			metrics.KubernetesUpsertErrors.WithLabelValues(managedResource.Kind()).Inc()
+			return apps.App{}, multierr.Combine(addErr, exp.child.Withdraw(ctx, app))
 		}
 	}
 	return apps.WithAddress(addedApp, fmt.Sprintf("%s.%s:%d", entityName, exp.namespace, app.OriginalPort)), nil
 }
 
-func (exp *k8sResourceExposer) Withdraw(app apps.App) error {
+func (exp *k8sResourceExposer) Withdraw(ctx context.Context, app apps.App) error {
 	clientset, clientSetErr := exp.clientProvider.New()
 	if clientSetErr != nil {
 		return clientSetErr
@@ -70,12 +82,12 @@ func (exp *k8sResourceExposer) Withdraw(app apps.App) error {
 	entityName := capName(fmt.Sprintf("%s-%s", app.Peer, app.Name))
 	for i := range exp.managedResources {
 		managedResource := exp.managedResources[len(exp.managedResources)-1-i]
-		removeErr := managedResource.Remove(entityName, clientset)
+		removeErr := managedResource.Remove(ctx, entityName, clientset)
 		if removeErr != nil {
 			return removeErr
 		}
 	}
-	return exp.child.Withdraw(app)
+	return exp.child.Withdraw(ctx, app)
 }
 
 func (exp *k8sResourceExposer) WithdrawAll() error {
@@ -90,7 +102,7 @@ func (exp *k8sResourceExposer) WithdrawAll() error {
 			return removeAllErr
 		}
 	}
-	return nil
+	return exp.child.WithdrawAll()
 }
 
 // NewK8sExposer implements PortOpenerFactory as a decorator over existing PortOpenerFactory, that
@@ -122,14 +134,19 @@ type k8sResourceMetadata struct {
 }
 
 type managedK8sResource interface {
-	Add(k8sResourceMetadata, *kubernetes.Clientset) error
-	Remove(name string, clientset *kubernetes.Clientset) error
+	// Kind names the kind of the resource in the metrics
+	Kind() string
+	Add(context.Context, k8sResourceMetadata, *kubernetes.Clientset) error
+	Remove(ctx context.Context, name string, clientset *kubernetes.Clientset) error
 	RemoveAll(*kubernetes.Clientset) error
 }
 
 func extractPortFromAddr(address string) (int, error) {
-	parts := strings.Split(address, ":")
-	return strconv.Atoi(parts[1])
+	_, port, splitErr := net.SplitHostPort(address)
+	if splitErr != nil {
+		return 0, splitErr
+	}
+	return strconv.Atoi(port)
 }
 
 func capName(name string) string {
@@ -2,6 +2,7 @@
 package k8s
 
 import (
+	"context"
 	"sync"
 	"testing"
 
@@ -45,13 +46,17 @@ type managedMockResource struct {
 	counter *counter
 }
 
-func (m *managedMockResource) Add(metadata k8sResourceMetadata, _ *kubernetes.Clientset) error {
+func (m *managedMockResource) Kind() string {
+	return "mock"
+}
+
+func (m *managedMockResource) Add(_ context.Context, metadata k8sResourceMetadata, _ *kubernetes.Clientset) error {
 	m.addCalled = m.counter.next()
 	m.addLastCalledWith = metadata
 	return m.addErr
 }
 
-func (m *managedMockResource) Remove(entityName string, _ *kubernetes.Clientset) error {
+func (m *managedMockResource) Remove(_ context.Context, entityName string, _ *kubernetes.Clientset) error {
 	m.removeCalled = m.counter.next()
 	m.removeLastCalledWith = entityName
 	return m.removeErr
@@ -77,7 +82,7 @@ func TestExposerAdd(t *testing.T) {
 	exposer.managedResources = []managedK8sResource{rsc1, rsc2}
 
 	// when
-	newApp, err := exposer.Add(apps.App{
+	newApp, err := exposer.Add(context.Background(), apps.App{
 		Name:         "nginxname",
 		Peer:         "nginxpeer",
 		OriginalPort: 80,
@@ -115,7 +120,7 @@ func TestExposerWithdraw(t *testing.T) {
 	exposer.managedResources = []managedK8sResource{rsc1, rsc2}
 
 	// when
-	err := exposer.Withdraw(apps.App{})
+	err := exposer.Withdraw(context.Background(), apps.App{})
 
 	// then
 	assert.NoError(t, err)
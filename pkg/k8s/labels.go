@@ -4,6 +4,8 @@ import (
 	"strings"
 
 	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // CSVToMap converts key1=v1,key2=v2 entries into flat string map
@@ -23,10 +25,24 @@ const exposedByLabel = "wormhole.glothriel.github.com/exposed-by"
 const exposedAppLabel = "wormhole.glothriel.github.com/exposed-app"
 const exposedPeerLabel = "wormhole.glothriel.github.com/exposed-peer"
 
+// resourceLabels returns labels for the kubernetes resources created for given app. Labels
+// requested by the exposing peer (wormhole.glothriel.github.com/labels annotation) are included,
+// but they cannot override the ones used by wormhole to manage the resources.
 func resourceLabels(app apps.App) map[string]string {
-	return map[string]string{
-		exposedByLabel:   "wormhole",
-		exposedAppLabel:  app.Name,
-		exposedPeerLabel: app.Peer,
+	labels := map[string]string{}
+	for key, value := range CSVToMap(app.TargetLabels) {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			logrus.Warnf("Ignoring invalid label key `%s` of app %s.%s: %s", key, app.Peer, app.Name, errs[0])
+			continue
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			logrus.Warnf("Ignoring invalid label value `%s` of app %s.%s: %s", value, app.Peer, app.Name, errs[0])
+			continue
+		}
+		labels[key] = value
 	}
+	labels[exposedByLabel] = "wormhole"
+	labels[exposedAppLabel] = app.Name
+	labels[exposedPeerLabel] = app.Peer
+	return labels
 }
@@ -3,6 +3,7 @@ package k8s
 import (
 	"testing"
 
+	"github.com/glothriel/wormhole/pkg/apps"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,3 +42,51 @@ func TestCSVToMap(t *testing.T) {
 		})
 	}
 }
+
+func TestResourceLabels(t *testing.T) {
+	cases := []struct {
+		name     string
+		app      apps.App
+		expected map[string]string
+	}{
+		{
+			name: "no target labels",
+			app:  apps.App{Name: "nginx", Peer: "client1"},
+			expected: map[string]string{
+				exposedByLabel:   "wormhole",
+				exposedAppLabel:  "nginx",
+				exposedPeerLabel: "client1",
+			},
+		},
+		{
+			name: "target labels",
+			app:  apps.App{Name: "nginx", Peer: "client1", TargetLabels: "team=platform,app.kubernetes.io/name=nginx"},
+			expected: map[string]string{
+				exposedByLabel:           "wormhole",
+				exposedAppLabel:          "nginx",
+				exposedPeerLabel:         "client1",
+				"team":                   "platform",
+				"app.kubernetes.io/name": "nginx",
+			},
+		},
+		{
+			name: "invalid and overriding target labels",
+			app: apps.App{
+				Name:         "nginx",
+				Peer:         "client1",
+				TargetLabels: "in valid=value,team=in valid," + exposedPeerLabel + "=client2",
+			},
+			expected: map[string]string{
+				exposedByLabel:   "wormhole",
+				exposedAppLabel:  "nginx",
+				exposedPeerLabel: "client1",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, resourceLabels(tc.app))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderLabel marks the pod of the elected leader, so the services can select only it
+const LeaderLabel = "wormhole.glothriel.github.com/leader"
+
+const (
+	leaseDuration      = 15 * time.Second
+	leaseRenewDeadline = 10 * time.Second
+	leaseRetryPeriod   = 2 * time.Second
+	unlabelTimeout     = 5 * time.Second
+)
+
+// LeaderElection allows running a single active replica of the server. The replicas compete
+// for a Lease, the one holding it labels its pod with LeaderLabel and runs the server, the
+// others stand by.
+type LeaderElection struct {
+	namespace string
+	lease     string
+	pod       string
+	client    kubernetes.Interface
+}
+
+// Run blocks until the replica is elected and then runs the function, until it returns. The
+// context passed to the function is done when the given one is, or the leadership is lost,
+// in the latter case an error is returned. The lease is released after the function returns,
+// so one of the standby replicas takes over immediately.
+func (e *LeaderElection) Run(ctx context.Context, run func(context.Context) error) error {
+	// The label could survive a restart of the container
+	if unlabelErr := e.label(ctx, false); unlabelErr != nil {
+		return unlabelErr
+	}
+	electorCtx, stopElector := context.WithCancel(context.Background())
+	defer stopElector()
+	acquired := make(chan context.Context, 1)
+	elector, electorErr := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: e.lease, Namespace: e.namespace},
+			Client:     e.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: e.pod},
+		},
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   leaseRenewDeadline,
+		RetryPeriod:     leaseRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            e.lease,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				acquired <- leaderCtx
+			},
+			OnStoppedLeading: func() {
+				metrics.Leader.Set(0)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != e.pod {
+					logrus.Infof("Standing by, %s is the leader", identity)
+				}
+			},
+		},
+	})
+	if electorErr != nil {
+		return fmt.Errorf("failed to set up leader election: %w", electorErr)
+	}
+	electorDone := make(chan struct{})
+	go func() {
+		defer close(electorDone)
+		elector.Run(electorCtx)
+	}()
+	logrus.Infof("Waiting for the leadership of lease %s/%s", e.namespace, e.lease)
+	select {
+	case <-ctx.Done():
+		stopElector()
+		<-electorDone
+		return nil
+	case leaderCtx := <-acquired:
+		runErr := e.lead(ctx, leaderCtx, run)
+		stopElector()
+		<-electorDone
+		return runErr
+	}
+}
+
+// lead runs the function while the replica holds the leadership
+func (e *LeaderElection) lead(ctx, leaderCtx context.Context, run func(context.Context) error) error {
+	logrus.Infof("Became the leader of lease %s/%s", e.namespace, e.lease)
+	metrics.Leader.Set(1)
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	stopWatching := context.AfterFunc(leaderCtx, cancelRun)
+	defer stopWatching()
+
+	var runErr error
+	if labelErr := e.label(runCtx, true); labelErr != nil {
+		runErr = labelErr
+	} else {
+		runErr = run(runCtx)
+	}
+	lost := leaderCtx.Err() != nil
+	unlabelCtx, cancelUnlabel := context.WithTimeout(context.Background(), unlabelTimeout)
+	defer cancelUnlabel()
+	if unlabelErr := e.label(unlabelCtx, false); unlabelErr != nil {
+		logrus.Errorf("Failed to remove the leader label: %v", unlabelErr)
+	}
+	if runErr == nil && lost && ctx.Err() == nil {
+		return errors.New("lost the leadership")
+	}
+	return runErr
+}
+
+// label adds or removes the LeaderLabel of the pod
+func (e *LeaderElection) label(ctx context.Context, leading bool) error {
+	var value any
+	if leading {
+		value = "true"
+	}
+	patch, marshalErr := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"labels": map[string]any{LeaderLabel: value},
+		},
+	})
+	if marshalErr != nil {
+		return marshalErr
+	}
+	if _, patchErr := e.client.CoreV1().Pods(e.namespace).Patch(
+		ctx, e.pod, types.MergePatchType, patch, metav1.PatchOptions{},
+	); patchErr != nil {
+		return fmt.Errorf("failed to label pod %s/%s: %w", e.namespace, e.pod, patchErr)
+	}
+	return nil
+}
+
+// NewLeaderElection creates a new LeaderElection instance, that competes for the lease with
+// the given name. The pod is the one running this replica and identifies it in the lease.
+func NewLeaderElection(namespace, lease, pod string) (*LeaderElection, error) {
+	clientset, clientSetErr := fromInClusterConfigClientProvider{}.New()
+	if clientSetErr != nil {
+		return nil, clientSetErr
+	}
+	return &LeaderElection{
+		namespace: namespace,
+		lease:     lease,
+		pod:       pod,
+		client:    clientset,
+	}, nil
+}
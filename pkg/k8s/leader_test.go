@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLeaderElection(objects ...runtime.Object) *LeaderElection {
+	objects = append(objects, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "server-0",
+		Namespace: "wormhole",
+		Labels:    map[string]string{LeaderLabel: "true"},
+	}})
+	return &LeaderElection{
+		namespace: "wormhole",
+		lease:     "wormhole-server",
+		pod:       "server-0",
+		client:    fake.NewSimpleClientset(objects...),
+	}
+}
+
+func podLabels(t *testing.T, e *LeaderElection) map[string]string {
+	pod, getErr := e.client.CoreV1().Pods(e.namespace).Get(context.Background(), e.pod, metav1.GetOptions{})
+	assert.NoError(t, getErr)
+	return pod.Labels
+}
+
+func TestLeaderElectionRunsTheLeader(t *testing.T) {
+	// given
+	election := newTestLeaderElection()
+	var labelsWhileLeading map[string]string
+
+	// when
+	runErr := election.Run(context.Background(), func(_ context.Context) error {
+		labelsWhileLeading = podLabels(t, election)
+		return nil
+	})
+
+	// then
+	assert.NoError(t, runErr)
+	assert.Equal(t, map[string]string{LeaderLabel: "true"}, labelsWhileLeading)
+	assert.Empty(t, podLabels(t, election))
+	lease, getErr := election.client.CoordinationV1().Leases("wormhole").Get(
+		context.Background(), "wormhole-server", metav1.GetOptions{},
+	)
+	assert.NoError(t, getErr)
+	assert.Empty(t, *lease.Spec.HolderIdentity, "the lease should be released")
+}
+
+func TestLeaderElectionStandsByWhileTheLeaseIsHeld(t *testing.T) {
+	// given
+	holder, duration := "server-1", int32(60)
+	election := newTestLeaderElection(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "wormhole-server", Namespace: "wormhole"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &metav1.MicroTime{Time: time.Now()},
+			RenewTime:            &metav1.MicroTime{Time: time.Now()},
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	ran := false
+
+	// when
+	runErr := election.Run(ctx, func(_ context.Context) error {
+		ran = true
+		return nil
+	})
+
+	// then
+	assert.NoError(t, runErr)
+	assert.False(t, ran)
+	assert.Empty(t, podLabels(t, election), "a stale leader label should be removed")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/glothriel/wormhole/pkg/apps"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
@@ -20,7 +21,13 @@ type managedK8sNetworkPolicy struct {
 
 const consumesNpLabel = "wormhole.glothriel.github.com/network-policy-consumes-app"
 
-func (m *managedK8sNetworkPolicy) Add(metadata k8sResourceMetadata, clientset *kubernetes.Clientset) error {
+func (m *managedK8sNetworkPolicy) Kind() string {
+	return "network_policy"
+}
+
+func (m *managedK8sNetworkPolicy) Add(
+	ctx context.Context, metadata k8sResourceMetadata, clientset *kubernetes.Clientset,
+) error {
 	networkPoliciesClient := clientset.NetworkingV1().NetworkPolicies(m.namespace)
 	port, portErr := extractPortFromAddr(metadata.afterExposedApp.Address)
 	if portErr != nil {
@@ -28,16 +35,16 @@ func (m *managedK8sNetworkPolicy) Add(metadata k8sResourceMetadata, clientset *k
 	}
 	np := m.npDefinition(port, metadata)
 	var upsertErr error
-	previousNP, getErr := networkPoliciesClient.Get(context.Background(), metadata.entityName, metav1.GetOptions{})
+	previousNP, getErr := networkPoliciesClient.Get(ctx, metadata.entityName, metav1.GetOptions{})
 	if errors.IsNotFound(getErr) {
 		logrus.Infof("Creating network policy %s", metadata.entityName)
-		_, upsertErr = networkPoliciesClient.Create(context.Background(), np, metav1.CreateOptions{})
+		_, upsertErr = networkPoliciesClient.Create(ctx, np, metav1.CreateOptions{})
 	} else if getErr != nil {
 		return getErr
 	} else {
 		logrus.Infof("Updating network policy %s", metadata.entityName)
 		np.SetResourceVersion(previousNP.GetResourceVersion())
-		_, upsertErr = networkPoliciesClient.Update(context.Background(), np, metav1.UpdateOptions{})
+		_, upsertErr = networkPoliciesClient.Update(ctx, np, metav1.UpdateOptions{})
 	}
 	if upsertErr != nil {
 		return upsertErr
@@ -46,7 +53,7 @@ func (m *managedK8sNetworkPolicy) Add(metadata k8sResourceMetadata, clientset *k
 }
 
 func (m *managedK8sNetworkPolicy) npDefinition(port int, metadata k8sResourceMetadata) *networkingv1.NetworkPolicy {
-	protoTCP := v1.ProtocolTCP
+	protocol := v1.Protocol(apps.ProtocolOf(metadata.originalApp))
 	convertedPort := intstr.FromInt(port)
 
 	return &networkingv1.NetworkPolicy{
@@ -63,7 +70,7 @@ func (m *managedK8sNetworkPolicy) npDefinition(port int, metadata k8sResourceMet
 				{
 					Ports: []networkingv1.NetworkPolicyPort{
 						{
-							Protocol: &protoTCP,
+							Protocol: &protocol,
 							Port:     &convertedPort,
 						},
 					},
@@ -83,9 +90,11 @@ func (m *managedK8sNetworkPolicy) npDefinition(port int, metadata k8sResourceMet
 	}
 }
 
-func (m *managedK8sNetworkPolicy) Remove(entityName string, clientset *kubernetes.Clientset) error {
+func (m *managedK8sNetworkPolicy) Remove(
+	ctx context.Context, entityName string, clientset *kubernetes.Clientset,
+) error {
 	networkPoliciesClient := clientset.NetworkingV1().NetworkPolicies(m.namespace)
-	deleteErr := networkPoliciesClient.Delete(context.Background(), entityName, metav1.DeleteOptions{})
+	deleteErr := networkPoliciesClient.Delete(ctx, entityName, metav1.DeleteOptions{})
 	if deleteErr != nil {
 		return fmt.Errorf("Could not delete network policy %s: %v", entityName, deleteErr)
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/glothriel/wormhole/pkg/apps"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -12,12 +13,20 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
+var preferDualStack = corev1.IPFamilyPolicyPreferDualStack
+
 type managedK8sService struct {
 	namespace string
 	selectors map[string]string
 }
 
-func (m *managedK8sService) Add(metadata k8sResourceMetadata, clientset *kubernetes.Clientset) error {
+func (m *managedK8sService) Kind() string {
+	return "service"
+}
+
+func (m *managedK8sService) Add(
+	ctx context.Context, metadata k8sResourceMetadata, clientset *kubernetes.Clientset,
+) error {
 	servicesClient := clientset.CoreV1().Services(m.namespace)
 
 	port, portErr := extractPortFromAddr(metadata.afterExposedApp.Address)
@@ -34,21 +43,25 @@ func (m *managedK8sService) Add(metadata k8sResourceMetadata, clientset *kuberne
 			Ports: []corev1.ServicePort{{
 				Port:       metadata.originalApp.OriginalPort,
 				TargetPort: intstr.FromInt(port),
+				Protocol:   corev1.Protocol(apps.ProtocolOf(metadata.originalApp)),
 			}},
 			Selector: m.selectors,
+			// Lets the cluster assign the addresses of all the families it supports, so the
+			// services work in IPv4, IPv6 and dual-stack clusters alike
+			IPFamilyPolicy: &preferDualStack,
 		},
 	}
 	var upsertErr error
-	previousService, getErr := servicesClient.Get(context.Background(), metadata.entityName, metav1.GetOptions{})
+	previousService, getErr := servicesClient.Get(ctx, metadata.entityName, metav1.GetOptions{})
 	if errors.IsNotFound(getErr) {
 		logrus.Infof("Creating service %s", metadata.entityName)
-		_, upsertErr = servicesClient.Create(context.Background(), service, metav1.CreateOptions{})
+		_, upsertErr = servicesClient.Create(ctx, service, metav1.CreateOptions{})
 	} else if getErr != nil {
 		return getErr
 	} else {
 		logrus.Infof("Updating service %s", metadata.entityName)
 		service.SetResourceVersion(previousService.GetResourceVersion())
-		_, upsertErr = servicesClient.Update(context.Background(), service, metav1.UpdateOptions{})
+		_, upsertErr = servicesClient.Update(ctx, service, metav1.UpdateOptions{})
 	}
 	if upsertErr != nil {
 		return upsertErr
@@ -56,9 +69,9 @@ func (m *managedK8sService) Add(metadata k8sResourceMetadata, clientset *kuberne
 	return nil
 }
 
-func (m *managedK8sService) Remove(entityName string, clientset *kubernetes.Clientset) error {
+func (m *managedK8sService) Remove(ctx context.Context, entityName string, clientset *kubernetes.Clientset) error {
 	servicesClient := clientset.CoreV1().Services(m.namespace)
-	deleteErr := servicesClient.Delete(context.Background(), capName(
+	deleteErr := servicesClient.Delete(ctx, capName(
 		entityName,
 	), metav1.DeleteOptions{})
 	if deleteErr != nil {
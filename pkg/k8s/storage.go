@@ -0,0 +1,407 @@
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/glothriel/wormhole/pkg/syncing"
+	"github.com/glothriel/wormhole/pkg/wg"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const storageLabel = "wormhole.glothriel.github.com/storage"
+const storageBucketLabel = "wormhole.glothriel.github.com/storage-bucket"
+const storageKeyAnnotation = "wormhole.glothriel.github.com/storage-key"
+const storageValueKey = "value"
+
+// SecretStorage keeps the state of wormhole in Kubernetes Secrets, so it needs no persistent
+// volume and survives rescheduling of the pod to another node. Every entry, like a peer or the
+// key pair, is stored in a separate Secret labeled with the prefix and the bucket it belongs to.
+type SecretStorage struct {
+	namespace string
+	prefix    string
+	client    kubernetes.Interface
+}
+
+func (s *SecretStorage) bucket(name string) *secretBucket {
+	return &secretBucket{storage: s, name: name}
+}
+
+// Peers returns the PeerStorage backed by the Secrets
+func (s *SecretStorage) Peers() pairing.PeerStorage {
+	return &secretPeerStorage{bucket: s.bucket("peers")}
+}
+
+// Invites returns the InviteStorage backed by the Secrets
+func (s *SecretStorage) Invites() pairing.InviteStorage {
+	return &secretInviteStorage{bucket: s.bucket("invites")}
+}
+
+// IPReservations returns the IPReservationStorage backed by the Secrets
+func (s *SecretStorage) IPReservations() pairing.IPReservationStorage {
+	return &secretIPReservationStorage{bucket: s.bucket("reservations")}
+}
+
+// Keys returns the Wireguard KeyStorage backed by the Secrets
+func (s *SecretStorage) Keys() wg.KeyStorage {
+	return &secretKeyStorage{bucket: s.bucket("keys")}
+}
+
+// Metadata returns the MetadataStorage of the peers backed by the Secrets
+func (s *SecretStorage) Metadata() syncing.MetadataStorage {
+	return &secretMetadataStorage{bucket: s.bucket("metadata")}
+}
+
+// PairingCache returns the KeyCachingPairingClientStorage backed by the Secrets
+func (s *SecretStorage) PairingCache() pairing.KeyCachingPairingClientStorage {
+	return &secretPairingCacheStorage{bucket: s.bucket("pairing")}
+}
+
+// NewSecretStorage creates a new SecretStorage, that keeps the Secrets in the given namespace.
+// The names of the Secrets start with the prefix, which has to be a valid DNS label.
+func NewSecretStorage(namespace, prefix string) (*SecretStorage, error) {
+	if errs := validation.IsDNS1123Label(prefix); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid storage prefix %s: %s", prefix, errs[0])
+	}
+	clientset, clientSetErr := fromInClusterConfigClientProvider{}.New()
+	if clientSetErr != nil {
+		return nil, clientSetErr
+	}
+	return &SecretStorage{
+		namespace: namespace,
+		prefix:    prefix,
+		client:    clientset,
+	}, nil
+}
+
+// secretBucket stores the values under arbitrary keys, the Secret names are derived from
+// the hashes of the keys, which are kept in the annotations
+type secretBucket struct {
+	storage *SecretStorage
+	name    string
+}
+
+func (b *secretBucket) secrets() corev1.SecretInterface {
+	return b.storage.client.CoreV1().Secrets(b.storage.namespace)
+}
+
+func (b *secretBucket) secretName(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("%s-%s-%s", b.storage.prefix, b.name, hex.EncodeToString(hash[:])[:16])
+}
+
+// get returns the value stored under the key, or nil if there is none
+func (b *secretBucket) get(key string) ([]byte, error) {
+	secret, getErr := b.secrets().Get(context.Background(), b.secretName(key), metav1.GetOptions{})
+	if errors.IsNotFound(getErr) {
+		return nil, nil
+	} else if getErr != nil {
+		return nil, fmt.Errorf("failed to get %s from storage: %w", key, getErr)
+	}
+	return secret.Data[storageValueKey], nil
+}
+
+func (b *secretBucket) put(key string, value []byte) error {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      b.secretName(key),
+			Namespace: b.storage.namespace,
+			Labels: map[string]string{
+				storageLabel:       b.storage.prefix,
+				storageBucketLabel: b.name,
+			},
+			Annotations: map[string]string{storageKeyAnnotation: key},
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: map[string][]byte{storageValueKey: value},
+	}
+	var upsertErr error
+	previousSecret, getErr := b.secrets().Get(context.Background(), secret.Name, metav1.GetOptions{})
+	if errors.IsNotFound(getErr) {
+		_, upsertErr = b.secrets().Create(context.Background(), secret, metav1.CreateOptions{})
+	} else if getErr != nil {
+		upsertErr = getErr
+	} else {
+		secret.SetResourceVersion(previousSecret.GetResourceVersion())
+		_, upsertErr = b.secrets().Update(context.Background(), secret, metav1.UpdateOptions{})
+	}
+	if upsertErr != nil {
+		return fmt.Errorf("failed to store %s: %w", key, upsertErr)
+	}
+	return nil
+}
+
+func (b *secretBucket) delete(key string) error {
+	deleteErr := b.secrets().Delete(context.Background(), b.secretName(key), metav1.DeleteOptions{})
+	if deleteErr != nil && !errors.IsNotFound(deleteErr) {
+		return fmt.Errorf("failed to delete %s from storage: %w", key, deleteErr)
+	}
+	return nil
+}
+
+// list returns all the values in the bucket mapped to their keys
+func (b *secretBucket) list() (map[string][]byte, error) {
+	secrets, listErr := b.secrets().List(context.Background(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			storageLabel:       b.storage.prefix,
+			storageBucketLabel: b.name,
+		}).String(),
+	})
+	if listErr != nil {
+		return nil, fmt.Errorf("failed to list %s from storage: %w", b.name, listErr)
+	}
+	values := make(map[string][]byte, len(secrets.Items))
+	for _, secret := range secrets.Items {
+		values[secret.Annotations[storageKeyAnnotation]] = secret.Data[storageValueKey]
+	}
+	return values, nil
+}
+
+func (b *secretBucket) putJSON(key string, value any) error {
+	encoded, encodeErr := json.Marshal(value)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	return b.put(key, encoded)
+}
+
+type secretPeerStorage struct {
+	bucket *secretBucket
+}
+
+func (s *secretPeerStorage) Store(peer pairing.PeerInfo) error {
+	return s.bucket.putJSON(peer.Name, peer)
+}
+
+func (s *secretPeerStorage) GetByName(name string) (pairing.PeerInfo, error) {
+	var peer pairing.PeerInfo
+	payload, getErr := s.bucket.get(name)
+	if getErr != nil {
+		return peer, getErr
+	}
+	if payload == nil {
+		return peer, pairing.ErrPeerDoesNotExist
+	}
+	return peer, json.Unmarshal(payload, &peer)
+}
+
+func (s *secretPeerStorage) List() ([]pairing.PeerInfo, error) {
+	payloads, listErr := s.bucket.list()
+	if listErr != nil {
+		return nil, listErr
+	}
+	var peers []pairing.PeerInfo
+	for _, payload := range payloads {
+		var peer pairing.PeerInfo
+		if err := json.Unmarshal(payload, &peer); err != nil {
+			return nil, err
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+func (s *secretPeerStorage) DeleteByName(name string) error {
+	return s.bucket.delete(name)
+}
+
+type secretInviteStorage struct {
+	bucket *secretBucket
+}
+
+func (s *secretInviteStorage) Store(invite pairing.Invite) error {
+	return s.bucket.putJSON(invite.Name, invite)
+}
+
+func (s *secretInviteStorage) GetByName(name string) (pairing.Invite, error) {
+	var invite pairing.Invite
+	payload, getErr := s.bucket.get(name)
+	if getErr != nil {
+		return invite, getErr
+	}
+	if payload == nil {
+		return invite, pairing.ErrInviteDoesNotExist
+	}
+	return invite, json.Unmarshal(payload, &invite)
+}
+
+func (s *secretInviteStorage) List() ([]pairing.Invite, error) {
+	payloads, listErr := s.bucket.list()
+	if listErr != nil {
+		return nil, listErr
+	}
+	var invites []pairing.Invite
+	for _, payload := range payloads {
+		var invite pairing.Invite
+		if err := json.Unmarshal(payload, &invite); err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, nil
+}
+
+func (s *secretInviteStorage) DeleteByName(name string) error {
+	return s.bucket.delete(name)
+}
+
+type secretIPReservationStorage struct {
+	bucket *secretBucket
+}
+
+func (s *secretIPReservationStorage) Store(reservation pairing.IPReservation) error {
+	return s.bucket.putJSON(reservation.Name, reservation)
+}
+
+func (s *secretIPReservationStorage) GetByName(name string) (pairing.IPReservation, error) {
+	var reservation pairing.IPReservation
+	payload, getErr := s.bucket.get(name)
+	if getErr != nil {
+		return reservation, getErr
+	}
+	if payload == nil {
+		return reservation, pairing.ErrIPReservationDoesNotExist
+	}
+	return reservation, json.Unmarshal(payload, &reservation)
+}
+
+func (s *secretIPReservationStorage) List() ([]pairing.IPReservation, error) {
+	payloads, listErr := s.bucket.list()
+	if listErr != nil {
+		return nil, listErr
+	}
+	var reservations []pairing.IPReservation
+	for _, payload := range payloads {
+		var reservation pairing.IPReservation
+		if err := json.Unmarshal(payload, &reservation); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+	return reservations, nil
+}
+
+func (s *secretIPReservationStorage) DeleteByName(name string) error {
+	return s.bucket.delete(name)
+}
+
+type secretKeyPair struct {
+	Private  string    `json:"private"`
+	Public   string    `json:"public"`
+	SwitchAt time.Time `json:"switch_at"`
+}
+
+type secretKeyStorage struct {
+	bucket *secretBucket
+}
+
+func (s *secretKeyStorage) Store(private, public string) error {
+	return s.bucket.putJSON("wireguard", secretKeyPair{Private: private, Public: public})
+}
+
+func (s *secretKeyStorage) Load() (private, public string, err error) {
+	payload, getErr := s.bucket.get("wireguard")
+	if getErr != nil {
+		return "", "", getErr
+	}
+	var keyPair secretKeyPair
+	if payload != nil {
+		if unmarshalErr := json.Unmarshal(payload, &keyPair); unmarshalErr != nil {
+			return "", "", unmarshalErr
+		}
+	}
+	if keyPair.Private == "" || keyPair.Public == "" {
+		return "", "", fmt.Errorf("no keys stored")
+	}
+	return keyPair.Private, keyPair.Public, nil
+}
+
+func (s *secretKeyStorage) StorePending(private, public string, switchAt time.Time) error {
+	return s.bucket.putJSON("wireguard-pending", secretKeyPair{Private: private, Public: public, SwitchAt: switchAt})
+}
+
+func (s *secretKeyStorage) LoadPending() (private, public string, switchAt time.Time, err error) {
+	payload, getErr := s.bucket.get("wireguard-pending")
+	if getErr != nil {
+		return "", "", time.Time{}, getErr
+	}
+	if payload == nil {
+		return "", "", time.Time{}, wg.ErrNoPendingKeyPair
+	}
+	var keyPair secretKeyPair
+	if unmarshalErr := json.Unmarshal(payload, &keyPair); unmarshalErr != nil {
+		return "", "", time.Time{}, unmarshalErr
+	}
+	return keyPair.Private, keyPair.Public, keyPair.SwitchAt, nil
+}
+
+func (s *secretKeyStorage) ClearPending() error {
+	return s.bucket.delete("wireguard-pending")
+}
+
+type secretMetadataStorage struct {
+	bucket *secretBucket
+}
+
+func (s *secretMetadataStorage) List() ([]syncing.MetadataListItem, error) {
+	payloads, listErr := s.bucket.list()
+	if listErr != nil {
+		return nil, listErr
+	}
+	var items []syncing.MetadataListItem
+	for peer, payload := range payloads {
+		var metadata syncing.Metadata
+		if err := json.Unmarshal(payload, &metadata); err != nil {
+			return nil, err
+		}
+		items = append(items, syncing.MetadataListItem{Peer: peer, Metadata: metadata})
+	}
+	return items, nil
+}
+
+func (s *secretMetadataStorage) Set(peer string, metadata syncing.Metadata) error {
+	return s.bucket.putJSON(peer, metadata)
+}
+
+func (s *secretMetadataStorage) Get(peer string) (syncing.Metadata, error) {
+	payload, getErr := s.bucket.get(peer)
+	if getErr != nil {
+		return nil, getErr
+	}
+	if payload == nil {
+		return nil, syncing.ErrPeerNotFound
+	}
+	var metadata syncing.Metadata
+	return metadata, json.Unmarshal(payload, &metadata)
+}
+
+type secretPairingCacheStorage struct {
+	bucket *secretBucket
+}
+
+func (s *secretPairingCacheStorage) Get() (pairing.Response, error) {
+	var response pairing.Response
+	payload, getErr := s.bucket.get("response")
+	if getErr != nil {
+		return response, getErr
+	}
+	if payload == nil {
+		return response, fmt.Errorf("response does not exist")
+	}
+	return response, json.Unmarshal(payload, &response)
+}
+
+func (s *secretPairingCacheStorage) Set(response pairing.Response) error {
+	return s.bucket.putJSON("response", response)
+}
@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/glothriel/wormhole/pkg/syncing"
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestSecretStorage() *SecretStorage {
+	return &SecretStorage{
+		namespace: "wormhole",
+		prefix:    "wormhole-server",
+		client:    fake.NewSimpleClientset(),
+	}
+}
+
+func TestSecretPeerStorage(t *testing.T) {
+	// given
+	storage := newTestSecretStorage()
+	peers := storage.Peers()
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client1", IP: "10.188.0.2"}))
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client2", IP: "10.188.0.3"}))
+
+	// when
+	updateErr := peers.Store(pairing.PeerInfo{Name: "client1", IP: "10.188.0.4"})
+	deleteErr := peers.DeleteByName("client2")
+
+	// then
+	assert.NoError(t, updateErr)
+	assert.NoError(t, deleteErr)
+	peer, getErr := peers.GetByName("client1")
+	assert.NoError(t, getErr)
+	assert.Equal(t, "10.188.0.4", peer.IP)
+	_, missingErr := peers.GetByName("client2")
+	assert.ErrorIs(t, missingErr, pairing.ErrPeerDoesNotExist)
+	listed, listErr := peers.List()
+	assert.NoError(t, listErr)
+	assert.Equal(t, []pairing.PeerInfo{{Name: "client1", IP: "10.188.0.4"}}, listed)
+}
+
+func TestSecretStorageKeepsBucketsApart(t *testing.T) {
+	// given
+	storage := newTestSecretStorage()
+	assert.NoError(t, storage.Peers().Store(pairing.PeerInfo{Name: "client1"}))
+	assert.NoError(t, storage.IPReservations().Store(pairing.IPReservation{Name: "client1", IP: "10.188.0.9"}))
+
+	// when
+	peers, peersErr := storage.Peers().List()
+	reservations, reservationsErr := storage.IPReservations().List()
+
+	// then
+	assert.NoError(t, peersErr)
+	assert.NoError(t, reservationsErr)
+	assert.Equal(t, []pairing.PeerInfo{{Name: "client1"}}, peers)
+	assert.Equal(t, []pairing.IPReservation{{Name: "client1", IP: "10.188.0.9"}}, reservations)
+	secrets, listErr := storage.client.CoreV1().Secrets("wormhole").List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, listErr)
+	assert.Len(t, secrets.Items, 2)
+	for _, secret := range secrets.Items {
+		assert.Equal(t, "client1", secret.Annotations[storageKeyAnnotation])
+		assert.Equal(t, "wormhole-server", secret.Labels[storageLabel])
+	}
+}
+
+func TestSecretKeyStorage(t *testing.T) {
+	// given
+	keys := newTestSecretStorage().Keys()
+	_, _, emptyErr := keys.Load()
+
+	// when
+	storeErr := keys.Store("private", "public")
+
+	// then
+	assert.Error(t, emptyErr)
+	assert.NoError(t, storeErr)
+	private, public, loadErr := keys.Load()
+	assert.NoError(t, loadErr)
+	assert.Equal(t, "private", private)
+	assert.Equal(t, "public", public)
+}
+
+func TestSecretKeyStoragePendingKeyPair(t *testing.T) {
+	// given
+	keys := newTestSecretStorage().Keys()
+	switchAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	_, _, _, emptyErr := keys.LoadPending()
+
+	// when
+	storeErr := keys.StorePending("private", "public", switchAt)
+	private, public, loadedSwitchAt, loadErr := keys.LoadPending()
+	clearErr := keys.ClearPending()
+
+	// then
+	assert.Equal(t, wg.ErrNoPendingKeyPair, emptyErr)
+	assert.NoError(t, storeErr)
+	assert.NoError(t, loadErr)
+	assert.Equal(t, "private", private)
+	assert.Equal(t, "public", public)
+	assert.True(t, switchAt.Equal(loadedSwitchAt))
+	assert.NoError(t, clearErr)
+	_, _, _, clearedErr := keys.LoadPending()
+	assert.Equal(t, wg.ErrNoPendingKeyPair, clearedErr)
+}
+
+func TestSecretMetadataStorage(t *testing.T) {
+	// given
+	metadata := newTestSecretStorage().Metadata()
+	_, missingErr := metadata.Get("client1")
+
+	// when
+	setErr := metadata.Set("client1", syncing.Metadata{"owner": "team-a"})
+
+	// then
+	assert.ErrorIs(t, missingErr, syncing.ErrPeerNotFound)
+	assert.NoError(t, setErr)
+	stored, getErr := metadata.Get("client1")
+	assert.NoError(t, getErr)
+	assert.Equal(t, syncing.Metadata{"owner": "team-a"}, stored)
+	listed, listErr := metadata.List()
+	assert.NoError(t, listErr)
+	assert.Equal(t, []syncing.MetadataListItem{{Peer: "client1", Metadata: syncing.Metadata{"owner": "team-a"}}}, listed)
+}
+
+func TestNewSecretStorageRejectsInvalidPrefix(t *testing.T) {
+	// when
+	_, storageErr := NewSecretStorage("wormhole", "Wormhole_Server")
+
+	// then
+	assert.Error(t, storageErr)
+}
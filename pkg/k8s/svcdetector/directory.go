@@ -1,6 +1,7 @@
 package svcdetector
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -38,15 +39,25 @@ func parseAppFromPath(fs afero.Fs, path string) (apps.App, error) {
 		Peer:         app.Peer,
 		OriginalPort: app.OriginalPort,
 		TargetLabels: app.TargetLabels,
+		AllowedPeers: app.AllowedPeers,
+		Protocol:     app.Protocol,
 	}, nil
 }
 
-// NewDirectoryMonitoringAppStateManager is used for integration testing
-func NewDirectoryMonitoringAppStateManager(location string, fs afero.Fs) AppStateManager { // nolint: gocognit
+// NewDirectoryMonitoringAppStateManager is used for integration testing. The directory is
+// monitored until the context is done.
+func NewDirectoryMonitoringAppStateManager( // nolint: gocognit
+	ctx context.Context, location string, fs afero.Fs,
+) AppStateManager {
 	changesChan := make(chan AppStateChange)
+	send := func(change AppStateChange) {
+		select {
+		case changesChan <- change:
+		case <-ctx.Done():
+		}
+	}
 	lastReadFiles := make(map[string]apps.App)
 	ticker := time.NewTicker(5 * time.Second)
-	quit := make(chan struct{})
 	go func() {
 		for {
 			select {
@@ -69,29 +80,29 @@ func NewDirectoryMonitoringAppStateManager(location string, fs afero.Fs) AppStat
 
 				for file := range files {
 					if _, ok := lastReadFiles[file]; !ok {
-						changesChan <- AppStateChange{
+						send(AppStateChange{
 							App: apps.App{
 								Name:    file,
 								Address: file,
 							},
 							State: AppStateChangeAdded,
-						}
+						})
 					}
 				}
 
 				for file := range lastReadFiles {
 					if _, ok := files[file]; !ok {
-						changesChan <- AppStateChange{
+						send(AppStateChange{
 							App: apps.App{
 								Name:    file,
 								Address: file,
 							},
 							State: AppStateChangeWithdrawn,
-						}
+						})
 					}
 				}
 
-			case <-quit:
+			case <-ctx.Done():
 				ticker.Stop()
 				return
 			}
@@ -1,5 +1,7 @@
 package svcdetector
 
+import "context"
+
 type exposedServicesNotifier struct {
 	createUpdateChan chan serviceWrapper
 	deleteChan       chan serviceWrapper
@@ -13,17 +15,33 @@ func (notifier *exposedServicesNotifier) deletedServices() chan serviceWrapper {
 	return notifier.deleteChan
 }
 
-func newExposedServicesNotifier(repository ServiceRepository) *exposedServicesNotifier {
+func newExposedServicesNotifier(ctx context.Context, repository ServiceRepository) *exposedServicesNotifier {
 	theNotifier := &exposedServicesNotifier{
 		createUpdateChan: make(chan serviceWrapper),
 		deleteChan:       make(chan serviceWrapper),
 	}
 	go func() {
-		for event := range repository.watch() {
-			if event.isAddedOrModified() {
-				theNotifier.createUpdateChan <- event.service
-			} else if event.isDeleted() {
-				theNotifier.deleteChan <- event.service
+		events := repository.watch(ctx)
+		for {
+			var event watchEvent
+			select {
+			case event = <-events:
+			case <-ctx.Done():
+				return
+			}
+			var target chan serviceWrapper
+			switch {
+			case event.isAddedOrModified():
+				target = theNotifier.createUpdateChan
+			case event.isDeleted():
+				target = theNotifier.deleteChan
+			default:
+				continue
+			}
+			select {
+			case target <- event.service:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
@@ -1,6 +1,7 @@
 package svcdetector
 
 import (
+	"slices"
 	"sync"
 
 	"github.com/glothriel/wormhole/pkg/apps"
@@ -9,6 +10,7 @@ import (
 type exposedServicesRegistry interface {
 	all() []registryItem
 	isExposed(app apps.App, svcParser serviceWrapper) bool
+	outdated(app apps.App, svcParser serviceWrapper) []apps.App
 	markAsExposed(app apps.App, svcParser serviceWrapper)
 	markAsWithdrawn(app apps.App, svcParser serviceWrapper)
 }
@@ -42,13 +44,31 @@ func (registry *defaultExposedServicesRegistry) isExposed(app apps.App, service
 	}
 
 	for _, exposedApp := range item.apps {
-		if exposedApp.Name == app.Name && exposedApp.Address == app.Address {
+		if exposedApp.Name == app.Name && exposedApp.Address == app.Address &&
+			slices.Equal(exposedApp.AllowedPeers, app.AllowedPeers) {
 			return true
 		}
 	}
 	return false
 }
 
+// outdated returns exposed apps with the same name as given app, that differ from it
+func (registry *defaultExposedServicesRegistry) outdated(app apps.App, service serviceWrapper) []apps.App {
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+	item, ok := registry.registryMap[service.id()]
+	if !ok {
+		return nil
+	}
+	outdatedApps := []apps.App{}
+	for _, exposedApp := range item.apps {
+		if exposedApp.Name == app.Name {
+			outdatedApps = append(outdatedApps, exposedApp)
+		}
+	}
+	return outdatedApps
+}
+
 func (registry *defaultExposedServicesRegistry) markAsExposed(app apps.App, service serviceWrapper) {
 	registry.mtx.Lock()
 	defer registry.mtx.Unlock()
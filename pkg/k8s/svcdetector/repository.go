@@ -3,8 +3,6 @@ package svcdetector
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/signal"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -27,7 +25,8 @@ const (
 // ServiceRepository allows quering k8s server for services
 type ServiceRepository interface {
 	list() ([]serviceWrapper, error)
-	watch() chan watchEvent
+	// watch streams the changes of the services until the context is done
+	watch(ctx context.Context) chan watchEvent
 }
 
 type watchEvent struct {
@@ -74,9 +73,18 @@ func (repository defaultServiceRepository) list() ([]serviceWrapper, error) {
 	return services, nil
 }
 
-func (repository defaultServiceRepository) watch() chan watchEvent {
+func (repository defaultServiceRepository) watch(ctx context.Context) chan watchEvent {
 	theChannel := make(chan watchEvent)
-	runInformerInBg(func() chan struct{} {
+	send := func(events []watchEvent) {
+		for _, event := range events {
+			select {
+			case theChannel <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	runInformerInBg(ctx, func() chan struct{} {
 		informerFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(
 			repository.client,
 			time.Second*10,
@@ -93,19 +101,13 @@ func (repository defaultServiceRepository) watch() chan watchEvent {
 		go func(stopCh <-chan struct{}, s cache.SharedIndexInformer) {
 			handlers := cache.ResourceEventHandlerFuncs{
 				AddFunc: func(obj any) {
-					for _, event := range repository.onAddedOrModified(obj) {
-						theChannel <- event
-					}
+					send(repository.onAddedOrModified(obj))
 				},
 				UpdateFunc: func(_, obj any) {
-					for _, event := range repository.onAddedOrModified(obj) {
-						theChannel <- event
-					}
+					send(repository.onAddedOrModified(obj))
 				},
 				DeleteFunc: func(obj any) {
-					for _, event := range repository.onDeleted(obj) {
-						theChannel <- event
-					}
+					send(repository.onDeleted(obj))
 				},
 			}
 			_, addEventHandlerErr := s.AddEventHandler(handlers)
@@ -151,7 +153,9 @@ func NewDefaultServiceRepository(client dynamic.Interface) ServiceRepository {
 	}
 }
 
-func runInformerInBg(f func() chan struct{}, timeout time.Duration) {
+// runInformerInBg runs the informer started by f, restarting it after the timeout, until the
+// context is done
+func runInformerInBg(ctx context.Context, f func() chan struct{}, timeout time.Duration) {
 	go func() {
 		for {
 			timeoutChan := make(chan struct{})
@@ -163,10 +167,8 @@ func runInformerInBg(f func() chan struct{}, timeout time.Duration) {
 				}
 			}()
 			stopChan := f()
-			sigIngChan := make(chan os.Signal, 1)
-			signal.Notify(sigIngChan, os.Interrupt)
 			select {
-			case <-sigIngChan:
+			case <-ctx.Done():
 				close(stopChan)
 				return
 			case <-timeoutChan:
@@ -53,6 +53,21 @@ func (wrapper defaultServiceWrapper) targetLabels() string {
 	return labels
 }
 
+func (wrapper defaultServiceWrapper) allowedPeers() []string {
+	rawPeers, peersOk := wrapper.k8sSvc.ObjectMeta.GetAnnotations()["wormhole.glothriel.github.com/allowed-peers"]
+	if !peersOk {
+		return nil
+	}
+	var peers []string
+	for _, peer := range strings.Split(rawPeers, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
 func (wrapper defaultServiceWrapper) ports() []corev1.ServicePort {
 	ports, portsOk := wrapper.k8sSvc.ObjectMeta.GetAnnotations()["wormhole.glothriel.github.com/ports"]
 	if !portsOk {
@@ -102,7 +117,10 @@ func (wrapper defaultServiceWrapper) apps() []apps.App {
 	theApps := make([]apps.App, 0)
 	exposedPorts := wrapper.ports()
 	for _, portDefinition := range exposedPorts {
-		if portDefinition.Protocol != "TCP" {
+		protocol := apps.ProtocolTCP
+		if portDefinition.Protocol == corev1.ProtocolUDP {
+			protocol = apps.ProtocolUDP
+		} else if portDefinition.Protocol != corev1.ProtocolTCP && portDefinition.Protocol != "" {
 			continue
 		}
 		portName := wrapper.name()
@@ -119,6 +137,8 @@ func (wrapper defaultServiceWrapper) apps() []apps.App {
 			),
 			TargetLabels: wrapper.targetLabels(),
 			OriginalPort: portDefinition.Port,
+			AllowedPeers: wrapper.allowedPeers(),
+			Protocol:     protocol,
 		})
 	}
 	return theApps
@@ -1,10 +1,14 @@
 package svcdetector
 
 import (
+	"context"
 	"time"
 
 	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // AppStateManager is an interface for managing the state of apps
@@ -16,6 +20,10 @@ type AppStateManager interface {
 type AppStateChange struct {
 	App   apps.App
 	State string
+
+	// Trace is the span of the stage, that produced the change. The stages handling the change
+	// continue its trace, a new one is started if it is not valid.
+	Trace trace.SpanContext
 }
 
 const (
@@ -31,20 +39,21 @@ type stateManager struct {
 	errorWaitInterval time.Duration
 	registry          exposedServicesRegistry
 	stateChangeChan   chan AppStateChange
+	done              <-chan struct{}
 }
 
 func (manager *stateManager) Changes() chan AppStateChange {
 	go func() {
 		for {
 			select {
+			case <-manager.done:
+				return
 			case createdService := <-manager.notifier.modifiedServices():
 				if createdService.shouldBeExposed() {
 					for _, app := range createdService.apps() {
 						if !manager.registry.isExposed(app, createdService) {
-							manager.stateChangeChan <- AppStateChange{
-								App:   app,
-								State: AppStateChangeAdded,
-							}
+							manager.withdrawOutdated(app, createdService)
+							manager.notify(app, AppStateChangeAdded, createdService)
 							manager.registry.markAsExposed(app, createdService)
 						}
 					}
@@ -58,6 +67,32 @@ func (manager *stateManager) Changes() chan AppStateChange {
 	return manager.stateChangeChan
 }
 
+// withdrawOutdated withdraws previously exposed versions of the app, for example when its
+// annotations changed, so it can be exposed again with the new settings
+func (manager *stateManager) withdrawOutdated(app apps.App, service serviceWrapper) {
+	for _, outdatedApp := range manager.registry.outdated(app, service) {
+		manager.registry.markAsWithdrawn(outdatedApp, service)
+		manager.notify(outdatedApp, AppStateChangeWithdrawn, service)
+	}
+}
+
+// notify sends the change, starting its trace. The change is dropped after the manager stops.
+func (manager *stateManager) notify(app apps.App, state string, service serviceWrapper) {
+	_, span := tracing.Start(trace.SpanContext{}, "svcdetector."+state,
+		attribute.String("app.name", app.Name),
+		attribute.String("service.id", service.id()),
+	)
+	defer span.End()
+	select {
+	case manager.stateChangeChan <- AppStateChange{
+		App:   app,
+		State: state,
+		Trace: span.SpanContext(),
+	}:
+	case <-manager.done:
+	}
+}
+
 func (manager *stateManager) cleanupRemoved() {
 	cleaners := []cleaner{
 		removedServicesCleaner{},
@@ -83,35 +118,33 @@ func (manager *stateManager) cleanupRemoved() {
 	for _, itemToDelete := range itemsToDelete {
 		for _, app := range itemToDelete.apps {
 			manager.registry.markAsWithdrawn(app, itemToDelete.service)
-			manager.stateChangeChan <- AppStateChange{
-				App:   app,
-				State: AppStateChangeWithdrawn,
-			}
+			manager.notify(app, AppStateChangeWithdrawn, itemToDelete.service)
 		}
 	}
 }
 
 // NewK8sAppStateManager create AppStateManager instances, that expose kubernetes services
-// (or not, judging on their annotations)
+// (or not, judging on their annotations). The services are watched until the context is done.
 func NewK8sAppStateManager(
+	ctx context.Context,
 	svcRepository ServiceRepository,
 	cleanupInterval time.Duration,
 ) AppStateManager {
 	theManager := &stateManager{
 		repository:        svcRepository,
-		notifier:          newExposedServicesNotifier(svcRepository),
+		notifier:          newExposedServicesNotifier(ctx, svcRepository),
 		errorWaitInterval: time.Second * 30,
 		stateChangeChan:   make(chan AppStateChange),
 		registry:          newDefaultExposedServicesRegistry(),
+		done:              ctx.Done(),
 	}
 	ticker := time.NewTicker(cleanupInterval)
-	quit := make(chan struct{})
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
 				theManager.cleanupRemoved()
-			case <-quit:
+			case <-ctx.Done():
 				ticker.Stop()
 				return
 			}
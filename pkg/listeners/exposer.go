@@ -2,27 +2,34 @@
 package listeners
 
 import (
+	"context"
+	"sync"
+
 	"github.com/glothriel/wormhole/pkg/apps"
 	"github.com/glothriel/wormhole/pkg/k8s/svcdetector"
+	"github.com/glothriel/wormhole/pkg/metrics"
+	"github.com/glothriel/wormhole/pkg/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Exposer reacts to changes in the app state and perform necessary actions like opening sockets,
-// creating kube services, etc.
+// creating kube services, etc. The context carries the trace of the change.
 type Exposer interface {
-	Add(app apps.App) (apps.App, error)
-	Withdraw(app apps.App) error
+	Add(ctx context.Context, app apps.App) (apps.App, error)
+	Withdraw(ctx context.Context, app apps.App) error
 	WithdrawAll() error
 }
 
 type noOpExposer struct {
 }
 
-func (e *noOpExposer) Add(app apps.App) (apps.App, error) {
+func (e *noOpExposer) Add(_ context.Context, app apps.App) (apps.App, error) {
 	return app, nil
 }
 
-func (e *noOpExposer) Withdraw(_ apps.App) error {
+func (e *noOpExposer) Withdraw(_ context.Context, _ apps.App) error {
 	return nil
 }
 
@@ -39,49 +46,150 @@ func NewNoOpExposer() Exposer {
 type Registry struct {
 	Exposer Exposer
 	apps    []apps.App
+	name    string
+
+	lock    sync.Mutex
+	changed chan struct{}
+	counted map[string]int
+	traces  map[string]trace.SpanContext
+}
+
+// RegistryOption allows customizing the registry
+type RegistryOption func(*Registry)
+
+// WithName sets the name of the registry, that labels its metrics
+func WithName(name string) RegistryOption {
+	return func(g *Registry) {
+		g.name = name
+	}
 }
 
-// Watch listens for changes in the app state and triggers the exposer
-func (g *Registry) Watch(c chan svcdetector.AppStateChange, done chan bool) { // nolint: gocognit
+// Watch listens for changes in the app state and triggers the exposer, until the context is done
+func (g *Registry) Watch(ctx context.Context, c chan svcdetector.AppStateChange) {
 	for {
 		select {
 		case appStageChange := <-c:
-			func() {
-				if appStageChange.State == svcdetector.AppStateChangeAdded {
-					logrus.Infof("App local.%s added", appStageChange.App.Name)
-					newApp, createErr := g.Exposer.Add(appStageChange.App)
-					if createErr != nil {
-						logrus.Errorf("Could not create listener: %v", createErr)
-						return
-					}
-					g.apps = append(g.apps, newApp)
-				} else if appStageChange.State == svcdetector.AppStateChangeWithdrawn {
-					logrus.Infof("App local.%s withdrawn", appStageChange.App.Name)
-					if withdrawErr := g.Exposer.Withdraw(appStageChange.App); withdrawErr != nil {
-						logrus.Errorf("Could not withdraw app: %v", withdrawErr)
-					}
-					for i, app := range g.apps {
-						if app.Name == appStageChange.App.Name && appStageChange.App.Peer == app.Peer {
-							g.apps = append(g.apps[:i], g.apps[i+1:]...)
-							break
-						}
-					}
-				}
-			}()
-		case <-done:
+			spanCtx, span := tracing.Start(appStageChange.Trace, "registry."+appStageChange.State,
+				attribute.String("registry", g.name),
+				attribute.String("app.name", appStageChange.App.Name),
+				attribute.String("app.peer", appStageChange.App.Peer),
+			)
+			tracing.End(span, g.apply(spanCtx, appStageChange))
+		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// apply exposes or withdraws the app, errors are logged and returned only for tracing
+func (g *Registry) apply(ctx context.Context, appStageChange svcdetector.AppStateChange) error {
+	if appStageChange.State == svcdetector.AppStateChangeAdded {
+		logrus.Infof("App local.%s added", appStageChange.App.Name)
+		newApp, createErr := g.Exposer.Add(ctx, appStageChange.App)
+		if createErr != nil {
+			logrus.Errorf("Could not create listener: %v", createErr)
+			return createErr
+		}
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		g.apps = append(g.apps, newApp)
+		g.traces[newApp.Name] = trace.SpanContextFromContext(ctx)
+		g.notifyChanged()
+	} else if appStageChange.State == svcdetector.AppStateChangeWithdrawn {
+		logrus.Infof("App local.%s withdrawn", appStageChange.App.Name)
+		withdrawErr := g.Exposer.Withdraw(ctx, appStageChange.App)
+		if withdrawErr != nil {
+			logrus.Errorf("Could not withdraw app: %v", withdrawErr)
+		}
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		for i, app := range g.apps {
+			if app.Name == appStageChange.App.Name && appStageChange.App.Peer == app.Peer {
+				g.apps = append(g.apps[:i], g.apps[i+1:]...)
+				delete(g.traces, app.Name)
+				g.notifyChanged()
+				break
+			}
+		}
+		return withdrawErr
+	}
+	return nil
+}
+
+// WithdrawAll withdraws all the apps exposed by the registry, it should not be called while
+// the registry watches for changes
+func (g *Registry) WithdrawAll() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if withdrawErr := g.Exposer.WithdrawAll(); withdrawErr != nil {
+		return withdrawErr
+	}
+	g.apps = nil
+	g.traces = make(map[string]trace.SpanContext)
+	g.notifyChanged()
+	return nil
+}
+
 // List returns the list of apps
 func (g *Registry) List() ([]apps.App, error) {
-	return g.apps, nil
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return append([]apps.App(nil), g.apps...), nil
+}
+
+// Trace returns the span, that exposed the app with the given name. It is meant for the
+// registries of the local apps, where the names are unique.
+func (g *Registry) Trace(name string) trace.SpanContext {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.traces[name]
+}
+
+// Changed returns a channel, that is closed the next time the list of apps changes
+func (g *Registry) Changed() <-chan struct{} {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.changed == nil {
+		g.changed = make(chan struct{})
+	}
+	return g.changed
+}
+
+// notifyChanged must be called with the lock held
+func (g *Registry) notifyChanged() {
+	g.updateMetrics()
+	if g.changed != nil {
+		close(g.changed)
+		g.changed = nil
+	}
+}
+
+// updateMetrics publishes the number of apps per peer, it must be called with the lock held
+func (g *Registry) updateMetrics() {
+	counts := make(map[string]int)
+	for _, app := range g.apps {
+		counts[app.Peer]++
+	}
+	for peer := range g.counted {
+		if _, ok := counts[peer]; !ok {
+			metrics.ExposedApps.DeleteLabelValues(g.name, peer)
+		}
+	}
+	for peer, count := range counts {
+		metrics.ExposedApps.WithLabelValues(g.name, peer).Set(float64(count))
+	}
+	g.counted = counts
 }
 
 // NewApps creates a new registry of apps
-func NewApps(r Exposer) *Registry {
-	return &Registry{
+func NewApps(r Exposer, opts ...RegistryOption) *Registry {
+	g := &Registry{
 		Exposer: r,
+		name:    "apps",
+		traces:  make(map[string]trace.SpanContext),
+	}
+	for _, opt := range opts {
+		opt(g)
 	}
+	return g
 }
@@ -0,0 +1,92 @@
+// Package metrics defines the Prometheus metrics of wormhole. They are registered in the
+// default registry, that is exposed when the --metrics flag is set.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "wormhole"
+
+// Outcomes of the pairing requests
+const (
+	PairingOutcomePaired       = "paired"
+	PairingOutcomeRotated      = "rotated"
+	PairingOutcomeInvalid      = "invalid"
+	PairingOutcomeUnauthorized = "unauthorized"
+	PairingOutcomeError        = "error"
+)
+
+// Results of the syncs
+const (
+	SyncResultSuccess = "success"
+	SyncResultFailure = "failure"
+)
+
+// Results of the NGINX reloads
+const (
+	NginxReloadResultSuccess = "success"
+	NginxReloadResultFailure = "failure"
+)
+
+var (
+	// PairingRequests counts the pairing requests handled by the server by their outcome
+	PairingRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pairing_requests_total",
+		Help:      "Pairing requests handled by the server by outcome",
+	}, []string{"outcome"})
+
+	// SyncRequests counts the sync requests handled by the server by the syncing peer
+	SyncRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sync_requests_total",
+		Help:      "Sync requests handled by the server by peer and result",
+	}, []string{"peer", "result"})
+
+	// SyncRoundTrips counts the syncs performed by the client
+	SyncRoundTrips = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sync_round_trips_total",
+		Help:      "Syncs performed by the client by peer and result",
+	}, []string{"peer", "result"})
+
+	// SyncRoundTripDuration observes the duration of the syncs performed by the client. Long
+	// polled syncs include the time the server held them.
+	SyncRoundTripDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_round_trip_duration_seconds",
+		Help:      "Duration of the syncs performed by the client, long polled ones include the waiting time",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"peer", "long_poll"})
+
+	// ExposedApps is the number of apps exposed by the registries per peer
+	ExposedApps = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "exposed_apps",
+		Help:      "Apps exposed by the registry per peer",
+	}, []string{"registry", "peer"})
+
+	// NginxReloads counts the reloads of NGINX by result
+	NginxReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nginx_reloads_total",
+		Help:      "Reloads of NGINX by result, failures are counted after all the retries",
+	}, []string{"result"})
+
+	// KubernetesUpsertErrors counts the failures to create or update Kubernetes resources
+	KubernetesUpsertErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kubernetes_upsert_errors_total",
+		Help:      "Failures to create or update Kubernetes resources by kind",
+	}, []string{"kind"})
+
+	// Leader is 1 while the replica of the server holds the leadership, only set when the
+	// leader election is enabled
+	Leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "1 while the server replica is the elected leader, 0 while it stands by",
+	})
+)
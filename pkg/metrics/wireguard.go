@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// wireguardCollector reads the statistics of the peers from the Wireguard interface on every scrape
+type wireguardCollector struct {
+	stats wg.StatsProvider
+
+	lastHandshake *prometheus.Desc
+	receiveBytes  *prometheus.Desc
+	transmitBytes *prometheus.Desc
+}
+
+func (c *wireguardCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lastHandshake
+	ch <- c.receiveBytes
+	ch <- c.transmitBytes
+}
+
+func (c *wireguardCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, statsErr := c.stats.Stats()
+	if statsErr != nil {
+		logrus.Warnf("Failed to collect Wireguard metrics: %v", statsErr)
+		return
+	}
+	for _, peer := range stats {
+		if !peer.LastHandshake.IsZero() {
+			ch <- prometheus.MustNewConstMetric(
+				c.lastHandshake, prometheus.GaugeValue, float64(peer.LastHandshake.Unix()), peer.PublicKey,
+			)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.receiveBytes, prometheus.CounterValue, float64(peer.ReceiveBytes), peer.PublicKey,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.transmitBytes, prometheus.CounterValue, float64(peer.TransmitBytes), peer.PublicKey,
+		)
+	}
+}
+
+// RegisterWireguardCollector registers the metrics of the peers of the Wireguard interface
+func RegisterWireguardCollector(stats wg.StatsProvider) error {
+	labels := []string{"public_key"}
+	return prometheus.Register(&wireguardCollector{
+		stats: stats,
+		lastHandshake: prometheus.NewDesc(
+			namespace+"_wireguard_peer_last_handshake_seconds",
+			"Time of the last Wireguard handshake with the peer, as a Unix timestamp", labels, nil,
+		),
+		receiveBytes: prometheus.NewDesc(
+			namespace+"_wireguard_peer_receive_bytes_total",
+			"Bytes received from the peer over Wireguard", labels, nil,
+		),
+		transmitBytes: prometheus.NewDesc(
+			namespace+"_wireguard_peer_transmit_bytes_total",
+			"Bytes sent to the peer over Wireguard", labels, nil,
+		),
+	})
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticStatsProvider struct {
+	stats []wg.PeerStats
+	err   error
+}
+
+func (p staticStatsProvider) Stats() ([]wg.PeerStats, error) {
+	return p.stats, p.err
+}
+
+func newTestWireguardCollector(stats wg.StatsProvider) prometheus.Collector {
+	labels := []string{"public_key"}
+	return &wireguardCollector{
+		stats:         stats,
+		lastHandshake: prometheus.NewDesc("handshake", "handshake", labels, nil),
+		receiveBytes:  prometheus.NewDesc("rx", "rx", labels, nil),
+		transmitBytes: prometheus.NewDesc("tx", "tx", labels, nil),
+	}
+}
+
+func TestWireguardCollectorReportsPeerStats(t *testing.T) {
+	// given
+	collector := newTestWireguardCollector(staticStatsProvider{stats: []wg.PeerStats{
+		{PublicKey: "key1", LastHandshake: time.Unix(1700000000, 0), ReceiveBytes: 100, TransmitBytes: 200},
+		{PublicKey: "key2"},
+	}})
+
+	// when
+	err := testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP handshake handshake
+# TYPE handshake gauge
+handshake{public_key="key1"} 1.7e+09
+# HELP rx rx
+# TYPE rx counter
+rx{public_key="key1"} 100
+rx{public_key="key2"} 0
+# HELP tx tx
+# TYPE tx counter
+tx{public_key="key1"} 200
+tx{public_key="key2"} 0
+`))
+
+	// then
+	assert.NoError(t, err)
+}
+
+func TestWireguardCollectorSkipsFailedReads(t *testing.T) {
+	// given
+	collector := newTestWireguardCollector(staticStatsProvider{err: errors.New("no such device")})
+
+	// when
+	count := testutil.CollectAndCount(collector)
+
+	// then
+	assert.Equal(t, 0, count)
+}
@@ -2,6 +2,7 @@
 package nginx
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
@@ -9,8 +10,11 @@ import (
 
 	"github.com/glothriel/wormhole/pkg/apps"
 	"github.com/glothriel/wormhole/pkg/listeners"
+	"github.com/glothriel/wormhole/pkg/tracing"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Exposer is an Exposer implementation that uses NGINX as a proxy server
@@ -25,7 +29,18 @@ type Exposer struct {
 }
 
 // Add implements listeners.Exposer
-func (n *Exposer) Add(app apps.App) (apps.App, error) {
+func (n *Exposer) Add(ctx context.Context, app apps.App) (apps.App, error) {
+	_, span := tracing.Tracer().Start(
+		ctx, "nginx.add", trace.WithAttributes(attribute.String("nginx.prefix", n.prefix)),
+	)
+	exposed, addErr := n.add(span, app)
+	tracing.End(span, addErr)
+	return exposed, addErr
+}
+
+// add writes the configuration of the app, the errors of writing and reloading are not
+// returned, but they are recorded on the span
+func (n *Exposer) add(span trace.Span, app apps.App) (apps.App, error) {
 	port, portErr := n.ports.Allocate()
 	if portErr != nil {
 		return apps.App{}, fmt.Errorf("Could not allocate port: %v", portErr)
@@ -40,8 +55,12 @@ func (n *Exposer) Add(app apps.App) (apps.App, error) {
 	if addrsErr != nil {
 		return apps.App{}, fmt.Errorf("Could not get listener addresses: %v", addrsErr)
 	}
+	listenSuffix := ""
+	if apps.ProtocolOf(app) == apps.ProtocolUDP {
+		listenSuffix = " udp"
+	}
 	for _, addr := range listenAddrs {
-		listenBlock += fmt.Sprintf("	listen %s;\n", addr)
+		listenBlock += fmt.Sprintf("	listen %s%s;\n", addr, listenSuffix)
 	}
 	if writeErr := afero.WriteFile(n.fs, path.Join(n.path, server.File), []byte(fmt.Sprintf(`
 # [%s] %s
@@ -56,18 +75,29 @@ server {
 		server.ProxyPass,
 	)), 0644); writeErr != nil {
 		logrus.Errorf("Could not write NGINX config file: %v", writeErr)
+		span.RecordError(writeErr)
 	} else {
 		logrus.Infof("Created NGINX config file %s", server.File)
 	}
 
 	if reloaderErr := n.reloader.Reload(); reloaderErr != nil {
 		logrus.Errorf("Could not reload NGINX: %v", reloaderErr)
+		span.RecordError(reloaderErr)
 	}
 	return apps.WithAddress(app, fmt.Sprintf("localhost:%d", port)), nil
 }
 
 // Withdraw implements listeners.Exposer
-func (n *Exposer) Withdraw(app apps.App) error {
+func (n *Exposer) Withdraw(ctx context.Context, app apps.App) error {
+	_, span := tracing.Tracer().Start(
+		ctx, "nginx.withdraw", trace.WithAttributes(attribute.String("nginx.prefix", n.prefix)),
+	)
+	withdrawErr := n.withdraw(span, app)
+	tracing.End(span, withdrawErr)
+	return withdrawErr
+}
+
+func (n *Exposer) withdraw(span trace.Span, app apps.App) error {
 	path := path.Join(n.path, nginxConfigPath(n.prefix, app))
 	removeErr := n.fs.Remove(path)
 
@@ -82,6 +112,7 @@ func (n *Exposer) Withdraw(app apps.App) error {
 	}
 	if reloaderErr := n.reloader.Reload(); reloaderErr != nil {
 		logrus.Errorf("Could not reload NGINX: %v", reloaderErr)
+		span.RecordError(reloaderErr)
 	}
 	return nil
 }
@@ -111,7 +142,7 @@ func (n *Exposer) WithdrawAll() error {
 			logrus.Errorf("Could not remove file %s: %v", file, removeErr)
 		} else {
 			deleted++
-			logrus.Infof("Cleaned up NGINX config file upon startup %s", file)
+			logrus.Infof("Cleaned up NGINX config file %s", file)
 		}
 	}
 	if deleted > 0 {
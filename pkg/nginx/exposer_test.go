@@ -0,0 +1,75 @@
+package nginx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+type noOpReloader struct{}
+
+func (r *noOpReloader) Reload() error {
+	return nil
+}
+
+func TestExposerAddWritesListenBlockForProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		expected string
+	}{
+		{
+			name:     "Default protocol",
+			protocol: "",
+			expected: "	listen 127.0.0.1:20000;\n",
+		},
+		{
+			name:     "TCP",
+			protocol: apps.ProtocolTCP,
+			expected: "	listen 127.0.0.1:20000;\n",
+		},
+		{
+			name:     "UDP",
+			protocol: apps.ProtocolUDP,
+			expected: "	listen 127.0.0.1:20000 udp;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			fs := afero.NewMemMapFs()
+			exposer := &Exposer{
+				prefix:   "remote",
+				path:     "/nginx",
+				fs:       fs,
+				listener: NewOnlyGivenAddressListener("127.0.0.1"),
+				reloader: &noOpReloader{},
+				ports: &rangePortAllocator{
+					start: 20000,
+					end:   20001,
+					used:  make(map[int]struct{}),
+				},
+			}
+
+			// when
+			newApp, err := exposer.Add(context.Background(), apps.App{
+				Name:     "dns",
+				Peer:     "client1",
+				Address:  "10.0.0.2:53",
+				Protocol: tt.protocol,
+			})
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, "localhost:20000", newApp.Address)
+			content, readErr := afero.ReadFile(fs, "/nginx/remote-client1-dns.conf")
+			assert.NoError(t, readErr)
+			assert.Contains(t, string(content), tt.expected)
+			assert.Contains(t, string(content), "proxy_pass 10.0.0.2:53;")
+		})
+	}
+}
@@ -2,9 +2,8 @@ package nginx
 
 import (
 	"errors"
-	"fmt"
 	"net"
-	"strings"
+	"strconv"
 )
 
 const wg0InterfaceName = "wg0"
@@ -43,10 +42,11 @@ func (a *allAcceptWg0Listener) Addrs(portNumber int) ([]string, error) {
 		}
 
 		for _, addr := range iface.addresses {
-			// Ignore IPv6
-			if !strings.Contains(addr, "::") {
-				allAddrs = append(allAddrs, fmt.Sprintf("%s:%d", addr, portNumber))
+			// Link-local IPv6 addresses cannot be listened on without the zone
+			if ip := net.ParseIP(addr); ip == nil || ip.IsLinkLocalUnicast() {
+				continue
 			}
+			allAddrs = append(allAddrs, net.JoinHostPort(addr, strconv.Itoa(portNumber)))
 		}
 	}
 
@@ -64,7 +64,7 @@ type givenAddressOnlyListener struct {
 // Addrs implements Listener
 func (l *givenAddressOnlyListener) Addrs(portNumber int) ([]string, error) {
 	return []string{
-		fmt.Sprintf("%s:%d", l.address, portNumber),
+		net.JoinHostPort(l.address, strconv.Itoa(portNumber)),
 	}, nil
 }
 
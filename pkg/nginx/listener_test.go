@@ -41,6 +41,32 @@ func TestAllAcceptWgListener(t *testing.T) {
 	assert.NoError(t, err)
 	assert.ElementsMatch(t, []string{"127.0.0.1:80"}, addrs)
 }
+func TestAllAcceptWgListenerIncludesIPv6(t *testing.T) {
+	// given
+	lister := &mockLister{
+		interfaces: []networkInterface{
+			{
+				name:      "eth0",
+				addresses: []string{"10.0.0.5", "fd00::5", "fe80::1"},
+			},
+			{
+				name:      "wg0",
+				addresses: []string{"fd00:188::1"},
+			},
+		},
+	}
+	listenerIf := NewAllAcceptWireguardListener()
+	listener := listenerIf.(*allAcceptWg0Listener)
+	listener.lister = lister
+
+	// when
+	addrs, err := listener.Addrs(80)
+
+	// then
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"10.0.0.5:80", "[fd00::5]:80"}, addrs)
+}
+
 func TestAllAcceptWgListenerErrors(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -68,15 +68,24 @@ func (v *validatingRangePortAllocator) Return(port int) {
 	v.child.Return(port)
 }
 
-// isPortOpen checks if a port is open for listening
+// isPortOpen checks if a port is open for listening, both for TCP and UDP, as the allocated
+// ports are shared between the protocols
 func isPortOpen(port int) bool {
-	ln, err := net.Listen("tcp", net.JoinHostPort("0.0.0.0", fmt.Sprint(port)))
+	address := net.JoinHostPort("0.0.0.0", fmt.Sprint(port))
+	ln, err := net.Listen("tcp", address)
 	if err != nil {
 		return false
 	}
 	if closeErr := ln.Close(); closeErr != nil {
 		logrus.Errorf("Failed to close listener: %v", closeErr)
 	}
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return false
+	}
+	if closeErr := pc.Close(); closeErr != nil {
+		logrus.Errorf("Failed to close packet listener: %v", closeErr)
+	}
 	return true
 }
 
@@ -6,6 +6,7 @@ import (
 	"syscall"
 
 	"github.com/avast/retry-go/v4"
+	"github.com/glothriel/wormhole/pkg/metrics"
 	"github.com/mitchellh/go-ps"
 )
 
@@ -54,6 +55,20 @@ func (r *retryingReloader) Reload() error {
 	)
 }
 
+// metricsReloader counts the reloads of the child reloader by result
+type metricsReloader struct {
+	child Reloader
+}
+
+func (r *metricsReloader) Reload() error {
+	if reloadErr := r.child.Reload(); reloadErr != nil {
+		metrics.NginxReloads.WithLabelValues(metrics.NginxReloadResultFailure).Inc()
+		return reloadErr
+	}
+	metrics.NginxReloads.WithLabelValues(metrics.NginxReloadResultSuccess).Inc()
+	return nil
+}
+
 // NewRetryingReloader creates a new RetryingReloader
 func NewRetryingReloader(child Reloader, tries int) Reloader {
 	return &retryingReloader{
@@ -67,7 +82,8 @@ func NewPidBasedReloader() Reloader {
 	return &lowestMatchingProcessIDReloader{}
 }
 
-// NewDefaultReloader creates a pre-configured reloader, that is retrying 10 times
+// NewDefaultReloader creates a pre-configured reloader, that is retrying 10 times and counts
+// the reloads in the metrics
 func NewDefaultReloader() Reloader {
-	return NewRetryingReloader(NewPidBasedReloader(), 10)
+	return &metricsReloader{child: NewRetryingReloader(NewPidBasedReloader(), 10)}
 }
@@ -4,12 +4,18 @@ package pairing
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
+	"github.com/glothriel/wormhole/pkg/tracing"
 	"github.com/glothriel/wormhole/pkg/wg"
 	"github.com/sirupsen/logrus"
 	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// traceMetadataKey carries the span of the pairing in the metadata of the request
+const traceMetadataKey = "traceparent"
+
 // Request is a request to pair with a server
 type Request struct {
 	Name string `json:"name"` // Name of the peer, that requests pairing,
@@ -20,7 +26,8 @@ type Request struct {
 
 // RequestWireguardConfig is a wireguard configuration for the pairing request
 type RequestWireguardConfig struct {
-	PublicKey string `json:"public_key"`
+	PublicKey string       `json:"public_key"`
+	Rotation  *KeyRotation `json:"rotation,omitempty"` // Set when the peer replaces its previous key
 }
 
 // Response is a response to a pairing request
@@ -57,13 +64,8 @@ func (c *keyCachingPairingClient) Pair() (Response, error) {
 	response, getErr := c.storage.Get()
 	if getErr == nil {
 		c.wgConfig.Address = response.AssignedIP
-		c.wgConfig.Upsert(wg.Peer{
-			Name:                response.Name,
-			Endpoint:            response.Wireguard.Endpoint,
-			PublicKey:           response.Wireguard.PublicKey,
-			AllowedIPs:          fmt.Sprintf("%s/32,%s/32", response.InternalServerIP, response.AssignedIP),
-			PersistentKeepalive: 10,
-		})
+		c.wgConfig.Subnet = wg.HostMask(response.AssignedIP)
+		c.wgConfig.Upsert(serverPeer(response))
 
 		updateErr := c.wgReloader.Update(*c.wgConfig)
 		if updateErr != nil {
@@ -101,13 +103,18 @@ func NewKeyCachingPairingClient(
 	wgReloader wg.WireguardConfigReloader,
 	client Client,
 ) Client {
+	var thePinger pinger = &defaultPinger{}
+	if reloaderPinger, ok := wgReloader.(pinger); ok {
+		// Userspace interfaces are not reachable by the ICMP sockets of the system
+		thePinger = reloaderPinger
+	}
 	return &keyCachingPairingClient{
 		client:     client,
 		storage:    storage,
 		wgReloader: wgReloader,
 		wgConfig:   wgConfig,
 
-		pinger: &retryingPinger{&defaultPinger{}},
+		pinger: &retryingPinger{thePinger},
 	}
 }
 
@@ -151,6 +158,11 @@ func (s *boltKeyCachingPairingClientStorage) Set(response Response) error {
 	})
 }
 
+// Close closes the database
+func (s *boltKeyCachingPairingClientStorage) Close() error {
+	return s.db.Close()
+}
+
 // NewBoltKeyCachingPairingClientStorage creates a new KeyCachingPairingClientStorage backed by a bolt database
 func NewBoltKeyCachingPairingClientStorage(path string) (KeyCachingPairingClientStorage, error) {
 	db, err := bolt.Open(path, 0600, nil)
@@ -185,25 +197,100 @@ func NewInMemoryKeyCachingPairingClientStorage() KeyCachingPairingClientStorage
 
 // defaultPairingClient is a client that can pair with a server
 type defaultPairingClient struct {
+	lock       sync.Mutex
 	clientName string
 	keyPair    KeyPair
 	wgConfig   *wg.Config
 
 	wgReloader wg.WireguardConfigReloader
 	encoder    Encoder
+	fallback   Encoder
 	transport  ClientTransport
 }
 
+// ClientOption allows customizing the pairing client
+type ClientOption func(*defaultPairingClient)
+
+// WithFallbackEncoder makes the client retry the requests using the given encoder, until the
+// server is known to support the preferred one. The client sticks to the encoder of the
+// first successful request, so older servers keep working during rolling upgrades.
+func WithFallbackEncoder(encoder Encoder) ClientOption {
+	return func(c *defaultPairingClient) {
+		c.fallback = encoder
+	}
+}
+
 // Pair sends a pairing request to the server and returns the response
 func (c *defaultPairingClient) Pair() (Response, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	response, exchangeErr := c.exchange(RequestWireguardConfig{
+		PublicKey: c.keyPair.PublicKey,
+	})
+	if exchangeErr != nil {
+		return Response{}, exchangeErr
+	}
+	return response, c.apply(response)
+}
+
+// Rotate sends a pairing request with the new key pair, proving that the client owns the current one
+func (c *defaultPairingClient) Rotate(serverPublicKey string, newKeyPair KeyPair) (Response, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	rotation, rotationErr := NewKeyRotation(c.clientName, c.keyPair, newKeyPair.PublicKey, serverPublicKey)
+	if rotationErr != nil {
+		return Response{}, NewClientError(rotationErr)
+	}
+	response, exchangeErr := c.exchange(RequestWireguardConfig{
+		PublicKey: newKeyPair.PublicKey,
+		Rotation:  rotation,
+	})
+	if exchangeErr != nil {
+		return Response{}, exchangeErr
+	}
+	// The server already uses the new key, so it must be kept even if the config cannot be reloaded
+	c.keyPair = newKeyPair
+	c.wgConfig.PrivateKey = newKeyPair.PrivateKey
+	if applyErr := c.apply(response); applyErr != nil {
+		logrus.Errorf("Failed to update Wireguard config: %v", applyErr)
+	}
+	return response, nil
+}
+
+func (c *defaultPairingClient) exchange(wireguard RequestWireguardConfig) (Response, error) {
+	_, span := tracing.Start(trace.SpanContext{}, "pairing.client.pair")
+	response, exchangeErr := c.send(span, wireguard)
+	tracing.End(span, exchangeErr)
+	return response, exchangeErr
+}
+
+func (c *defaultPairingClient) send(span trace.Span, wireguard RequestWireguardConfig) (Response, error) {
+	response, sendErr := c.sendUsing(c.encoder, span, wireguard)
+	if sendErr != nil && c.fallback != nil {
+		logrus.Warnf("Pairing failed, retrying using the fallback encoding: %v", sendErr)
+		response, sendErr = c.sendUsing(c.fallback, span, wireguard)
+		if sendErr == nil {
+			c.encoder = c.fallback
+		}
+	}
+	if sendErr == nil {
+		c.fallback = nil
+	}
+	return response, sendErr
+}
+
+func (c *defaultPairingClient) sendUsing(
+	encoder Encoder, span trace.Span, wireguard RequestWireguardConfig,
+) (Response, error) {
 	request := Request{
-		Name: c.clientName,
-		Wireguard: RequestWireguardConfig{
-			PublicKey: c.keyPair.PublicKey,
-		},
-		Metadata: map[string]string{},
+		Name:      c.clientName,
+		Wireguard: wireguard,
+		Metadata:  map[string]string{},
+	}
+	if encoded := tracing.Encode(span.SpanContext()); encoded != "" {
+		request.Metadata[traceMetadataKey] = encoded
 	}
-	encoded, encodeErr := c.encoder.EncodeRequest(request)
+	encoded, encodeErr := encoder.EncodeRequest(request)
 	if encodeErr != nil {
 		return Response{}, NewClientError(encodeErr)
 	}
@@ -213,20 +300,29 @@ func (c *defaultPairingClient) Pair() (Response, error) {
 		return Response{}, NewClientError(sendErr)
 	}
 
-	decoded, decodeErr := c.encoder.DecodeResponse(response)
+	decoded, decodeErr := encoder.DecodeResponse(response)
 	if decodeErr != nil {
 		return Response{}, NewClientError(decodeErr)
 	}
-	c.wgConfig.Address = decoded.AssignedIP
-	c.wgConfig.Upsert(wg.Peer{
-		Name:                decoded.Name,
-		Endpoint:            decoded.Wireguard.Endpoint,
-		PublicKey:           decoded.Wireguard.PublicKey,
-		AllowedIPs:          fmt.Sprintf("%s/32,%s/32", decoded.InternalServerIP, decoded.AssignedIP),
-		PersistentKeepalive: 10,
-	})
+	return decoded, nil
+}
 
-	return decoded, c.wgReloader.Update(*c.wgConfig)
+func (c *defaultPairingClient) apply(response Response) error {
+	c.wgConfig.Address = response.AssignedIP
+	c.wgConfig.Subnet = wg.HostMask(response.AssignedIP)
+	c.wgConfig.Upsert(serverPeer(response))
+	return c.wgReloader.Update(*c.wgConfig)
+}
+
+// serverPeer returns the Wireguard peer entry of the server, that sent the response
+func serverPeer(response Response) wg.Peer {
+	return wg.Peer{
+		Name:                response.Name,
+		Endpoint:            response.Wireguard.Endpoint,
+		PublicKey:           response.Wireguard.PublicKey,
+		AllowedIPs:          fmt.Sprintf("%s,%s", wg.HostCIDR(response.InternalServerIP), wg.HostCIDR(response.AssignedIP)),
+		PersistentKeepalive: 10,
+	}
 }
 
 // NewDefaultPairingClient executes HTTP pairing requests to the server
@@ -237,8 +333,9 @@ func NewDefaultPairingClient(
 	wgReloader wg.WireguardConfigReloader,
 	encoder Encoder,
 	transport ClientTransport,
-) Client {
-	return &defaultPairingClient{
+	opts ...ClientOption,
+) KeyRotatingClient {
+	c := &defaultPairingClient{
 		clientName: clientName,
 		keyPair:    keyPair,
 		wgConfig:   wgConfig,
@@ -246,4 +343,8 @@ func NewDefaultPairingClient(
 		encoder:    encoder,
 		transport:  transport,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
@@ -0,0 +1,47 @@
+package pairing
+
+import (
+	"sync"
+
+	"github.com/glothriel/wormhole/pkg/wg"
+)
+
+// PeerDeleter removes paired peers together with their Wireguard configuration. The IPs of
+// the deleted peers are freed for the new ones.
+type PeerDeleter struct {
+	lock       sync.Locker // Guards the Wireguard config
+	peers      PeerStorage
+	wgConfig   *wg.Config
+	wgReloader wg.WireguardConfigReloader
+}
+
+// Delete removes the peer with the given name, returning the removed entry
+func (d *PeerDeleter) Delete(name string) (PeerInfo, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	peerInfo, getErr := d.peers.GetByName(name)
+	if getErr != nil {
+		return PeerInfo{}, getErr
+	}
+	d.wgConfig.DeleteByPublicKey(peerInfo.PublicKey)
+	if updateErr := d.wgReloader.Update(*d.wgConfig); updateErr != nil {
+		return PeerInfo{}, updateErr
+	}
+	if deleteErr := d.peers.DeleteByName(name); deleteErr != nil {
+		return PeerInfo{}, deleteErr
+	}
+	return peerInfo, nil
+}
+
+// NewPeerDeleter creates a new PeerDeleter instance. The config lock should be shared with the
+// other components modifying the Wireguard config, see WithConfigLock.
+func NewPeerDeleter(
+	peers PeerStorage, wgConfig *wg.Config, configLock sync.Locker, wgReloader wg.WireguardConfigReloader,
+) *PeerDeleter {
+	return &PeerDeleter{
+		lock:       configLock,
+		peers:      peers,
+		wgConfig:   wgConfig,
+		wgReloader: wgReloader,
+	}
+}
@@ -2,6 +2,9 @@ package pairing
 
 import (
 	"encoding/json"
+	"fmt"
+
+	"github.com/glothriel/wormhole/pkg/wormholepb"
 )
 
 // Encoder is an interface for encoding and decoding pairing requests and responses
@@ -39,3 +42,86 @@ func (e *jsonPairingEncoder) DecodeResponse(data []byte) (Response, error) {
 func NewJSONPairingEncoder() Encoder {
 	return &jsonPairingEncoder{}
 }
+
+type protobufPairingEncoder struct{}
+
+func (e *protobufPairingEncoder) EncodeRequest(req Request) ([]byte, error) {
+	pbReq := &wormholepb.PairingRequest{
+		Name:      req.Name,
+		PublicKey: req.Wireguard.PublicKey,
+		Metadata:  req.Metadata,
+	}
+	if req.Wireguard.Rotation != nil {
+		pbReq.Rotation = &wormholepb.KeyRotation{
+			PreviousPublicKey: req.Wireguard.Rotation.PreviousPublicKey,
+			Proof:             req.Wireguard.Rotation.Proof,
+		}
+	}
+	return wormholepb.Marshal(pbReq)
+}
+
+func (e *protobufPairingEncoder) DecodeRequest(data []byte) (Request, error) {
+	var pbReq wormholepb.PairingRequest
+	if unmarshalErr := wormholepb.Unmarshal(data, &pbReq); unmarshalErr != nil {
+		return Request{}, unmarshalErr
+	}
+	req := Request{
+		Name: pbReq.GetName(),
+		Wireguard: RequestWireguardConfig{
+			PublicKey: pbReq.GetPublicKey(),
+		},
+		Metadata: pbReq.GetMetadata(),
+	}
+	if pbReq.GetRotation() != nil {
+		req.Wireguard.Rotation = &KeyRotation{
+			PreviousPublicKey: pbReq.GetRotation().GetPreviousPublicKey(),
+			Proof:             pbReq.GetRotation().GetProof(),
+		}
+	}
+	return req, nil
+}
+
+func (e *protobufPairingEncoder) EncodeResponse(resp Response) ([]byte, error) {
+	return wormholepb.Marshal(&wormholepb.PairingResponse{
+		Name:             resp.Name,
+		AssignedIp:       resp.AssignedIP,
+		InternalServerIp: resp.InternalServerIP,
+		PublicKey:        resp.Wireguard.PublicKey,
+		Endpoint:         resp.Wireguard.Endpoint,
+		Metadata:         resp.Metadata,
+	})
+}
+
+func (e *protobufPairingEncoder) DecodeResponse(data []byte) (Response, error) {
+	var pbResp wormholepb.PairingResponse
+	if unmarshalErr := wormholepb.Unmarshal(data, &pbResp); unmarshalErr != nil {
+		return Response{}, unmarshalErr
+	}
+	return Response{
+		Name:             pbResp.GetName(),
+		AssignedIP:       pbResp.GetAssignedIp(),
+		InternalServerIP: pbResp.GetInternalServerIp(),
+		Wireguard: ResponseWireguardConfig{
+			PublicKey: pbResp.GetPublicKey(),
+			Endpoint:  pbResp.GetEndpoint(),
+		},
+		Metadata: pbResp.GetMetadata(),
+	}, nil
+}
+
+// NewProtobufPairingEncoder creates a new PairingEncoder instance, that uses compact protobuf
+// encoding. Servers accept it only when configured using WithEncoders.
+func NewProtobufPairingEncoder() Encoder {
+	return &protobufPairingEncoder{}
+}
+
+// NewEncoder creates an Encoder from its name, as passed in the command line
+func NewEncoder(name string) (Encoder, error) {
+	switch name {
+	case "json":
+		return NewJSONPairingEncoder(), nil
+	case "protobuf":
+		return NewProtobufPairingEncoder(), nil
+	}
+	return nil, fmt.Errorf("unknown pairing encoding: %s", name)
+}
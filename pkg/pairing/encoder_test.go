@@ -0,0 +1,75 @@
+package pairing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtobufPairingEncoderRoundTrip(t *testing.T) {
+	// given
+	encoder := NewProtobufPairingEncoder()
+	req := Request{
+		Name:      "client1",
+		Wireguard: RequestWireguardConfig{PublicKey: "client-key"},
+		Metadata:  map[string]string{"foo": "bar"},
+	}
+	resp := Response{
+		Name:             "server",
+		AssignedIP:       "10.188.0.2",
+		InternalServerIP: "10.188.0.1",
+		Wireguard: ResponseWireguardConfig{
+			PublicKey: "server-key",
+			Endpoint:  "wormhole.example.com:51820",
+		},
+		Metadata: map[string]string{"sync_server_address": "http://10.188.0.1:8081"},
+	}
+
+	// when
+	encodedReq, reqEncodeErr := encoder.EncodeRequest(req)
+	decodedReq, reqDecodeErr := encoder.DecodeRequest(encodedReq)
+	encodedResp, respEncodeErr := encoder.EncodeResponse(resp)
+	decodedResp, respDecodeErr := encoder.DecodeResponse(encodedResp)
+
+	// then
+	assert.NoError(t, reqEncodeErr)
+	assert.NoError(t, reqDecodeErr)
+	assert.NoError(t, respEncodeErr)
+	assert.NoError(t, respDecodeErr)
+	assert.Equal(t, req, decodedReq)
+	assert.Equal(t, resp, decodedResp)
+}
+
+func TestJSONPairingEncoderRejectsProtobuf(t *testing.T) {
+	// given
+	encoded, encodeErr := NewProtobufPairingEncoder().EncodeRequest(Request{Name: "client1"})
+	assert.NoError(t, encodeErr)
+
+	// when
+	_, decodeErr := NewJSONPairingEncoder().DecodeRequest(encoded)
+
+	// then
+	assert.Error(t, decodeErr)
+}
+
+func TestProtobufPairingEncoderKeepsKeyRotation(t *testing.T) {
+	// given
+	encoder := NewProtobufPairingEncoder()
+	req := Request{
+		Name: "client1",
+		Wireguard: RequestWireguardConfig{
+			PublicKey: "new-key",
+			Rotation:  &KeyRotation{PreviousPublicKey: "old-key", Proof: []byte("proof")},
+		},
+		Metadata: map[string]string{},
+	}
+
+	// when
+	encoded, encodeErr := encoder.EncodeRequest(req)
+	decoded, decodeErr := encoder.DecodeRequest(encoded)
+
+	// then
+	assert.NoError(t, encodeErr)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, req.Wireguard, decoded.Wireguard)
+}
@@ -0,0 +1,134 @@
+package pairing
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+
+	"github.com/glothriel/wormhole/pkg/wormholepb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// GRPCURLPrefix marks pairing server URLs, that should be accessed using gRPC
+	GRPCURLPrefix = "grpc://"
+	// GRPCTLSURLPrefix marks pairing server URLs, that should be accessed using gRPC over TLS
+	GRPCTLSURLPrefix = "grpcs://"
+)
+
+type grpcServerPairingTransport struct {
+	wormholepb.UnimplementedPairingServer
+
+	requests chan IncomingPairingRequest
+}
+
+func (t *grpcServerPairingTransport) Requests() <-chan IncomingPairingRequest {
+	return t.requests
+}
+
+func (t *grpcServerPairingTransport) Pair(
+	ctx context.Context, envelope *wormholepb.Envelope,
+) (*wormholepb.Envelope, error) {
+	var identity string
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, isTLS := p.AuthInfo.(credentials.TLSInfo); isTLS {
+			identity = identityFromTLS(&tlsInfo.State)
+		}
+	}
+	req := IncomingPairingRequest{
+		Request:  envelope.Payload,
+		Identity: identity,
+		Response: make(chan []byte),
+		Err:      make(chan error),
+	}
+	t.requests <- req
+	select {
+	case resp := <-req.Response:
+		return &wormholepb.Envelope{Payload: resp}, nil
+	case err := <-req.Err:
+		logrus.Errorf("Failed to process request: %v", err)
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+}
+
+// NewGRPCServerPairingTransport creates a new PairingServerTransport instance, that receives
+// the pairing requests over gRPC. If tlsConfig is not nil, the server uses TLS. When the context
+// is done, the server stops accepting the requests and is stopped gracefully.
+func NewGRPCServerPairingTransport(ctx context.Context, address string, tlsConfig *tls.Config) ServerTransport {
+	transport := &grpcServerPairingTransport{
+		requests: make(chan IncomingPairingRequest),
+	}
+	opts := []grpc.ServerOption{grpc.WaitForHandlers(true)}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	wormholepb.RegisterPairingServer(server, transport)
+	go func() {
+		defer close(transport.requests)
+		logrus.Infof("Starting gRPC pairing transport server on %s", address)
+		listener, listenErr := net.Listen("tcp", address)
+		if listenErr != nil {
+			logrus.Errorf("Failed to start gRPC pairing transport server: %v", listenErr)
+			return
+		}
+		served, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-ctx.Done():
+				logrus.Infof("Stopping gRPC pairing transport server on %s", address)
+				server.GracefulStop()
+			case <-served:
+				server.Stop()
+			}
+		}()
+		if serveErr := server.Serve(listener); serveErr != nil {
+			logrus.Errorf("Failed to start gRPC pairing transport server: %v", serveErr)
+		}
+		close(served)
+		<-stopped
+	}()
+	return transport
+}
+
+type grpcClientPairingTransport struct {
+	client wormholepb.PairingClient
+}
+
+func (t *grpcClientPairingTransport) Send(req []byte) ([]byte, error) {
+	resp, pairErr := t.client.Pair(context.Background(), &wormholepb.Envelope{Payload: req})
+	if pairErr != nil {
+		return nil, pairErr
+	}
+	return resp.Payload, nil
+}
+
+// NewGRPCClientPairingTransport creates a new PairingClientTransport instance, that sends
+// the pairing requests over gRPC. The server URL is expected in grpc://host:port format,
+// or grpcs://host:port for servers using TLS. The TLS config is used only for the latter,
+// nil means the system defaults.
+func NewGRPCClientPairingTransport(serverURL string, tlsConfig *tls.Config) (ClientTransport, error) {
+	transportCredentials := insecure.NewCredentials()
+	if strings.HasPrefix(serverURL, GRPCTLSURLPrefix) {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+	address := strings.TrimPrefix(strings.TrimPrefix(serverURL, GRPCURLPrefix), GRPCTLSURLPrefix)
+	conn, connErr := grpc.NewClient(address, grpc.WithTransportCredentials(transportCredentials))
+	if connErr != nil {
+		return nil, connErr
+	}
+	return &grpcClientPairingTransport{
+		client: wormholepb.NewPairingClient(conn),
+	}, nil
+}
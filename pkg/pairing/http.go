@@ -2,6 +2,8 @@ package pairing
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
@@ -19,8 +21,10 @@ func (t *httpServerPairingTransport) Requests() <-chan IncomingPairingRequest {
 	return t.requests
 }
 
-// NewHTTPServerPairingTransport creates a new PairingServerTransport instance
-func NewHTTPServerPairingTransport(server *http.Server) ServerTransport {
+// NewHTTPServerPairingTransport creates a new PairingServerTransport instance. If the server
+// has TLSConfig set, it serves HTTPS. When the context is done, the server stops accepting
+// the requests and is shut down, once the requests in progress are responded to.
+func NewHTTPServerPairingTransport(ctx context.Context, server *http.Server) ServerTransport {
 	incoming := make(chan IncomingPairingRequest)
 	router := mux.NewRouter()
 	router.HandleFunc("/pairing", func(w http.ResponseWriter, r *http.Request) { // nolint: dupl
@@ -32,6 +36,7 @@ func NewHTTPServerPairingTransport(server *http.Server) ServerTransport {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
+		req.Identity = identityFromTLS(r.TLS)
 		req.Response = make(chan []byte)
 		req.Err = make(chan error)
 		incoming <- req
@@ -51,9 +56,26 @@ func NewHTTPServerPairingTransport(server *http.Server) ServerTransport {
 	})
 	server.Handler = router
 	go func() {
+		defer close(incoming)
 		logrus.Infof("Starting HTTP pairing transport server on %s", server.Addr)
-		if err := server.ListenAndServe(); err != nil {
-			logrus.Fatalf("Failed to start HTTP pairing transport server: %v", err)
+		listenAndServe := server.ListenAndServe
+		if server.TLSConfig != nil {
+			listenAndServe = func() error {
+				return server.ListenAndServeTLS("", "")
+			}
+		}
+		served := make(chan error, 1)
+		go func() {
+			served <- listenAndServe()
+		}()
+		select {
+		case err := <-served:
+			logrus.Errorf("Failed to start HTTP pairing transport server: %v", err)
+		case <-ctx.Done():
+			logrus.Infof("Stopping HTTP pairing transport server on %s", server.Addr)
+		}
+		if shutdownErr := server.Shutdown(context.Background()); shutdownErr != nil {
+			logrus.Errorf("Failed to stop HTTP pairing transport server: %v", shutdownErr)
 		}
 	}()
 	return &httpServerPairingTransport{
@@ -94,10 +116,16 @@ func (t *httpClientPairingTransport) Send(req []byte) ([]byte, error) {
 	return respBody, nil
 }
 
-// NewHTTPClientPairingTransport creates a new PairingClientTransport instance
-func NewHTTPClientPairingTransport(serverURL string) ClientTransport {
+// NewHTTPClientPairingTransport creates a new PairingClientTransport instance. The TLS config
+// is used for https:// server URLs, nil means the system defaults.
+func NewHTTPClientPairingTransport(serverURL string, tlsConfig *tls.Config) ClientTransport {
 	return &httpClientPairingTransport{
 		serverURL: serverURL,
-		client:    &http.Client{},
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
 	}
 }
@@ -0,0 +1,157 @@
+package pairing
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInviteDoesNotExist is returned when an invite does not exist
+var ErrInviteDoesNotExist = errors.New("invite does not exist")
+
+// Invite allows a client to pair with the server using its own token, instead of the global one
+type Invite struct {
+	Name      string    `json:"name"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"` // Zero value means the invite never expires
+	MaxUses   int       `json:"max_uses"`   // Zero value means the invite may be used any number of times
+	Uses      int       `json:"uses"`
+	Peer      string    `json:"peer,omitempty"` // If set, only the peer with this name may use the invite
+}
+
+// IsUsable checks if the invite is neither expired nor used up
+func (i Invite) IsUsable(now time.Time) bool {
+	if !i.ExpiresAt.IsZero() && !now.Before(i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
+
+// GenerateInviteToken generates a new random invite token
+func GenerateInviteToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// InviteStorage is an interface for storing and retrieving invites
+type InviteStorage interface {
+	Store(Invite) error
+	GetByName(string) (Invite, error)
+	List() ([]Invite, error)
+	DeleteByName(string) error
+}
+
+type inMemoryInviteStorage struct {
+	invites sync.Map
+}
+
+func (s *inMemoryInviteStorage) Store(invite Invite) error {
+	s.invites.Store(invite.Name, invite)
+	return nil
+}
+
+func (s *inMemoryInviteStorage) GetByName(name string) (Invite, error) {
+	if invite, ok := s.invites.Load(name); ok {
+		return invite.(Invite), nil
+	}
+	return Invite{}, ErrInviteDoesNotExist
+}
+
+func (s *inMemoryInviteStorage) List() ([]Invite, error) {
+	var invites []Invite
+	s.invites.Range(func(_, value any) bool {
+		invites = append(invites, value.(Invite))
+		return true
+	})
+	return invites, nil
+}
+
+func (s *inMemoryInviteStorage) DeleteByName(name string) error {
+	s.invites.Delete(name)
+	return nil
+}
+
+// NewInMemoryInviteStorage creates a new in-memory InviteStorage instance
+func NewInMemoryInviteStorage() InviteStorage {
+	return &inMemoryInviteStorage{}
+}
+
+type boltInviteStorage struct {
+	db *bolt.DB
+}
+
+func (s *boltInviteStorage) Store(invite Invite) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("invites"))
+		encoded, encodeErr := json.Marshal(invite)
+		if encodeErr != nil {
+			return encodeErr
+		}
+		return b.Put([]byte(invite.Name), encoded)
+	})
+}
+
+func (s *boltInviteStorage) GetByName(name string) (Invite, error) {
+	var invite Invite
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("invites"))
+		payload := b.Get([]byte(name))
+		if payload == nil {
+			return ErrInviteDoesNotExist
+		}
+		return json.Unmarshal(payload, &invite)
+	})
+	return invite, err
+}
+
+func (s *boltInviteStorage) List() ([]Invite, error) {
+	var invites []Invite
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("invites"))
+		return b.ForEach(func(_, v []byte) error {
+			var invite Invite
+			if err := json.Unmarshal(v, &invite); err != nil {
+				return err
+			}
+			invites = append(invites, invite)
+			return nil
+		})
+	})
+	return invites, err
+}
+
+func (s *boltInviteStorage) DeleteByName(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("invites"))
+		return b.Delete([]byte(name))
+	})
+}
+
+// Close closes the database
+func (s *boltInviteStorage) Close() error {
+	return s.db.Close()
+}
+
+// NewBoltInviteStorage creates a new BoltDB (persistent, on-disk storage) InviteStorage instance
+func NewBoltInviteStorage(path string) InviteStorage {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		logrus.Panicf("failed to open bolt db: %v", err)
+	}
+	if updateErr := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("invites"))
+		return err
+	}); updateErr != nil {
+		logrus.Panicf("failed to create BoltDB bucket: %v", updateErr)
+	}
+	return &boltInviteStorage{db: db}
+}
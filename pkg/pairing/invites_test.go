@@ -0,0 +1,138 @@
+package pairing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/stretchr/testify/assert"
+)
+
+func pairUsing(t *testing.T, child *mockServerTransport, token, name, publicKey string) error {
+	encoded, encodeErr := NewJSONPairingEncoder().EncodeRequest(Request{
+		Name:      name,
+		Wireguard: RequestWireguardConfig{PublicKey: publicKey},
+	})
+	assert.NoError(t, encodeErr)
+	encrypted, _, encryptErr := sealPSKV2([]byte(token), encoded, nil, time.Now())
+	assert.NoError(t, encryptErr)
+	req := IncomingPairingRequest{Request: encrypted, Response: make(chan []byte), Err: make(chan error)}
+	child.requests <- req
+	select {
+	case <-req.Response:
+		return nil
+	case err := <-req.Err:
+		return err
+	}
+}
+
+func newInvitesTestServer(t *testing.T, invites InviteStorage) *mockServerTransport {
+	server, _, child := newTestServer(t, NewInMemoryPeerStorage(), func(child ServerTransport) ServerTransport {
+		return NewInvitesPSKPairingServerTransport("", invites, child)
+	}, WithInvites(invites))
+	go server.Start(context.Background())
+	return child
+}
+
+func TestInviteIsUsable(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		invite   Invite
+		expected bool
+	}{
+		{name: "Unlimited", invite: Invite{}, expected: true},
+		{name: "Not expired", invite: Invite{ExpiresAt: now.Add(time.Minute)}, expected: true},
+		{name: "Expired", invite: Invite{ExpiresAt: now.Add(-time.Minute)}, expected: false},
+		{name: "Uses left", invite: Invite{MaxUses: 2, Uses: 1}, expected: true},
+		{name: "Used up", invite: Invite{MaxUses: 2, Uses: 2}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.invite.IsUsable(now))
+		})
+	}
+}
+
+func TestSingleUseInviteCanPairOnlyOnePeer(t *testing.T) {
+	// given
+	invites := NewInMemoryInviteStorage()
+	assert.NoError(t, invites.Store(Invite{Name: "invite1", Token: "secret-token", MaxUses: 1}))
+	child := newInvitesTestServer(t, invites)
+
+	// when
+	firstErr := pairUsing(t, child, "secret-token", "client1", "client1-key")
+	repeatedErr := pairUsing(t, child, "secret-token", "client1", "client1-key")
+	secondErr := pairUsing(t, child, "secret-token", "client2", "client2-key")
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.NoError(t, repeatedErr)
+	assert.Error(t, secondErr)
+	invite, getErr := invites.GetByName("invite1")
+	assert.NoError(t, getErr)
+	assert.Equal(t, 1, invite.Uses)
+}
+
+func TestInvitePinnedToPeerRejectsOtherPeers(t *testing.T) {
+	// given
+	invites := NewInMemoryInviteStorage()
+	assert.NoError(t, invites.Store(Invite{Name: "invite1", Token: "secret-token", Peer: "client1"}))
+	child := newInvitesTestServer(t, invites)
+
+	// when
+	otherErr := pairUsing(t, child, "secret-token", "client2", "client2-key")
+	pinnedErr := pairUsing(t, child, "secret-token", "client1", "client1-key")
+
+	// then
+	assert.Error(t, otherErr)
+	assert.NoError(t, pinnedErr)
+}
+
+func TestExpiredInviteIsRejected(t *testing.T) {
+	// given
+	invites := NewInMemoryInviteStorage()
+	assert.NoError(t, invites.Store(Invite{
+		Name:      "invite1",
+		Token:     "secret-token",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}))
+	child := newInvitesTestServer(t, invites)
+
+	// when
+	err := pairUsing(t, child, "secret-token", "client1", "client1-key")
+
+	// then
+	assert.Error(t, err)
+}
+
+func TestPairedPeerCanRotateKeyUsingUsedUpInvite(t *testing.T) {
+	// given
+	invites := NewInMemoryInviteStorage()
+	assert.NoError(t, invites.Store(Invite{Name: "invite1", Token: "secret-token", MaxUses: 1}))
+	server, serverKeys, child := newTestServer(t, NewInMemoryPeerStorage(), func(child ServerTransport) ServerTransport {
+		return NewInvitesPSKPairingServerTransport("", invites, child)
+	}, WithInvites(invites))
+	go server.Start(context.Background())
+	client := NewDefaultPairingClient(
+		"client1", &wg.Config{}, generateTestKeyPair(t), &noOpWireguardReloader{}, NewJSONPairingEncoder(),
+		NewPSKClientPairingTransport("secret-token", &forwardingClientTransport{child}),
+	)
+	paired, pairErr := client.Pair()
+	assert.NoError(t, pairErr)
+
+	// when
+	rotated, rotateErr := client.Rotate(serverKeys.PublicKey, generateTestKeyPair(t))
+	repaired, repairErr := client.Pair()
+
+	// then
+	assert.NoError(t, rotateErr)
+	assert.NoError(t, repairErr)
+	assert.Equal(t, paired.AssignedIP, rotated.AssignedIP)
+	assert.Equal(t, paired.AssignedIP, repaired.AssignedIP)
+	invite, getErr := invites.GetByName("invite1")
+	assert.NoError(t, getErr)
+	assert.Equal(t, 1, invite.Uses)
+}
@@ -1,100 +1,141 @@
 package pairing
 
 import (
-	"net"
+	"errors"
+	"fmt"
+	"net/netip"
 	"sync"
 
 	"github.com/sirupsen/logrus"
 )
 
-// ReservedAddressLister is an interface for listing reserved addresses
-type ReservedAddressLister interface {
-	ReservedAddresses() ([]string, error)
-}
+// ErrIPPoolExhausted is returned when there are no free addresses left in the subnet
+var ErrIPPoolExhausted = errors.New("no free IP addresses left in the subnet")
 
 // IPPool is an interface for managing IP addresses
 type IPPool interface {
-	Next() (string, error)
+	// Next returns the address for a new peer: its reservation if it has one, or a free one
+	Next(peer string) (string, error)
 }
 
-type defaultIPPool struct {
-	previous net.IP
-	lock     sync.Mutex
+// IPAM is an IPPool, that also allows reserving static addresses for the peers
+type IPAM interface {
+	IPPool
+	Reserve(IPReservation) error
+	Unreserve(name string) error
+	Reservations() ([]IPReservation, error)
 }
 
-func (p *defaultIPPool) Next() (string, error) {
-	p.lock.Lock()
-	defer p.lock.Unlock()
-	i := p.previous.To4()
-	v := uint(i[0])<<24 + uint(i[1])<<16 + uint(i[2])<<8 + uint(i[3])
-	v++
-	v3 := byte(v & 0xFF)
-	v2 := byte((v >> 8) & 0xFF)
-	v1 := byte((v >> 16) & 0xFF)
-	v0 := byte((v >> 24) & 0xFF)
-	p.previous = net.IPv4(v0, v1, v2, v3)
-	return p.previous.String(), nil
+type cidrIPPool struct {
+	lock         sync.Mutex
+	server       netip.Addr
+	prefix       netip.Prefix
+	peers        PeerStorage
+	reservations IPReservationStorage
 }
 
-type reservedAddressesValidatingIPPool struct {
-	child             IPPool
-	reservedAddresses ReservedAddressLister
-}
-
-func (p *reservedAddressesValidatingIPPool) Next() (string, error) {
-	for {
-		ip, err := p.child.Next()
-		if err != nil {
-			return "", err
-		}
-		reserved, err := p.reservedAddresses.ReservedAddresses()
-		if err != nil {
-			return "", err
-		}
-		doContinue := false
-		for _, r := range reserved {
-			if r == ip {
-				logrus.Debugf("IP %s is reserved, skipping", ip)
-				doContinue = true
-			}
+func (p *cidrIPPool) Next(peer string) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	taken, takenErr := p.takenAddresses()
+	if takenErr != nil {
+		return "", takenErr
+	}
+	reservation, getErr := p.reservations.GetByName(peer)
+	if getErr == nil {
+		if owner, isTaken := taken[reservation.IP]; isTaken && owner != peer {
+			return "", fmt.Errorf("reserved IP %s of peer %s is used by %s", reservation.IP, peer, owner)
 		}
-		if doContinue {
+		logrus.Debugf("IP %s is reserved for %s, assigning", reservation.IP, peer)
+		return reservation.IP, nil
+	} else if getErr != ErrIPReservationDoesNotExist {
+		return "", getErr
+	}
+	for addr := p.prefix.Masked().Addr().Next(); p.isHost(addr); addr = addr.Next() {
+		if _, isTaken := taken[addr.String()]; isTaken || addr == p.server {
 			continue
 		}
-		logrus.Debugf("IP %s is not reserved, assigning", ip)
-		return ip, nil
+		logrus.Debugf("IP %s is not reserved, assigning", addr)
+		return addr.String(), nil
 	}
+	return "", ErrIPPoolExhausted
 }
 
-// NewIPPool creates a new IP pool
-func NewIPPool(starting string, reserved ReservedAddressLister) IPPool {
-	ip := net.ParseIP(starting)
-	if ip == nil {
-		logrus.Panicf("Invalid IP address passed as starting to IP pool: %s", starting)
+func (p *cidrIPPool) Reserve(reservation IPReservation) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	addr, parseErr := netip.ParseAddr(reservation.IP)
+	if parseErr != nil {
+		return parseErr
 	}
-	return &reservedAddressesValidatingIPPool{
-		child:             &defaultIPPool{previous: ip},
-		reservedAddresses: reserved,
+	if !p.isHost(addr) || addr == p.prefix.Masked().Addr() {
+		return fmt.Errorf("IP %s is not a host address of subnet %s", addr, p.prefix.Masked())
 	}
+	if addr == p.server {
+		return fmt.Errorf("IP %s is the address of the server", addr)
+	}
+	taken, takenErr := p.takenAddresses()
+	if takenErr != nil {
+		return takenErr
+	}
+	if owner, isTaken := taken[addr.String()]; isTaken && owner != reservation.Name {
+		return fmt.Errorf("IP %s is already used or reserved by %s", addr, owner)
+	}
+	reservation.IP = addr.String()
+	return p.reservations.Store(reservation)
+}
+
+func (p *cidrIPPool) Unreserve(name string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.reservations.DeleteByName(name)
 }
 
-type storageToReservedAddressListerAdapter struct {
-	storage PeerStorage
+func (p *cidrIPPool) Reservations() ([]IPReservation, error) {
+	return p.reservations.List()
 }
 
-func (s *storageToReservedAddressListerAdapter) ReservedAddresses() ([]string, error) {
-	peers, err := s.storage.List()
-	if err != nil {
-		return nil, err
+// isHost checks if the address may be assigned to a peer. The last address of IPv4 subnets
+// is the broadcast address.
+func (p *cidrIPPool) isHost(addr netip.Addr) bool {
+	if !addr.IsValid() || !p.prefix.Contains(addr) {
+		return false
 	}
-	var ips []string
-	for _, p := range peers {
-		ips = append(ips, p.IP)
+	return !addr.Is4() || p.prefix.Contains(addr.Next())
+}
+
+// takenAddresses returns the addresses of the paired peers and the reservations, mapped to
+// the names of the peers, that own them
+func (p *cidrIPPool) takenAddresses() (map[string]string, error) {
+	peers, listErr := p.peers.List()
+	if listErr != nil {
+		return nil, listErr
+	}
+	reservations, reservationsErr := p.reservations.List()
+	if reservationsErr != nil {
+		return nil, reservationsErr
 	}
-	return ips, nil
+	taken := make(map[string]string, len(peers)+len(reservations))
+	for _, reservation := range reservations {
+		taken[reservation.IP] = reservation.Name
+	}
+	for _, peer := range peers {
+		taken[peer.IP] = peer.Name
+	}
+	return taken, nil
 }
 
-// NewReservedAddressLister creates a new reserved address lister
-func NewReservedAddressLister(storage PeerStorage) ReservedAddressLister {
-	return &storageToReservedAddressListerAdapter{storage: storage}
+// NewIPPool creates a new IP pool, that assigns the host addresses of the subnet of the server,
+// for example 10.188.0.1/24. Addresses of deleted peers are reused.
+func NewIPPool(serverCIDR string, peers PeerStorage, reservations IPReservationStorage) (IPAM, error) {
+	prefix, parseErr := netip.ParsePrefix(serverCIDR)
+	if parseErr != nil {
+		return nil, fmt.Errorf("invalid subnet of the server: %w", parseErr)
+	}
+	return &cidrIPPool{
+		server:       prefix.Addr(),
+		prefix:       prefix,
+		peers:        peers,
+		reservations: reservations,
+	}, nil
 }
@@ -0,0 +1,113 @@
+package pairing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIPPool(t *testing.T, peers PeerStorage) IPAM {
+	pool, poolErr := NewIPPool("10.188.0.1/24", peers, NewInMemoryIPReservationStorage())
+	assert.NoError(t, poolErr)
+	return pool
+}
+
+func TestIPPoolAssignsAddressesWithinSubnet(t *testing.T) {
+	// given
+	peers := NewInMemoryPeerStorage()
+	pool, poolErr := NewIPPool("10.188.0.1/30", peers, NewInMemoryIPReservationStorage())
+	assert.NoError(t, poolErr)
+
+	// when
+	first, firstErr := pool.Next("client1")
+	assert.NoError(t, peers.Store(PeerInfo{Name: "client1", IP: first}))
+	_, secondErr := pool.Next("client2")
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.Equal(t, "10.188.0.2", first)
+	assert.ErrorIs(t, secondErr, ErrIPPoolExhausted)
+}
+
+func TestIPPoolReusesFreedAddresses(t *testing.T) {
+	// given
+	peers := NewInMemoryPeerStorage()
+	pool := newTestIPPool(t, peers)
+	for _, name := range []string{"client1", "client2", "client3"} {
+		ip, nextErr := pool.Next(name)
+		assert.NoError(t, nextErr)
+		assert.NoError(t, peers.Store(PeerInfo{Name: name, IP: ip}))
+	}
+
+	// when
+	assert.NoError(t, peers.DeleteByName("client2"))
+	ip, nextErr := pool.Next("client4")
+
+	// then
+	assert.NoError(t, nextErr)
+	assert.Equal(t, "10.188.0.3", ip)
+}
+
+func TestIPPoolHonorsReservations(t *testing.T) {
+	// given
+	peers := NewInMemoryPeerStorage()
+	pool := newTestIPPool(t, peers)
+	assert.NoError(t, pool.Reserve(IPReservation{Name: "client2", IP: "10.188.0.2"}))
+
+	// when
+	reservedIP, reservedErr := pool.Next("client2")
+	otherIP, otherErr := pool.Next("client1")
+
+	// then
+	assert.NoError(t, reservedErr)
+	assert.NoError(t, otherErr)
+	assert.Equal(t, "10.188.0.2", reservedIP)
+	assert.Equal(t, "10.188.0.3", otherIP)
+}
+
+func TestIPPoolRejectsInvalidReservations(t *testing.T) {
+	peers := NewInMemoryPeerStorage()
+	assert.NoError(t, peers.Store(PeerInfo{Name: "client1", IP: "10.188.0.2"}))
+	pool := newTestIPPool(t, peers)
+	tests := []struct {
+		name        string
+		reservation IPReservation
+		expectErr   bool
+	}{
+		{name: "Free address", reservation: IPReservation{Name: "client2", IP: "10.188.0.10"}},
+		{name: "Own address", reservation: IPReservation{Name: "client1", IP: "10.188.0.2"}},
+		{name: "Used by other peer", reservation: IPReservation{Name: "client2", IP: "10.188.0.2"}, expectErr: true},
+		{name: "Server address", reservation: IPReservation{Name: "client2", IP: "10.188.0.1"}, expectErr: true},
+		{name: "Network address", reservation: IPReservation{Name: "client2", IP: "10.188.0.0"}, expectErr: true},
+		{name: "Broadcast address", reservation: IPReservation{Name: "client2", IP: "10.188.0.255"}, expectErr: true},
+		{name: "Outside of subnet", reservation: IPReservation{Name: "client2", IP: "10.188.1.2"}, expectErr: true},
+		{name: "Invalid address", reservation: IPReservation{Name: "client2", IP: "foo"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pool.Reserve(tt.reservation)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestIPPoolAssignsIPv6Addresses(t *testing.T) {
+	// given
+	peers := NewInMemoryPeerStorage()
+	pool, poolErr := NewIPPool("fd00:188::1/64", peers, NewInMemoryIPReservationStorage())
+	assert.NoError(t, poolErr)
+
+	// when
+	ip, nextErr := pool.Next("client1")
+	reserveErr := pool.Reserve(IPReservation{Name: "client2", IP: "fd00:188::ffff"})
+
+	// then
+	assert.NoError(t, nextErr)
+	assert.NoError(t, reserveErr)
+	assert.Equal(t, "fd00:188::2", ip)
+}
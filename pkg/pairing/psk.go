@@ -1,31 +1,116 @@
 package pairing
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/metrics"
 )
 
+// pskKey is a pre-shared key, that the server accepts
+type pskKey struct {
+	psk    string
+	invite string // Name of the invite, empty for the global key
+}
+
+// PSKOption allows customizing the PSK transports
+type PSKOption func(*pskSettings)
+
+type pskSettings struct {
+	legacy bool
+}
+
+// WithLegacyPSK enables the legacy PSK scheme, that truncates or pads the key instead of
+// deriving it and does not protect against replays. Servers reject legacy requests unless
+// it's set, then they accept both schemes. Clients use the legacy one, so they can pair
+// with servers, that do not support the current one.
+func WithLegacyPSK() PSKOption {
+	return func(s *pskSettings) {
+		s.legacy = true
+	}
+}
+
+func newPSKSettings(opts []PSKOption) pskSettings {
+	var settings pskSettings
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	return settings
+}
+
 type pskPairingServerTransport struct {
-	psk   string
-	child ServerTransport
+	keys     func() ([]pskKey, error)
+	child    ServerTransport
+	settings pskSettings
+	replays  *replayCache
+}
+
+// decrypt decrypts the request with the first of the keys, that is able to do it. The binding
+// of the request is returned for the current scheme, so the response can be bound to it.
+func (t *pskPairingServerTransport) decrypt(request []byte) ([]byte, pskKey, []byte, error) {
+	keys, keysErr := t.keys()
+	if keysErr != nil {
+		return nil, pskKey{}, nil, keysErr
+	}
+	isV2 := bytes.HasPrefix(request, pskV2Header)
+	decryptErr := errors.New("no keys configured")
+	if !isV2 && !t.settings.legacy {
+		decryptErr = errors.New("request uses the legacy PSK scheme, which is disabled")
+	}
+	for _, key := range keys {
+		if isV2 {
+			msg, openErr := openPSKV2([]byte(key.psk), request, nil)
+			if openErr == nil {
+				if replayErr := t.replays.check(msg, time.Now()); replayErr != nil {
+					return nil, pskKey{}, nil, replayErr
+				}
+				return msg.plaintext, key, msg.binding, nil
+			}
+			decryptErr = openErr
+		}
+		if t.settings.legacy {
+			decrypted, aesError := AesDecrypt([]byte(key.psk), request)
+			if aesError == nil {
+				return decrypted, key, nil, nil
+			}
+			decryptErr = aesError
+		}
+	}
+	return nil, pskKey{}, nil, decryptErr
+}
+
+func (t *pskPairingServerTransport) encrypt(key pskKey, response, binding []byte) ([]byte, error) {
+	if binding == nil {
+		return AesEncrypt([]byte(key.psk), response)
+	}
+	encrypted, _, sealErr := sealPSKV2([]byte(key.psk), response, binding, time.Now())
+	return encrypted, sealErr
 }
 
 func (t *pskPairingServerTransport) Requests() <-chan IncomingPairingRequest {
 	theChan := make(chan IncomingPairingRequest)
 	go func() {
+		// The child closes its channel once all its requests were responded to, so all the
+		// decrypted requests were handled as well
+		defer close(theChan)
 		for childReq := range t.child.Requests() {
-			decrypted, aesError := AesDecrypt([]byte(t.psk), childReq.Request)
+			decrypted, key, binding, aesError := t.decrypt(childReq.Request)
 			if aesError != nil {
+				metrics.PairingRequests.WithLabelValues(metrics.PairingOutcomeUnauthorized).Inc()
 				childReq.Err <- fmt.Errorf("failed to decrypt request: %v", aesError)
 				continue
 			}
 
 			newRequest := IncomingPairingRequest{
 				Request:  decrypted,
+				Identity: childReq.Identity,
+				Invite:   key.invite,
 				Response: make(chan []byte),
 				Err:      make(chan error),
 			}
@@ -35,9 +120,9 @@ func (t *pskPairingServerTransport) Requests() <-chan IncomingPairingRequest {
 				case e := <-newRequest.Err:
 					childReq.Err <- e
 				case r := <-newRequest.Response:
-					newResponse, aesError := AesEncrypt([]byte(t.psk), r)
+					newResponse, aesError := t.encrypt(key, r, binding)
 					if aesError != nil {
-						newRequest.Err <- fmt.Errorf("failed to encrypt response: %v", aesError)
+						childReq.Err <- fmt.Errorf("failed to encrypt response: %v", aesError)
 						return
 					}
 					childReq.Response <- newResponse
@@ -51,19 +136,71 @@ func (t *pskPairingServerTransport) Requests() <-chan IncomingPairingRequest {
 
 // NewPSKPairingServerTransport creates a new PairingServerTransport, that encrypts and
 // decrypts requests using the provided pre-shared key (psk).
-func NewPSKPairingServerTransport(psk string, child ServerTransport) ServerTransport {
+func NewPSKPairingServerTransport(psk string, child ServerTransport, opts ...PSKOption) ServerTransport {
 	return &pskPairingServerTransport{
 		child: child,
-		psk:   psk,
+		keys: func() ([]pskKey, error) {
+			return []pskKey{{psk: psk}}, nil
+		},
+		settings: newPSKSettings(opts),
+		replays:  newReplayCache(),
+	}
+}
+
+// NewInvitesPSKPairingServerTransport creates a new PairingServerTransport, that decrypts
+// requests using tokens of the invites, or the global pre-shared key (psk), if set. Whether
+// the invite is still usable is checked by the server, as already paired peers may reuse it.
+// Responses are encrypted using the same key as the request.
+func NewInvitesPSKPairingServerTransport(
+	psk string, invites InviteStorage, child ServerTransport, opts ...PSKOption,
+) ServerTransport {
+	return &pskPairingServerTransport{
+		child: child,
+		keys: func() ([]pskKey, error) {
+			var keys []pskKey
+			if psk != "" {
+				keys = append(keys, pskKey{psk: psk})
+			}
+			allInvites, listErr := invites.List()
+			if listErr != nil {
+				return nil, listErr
+			}
+			for _, invite := range allInvites {
+				keys = append(keys, pskKey{psk: invite.Token, invite: invite.Name})
+			}
+			return keys, nil
+		},
+		settings: newPSKSettings(opts),
+		replays:  newReplayCache(),
 	}
 }
 
 type pskPairingClientTransport struct {
-	psk   string
-	child ClientTransport
+	psk      string
+	child    ClientTransport
+	settings pskSettings
 }
 
 func (t *pskPairingClientTransport) Send(req []byte) ([]byte, error) {
+	if t.settings.legacy {
+		return t.sendLegacy(req)
+	}
+	encrypted, binding, sealErr := sealPSKV2([]byte(t.psk), req, nil, time.Now())
+	if sealErr != nil {
+		return nil, fmt.Errorf("failed to encrypt request: %v", sealErr)
+	}
+	childResp, sendErr := t.child.Send(encrypted)
+	if sendErr != nil {
+		return nil, sendErr
+	}
+	msg, openErr := openPSKV2([]byte(t.psk), childResp, binding)
+	if openErr != nil {
+		return nil, fmt.Errorf("failed to decrypt response: %v", openErr)
+	}
+	return msg.plaintext, nil
+}
+
+func (t *pskPairingClientTransport) sendLegacy(req []byte) ([]byte, error) {
 	encrypted, aesError := AesEncrypt([]byte(t.psk), req)
 	if aesError != nil {
 		return nil, fmt.Errorf("failed to encrypt request: %v", aesError)
@@ -81,10 +218,11 @@ func (t *pskPairingClientTransport) Send(req []byte) ([]byte, error) {
 
 // NewPSKClientPairingTransport creates a new PairingClientTransport, that encrypts and
 // decrypts requests using the provided pre-shared key (psk).
-func NewPSKClientPairingTransport(psk string, child ClientTransport) ClientTransport {
+func NewPSKClientPairingTransport(psk string, child ClientTransport, opts ...PSKOption) ClientTransport {
 	return &pskPairingClientTransport{
-		child: child,
-		psk:   psk,
+		child:    child,
+		psk:      psk,
+		settings: newPSKSettings(opts),
 	}
 }
 
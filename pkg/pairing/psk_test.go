@@ -2,6 +2,7 @@ package pairing
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -20,3 +21,118 @@ func TestEncryptDecrypt(t *testing.T) {
 	assert.NoError(t, decryptErr)
 	assert.Equal(t, plaintext, string(decryptedPlaintext))
 }
+
+func newEchoPSKServer(psk string, opts ...PSKOption) *mockServerTransport {
+	child := &mockServerTransport{requests: make(chan IncomingPairingRequest)}
+	transport := NewPSKPairingServerTransport(psk, child, opts...)
+	go func() {
+		for req := range transport.Requests() {
+			req.Response <- append([]byte("echo: "), req.Request...)
+		}
+	}()
+	return child
+}
+
+func TestPSKV2RoundTrip(t *testing.T) {
+	// given
+	client := NewPSKClientPairingTransport("1337huehuehue", &forwardingClientTransport{newEchoPSKServer("1337huehuehue")})
+
+	// when
+	resp, sendErr := client.Send([]byte("Hello, World!"))
+
+	// then
+	assert.NoError(t, sendErr)
+	assert.Equal(t, "echo: Hello, World!", string(resp))
+}
+
+func TestPSKV2WrongKeyIsRejected(t *testing.T) {
+	// given
+	client := NewPSKClientPairingTransport("wrong-key", &forwardingClientTransport{newEchoPSKServer("1337huehuehue")})
+
+	// when
+	_, sendErr := client.Send([]byte("Hello, World!"))
+
+	// then
+	assert.Error(t, sendErr)
+}
+
+func TestPSKV2ReplayedRequestIsRejected(t *testing.T) {
+	// given
+	server := &forwardingClientTransport{newEchoPSKServer("1337huehuehue")}
+	request, _, sealErr := sealPSKV2([]byte("1337huehuehue"), []byte("Hello, World!"), nil, time.Now())
+	assert.NoError(t, sealErr)
+
+	// when
+	_, firstErr := server.Send(request)
+	_, replayErr := server.Send(request)
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.ErrorContains(t, replayErr, "replay")
+}
+
+func TestPSKV2StaleRequestIsRejected(t *testing.T) {
+	// given
+	server := &forwardingClientTransport{newEchoPSKServer("1337huehuehue")}
+	request, _, sealErr := sealPSKV2(
+		[]byte("1337huehuehue"), []byte("Hello, World!"), nil, time.Now().Add(-2*pskMaxClockSkew),
+	)
+	assert.NoError(t, sealErr)
+
+	// when
+	_, sendErr := server.Send(request)
+
+	// then
+	assert.ErrorContains(t, sendErr, "timestamp")
+}
+
+func TestPSKV2ResponseIsBoundToRequest(t *testing.T) {
+	// given
+	psk := []byte("1337huehuehue")
+	server := &forwardingClientTransport{newEchoPSKServer(string(psk))}
+	first, firstBinding, _ := sealPSKV2(psk, []byte("first"), nil, time.Now())
+	_, secondBinding, _ := sealPSKV2(psk, []byte("second"), nil, time.Now())
+
+	// when
+	resp, sendErr := server.Send(first)
+	_, firstOpenErr := openPSKV2(psk, resp, firstBinding)
+	_, secondOpenErr := openPSKV2(psk, resp, secondBinding)
+
+	// then
+	assert.NoError(t, sendErr)
+	assert.NoError(t, firstOpenErr)
+	assert.Error(t, secondOpenErr)
+}
+
+func TestPSKLegacyRequiresCompatibilityFlag(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverOpts    []PSKOption
+		expectSuccess bool
+	}{
+		{name: "Legacy disabled", serverOpts: nil, expectSuccess: false},
+		{name: "Legacy enabled", serverOpts: []PSKOption{WithLegacyPSK()}, expectSuccess: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			client := NewPSKClientPairingTransport(
+				"1337huehuehue",
+				&forwardingClientTransport{newEchoPSKServer("1337huehuehue", tt.serverOpts...)},
+				WithLegacyPSK(),
+			)
+
+			// when
+			resp, sendErr := client.Send([]byte("Hello, World!"))
+
+			// then
+			if tt.expectSuccess {
+				assert.NoError(t, sendErr)
+				assert.Equal(t, "echo: Hello, World!", string(resp))
+			} else {
+				assert.Error(t, sendErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package pairing
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// pskV2Header starts every message encrypted using the second version of the PSK scheme.
+// Legacy messages start with a random nonce, so they are told apart by failing to decrypt.
+var pskV2Header = []byte{'w', 'h', 0x02}
+
+const (
+	pskV2SaltSize      = 16
+	pskV2TimestampSize = 8
+	pskV2Info          = "wormhole pairing psk v2"
+
+	// pskMaxClockSkew is the maximum difference between the timestamp of the request and the
+	// server clock. Nonces of the requests are remembered for twice that long to block replays.
+	pskMaxClockSkew = 2 * time.Minute
+)
+
+var errNotPSKV2 = errors.New("not encrypted using PSK v2 scheme")
+
+// pskV2Message is a decrypted message of the second version of the PSK scheme
+type pskV2Message struct {
+	plaintext []byte
+	timestamp time.Time
+	// binding identifies the message, responses are authenticated together with the binding
+	// of the request, so they cannot be replayed in response to other requests
+	binding []byte
+}
+
+// deriveKey derives the AES key from the psk. HKDF is used instead of a password hashing
+// function, as the server may need to try many keys (invites) for every request.
+func deriveKey(psk, salt []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, psk, salt, []byte(pskV2Info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newPSKV2Cipher(psk, salt []byte) (cipher.AEAD, error) {
+	key, keyErr := deriveKey(psk, salt)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	block, blockErr := aes.NewCipher(key)
+	if blockErr != nil {
+		return nil, blockErr
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealPSKV2 encrypts the plaintext using the second version of the PSK scheme. The message
+// is authenticated together with its header, timestamp and the given binding.
+func sealPSKV2(psk, plaintext, binding []byte, now time.Time) ([]byte, []byte, error) {
+	salt := make([]byte, pskV2SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, err
+	}
+	aesGCM, cipherErr := newPSKV2Cipher(psk, salt)
+	if cipherErr != nil {
+		return nil, nil, cipherErr
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	message := append([]byte{}, pskV2Header...)
+	message = append(message, salt...)
+	message = binary.BigEndian.AppendUint64(message, uint64(now.Unix()))
+	message = append(message, nonce...)
+	additionalData := append(append([]byte{}, message...), binding...)
+	return aesGCM.Seal(message, nonce, plaintext, additionalData), append(salt, nonce...), nil
+}
+
+// openPSKV2 decrypts the message encrypted using sealPSKV2 with the same binding
+func openPSKV2(psk, message, binding []byte) (pskV2Message, error) {
+	if !bytes.HasPrefix(message, pskV2Header) {
+		return pskV2Message{}, errNotPSKV2
+	}
+	rest := message[len(pskV2Header):]
+	if len(rest) < pskV2SaltSize+pskV2TimestampSize {
+		return pskV2Message{}, errors.New("ciphertext too short")
+	}
+	salt := rest[:pskV2SaltSize]
+	timestamp := int64(binary.BigEndian.Uint64(rest[pskV2SaltSize : pskV2SaltSize+pskV2TimestampSize])) // nolint: gosec
+	aesGCM, cipherErr := newPSKV2Cipher(psk, salt)
+	if cipherErr != nil {
+		return pskV2Message{}, cipherErr
+	}
+	headerSize := len(pskV2Header) + pskV2SaltSize + pskV2TimestampSize + aesGCM.NonceSize()
+	if len(message) < headerSize {
+		return pskV2Message{}, errors.New("ciphertext too short")
+	}
+	nonce := message[headerSize-aesGCM.NonceSize() : headerSize]
+	additionalData := append(append([]byte{}, message[:headerSize]...), binding...)
+	plaintext, openErr := aesGCM.Open(nil, nonce, message[headerSize:], additionalData)
+	if openErr != nil {
+		return pskV2Message{}, openErr
+	}
+	return pskV2Message{
+		plaintext: plaintext,
+		timestamp: time.Unix(timestamp, 0),
+		binding:   append(append([]byte{}, salt...), nonce...),
+	}, nil
+}
+
+// replayCache remembers the requests seen recently, so they cannot be replayed
+type replayCache struct {
+	lock sync.Mutex
+	seen map[string]time.Time
+}
+
+// check verifies that the message is recent and was not seen before, remembering it
+func (c *replayCache) check(msg pskV2Message, now time.Time) error {
+	if msg.timestamp.Before(now.Add(-pskMaxClockSkew)) || msg.timestamp.After(now.Add(pskMaxClockSkew)) {
+		return fmt.Errorf("request timestamp %s is too far from the server time", msg.timestamp.UTC())
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for binding, expiresAt := range c.seen {
+		if now.After(expiresAt) {
+			delete(c.seen, binding)
+		}
+	}
+	if _, seen := c.seen[string(msg.binding)]; seen {
+		return errors.New("request was already processed, possible replay attack")
+	}
+	c.seen[string(msg.binding)] = now.Add(2 * pskMaxClockSkew)
+	return nil
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{seen: make(map[string]time.Time)}
+}
@@ -0,0 +1,133 @@
+package pairing
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrIPReservationDoesNotExist is returned when a peer has no reserved IP address
+var ErrIPReservationDoesNotExist = errors.New("IP reservation does not exist")
+
+// IPReservation is a static IP address, that is assigned to the peer with the given name
+type IPReservation struct {
+	Name string `json:"name"`
+	IP   string `json:"ip"`
+}
+
+// IPReservationStorage is an interface for storing and retrieving IP reservations
+type IPReservationStorage interface {
+	Store(IPReservation) error
+	GetByName(string) (IPReservation, error)
+	List() ([]IPReservation, error)
+	DeleteByName(string) error
+}
+
+type inMemoryIPReservationStorage struct {
+	reservations sync.Map
+}
+
+func (s *inMemoryIPReservationStorage) Store(reservation IPReservation) error {
+	s.reservations.Store(reservation.Name, reservation)
+	return nil
+}
+
+func (s *inMemoryIPReservationStorage) GetByName(name string) (IPReservation, error) {
+	if reservation, ok := s.reservations.Load(name); ok {
+		return reservation.(IPReservation), nil
+	}
+	return IPReservation{}, ErrIPReservationDoesNotExist
+}
+
+func (s *inMemoryIPReservationStorage) List() ([]IPReservation, error) {
+	var reservations []IPReservation
+	s.reservations.Range(func(_, value any) bool {
+		reservations = append(reservations, value.(IPReservation))
+		return true
+	})
+	return reservations, nil
+}
+
+func (s *inMemoryIPReservationStorage) DeleteByName(name string) error {
+	s.reservations.Delete(name)
+	return nil
+}
+
+// NewInMemoryIPReservationStorage creates a new in-memory IPReservationStorage instance
+func NewInMemoryIPReservationStorage() IPReservationStorage {
+	return &inMemoryIPReservationStorage{}
+}
+
+type boltIPReservationStorage struct {
+	db *bolt.DB
+}
+
+func (s *boltIPReservationStorage) Store(reservation IPReservation) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("reservations"))
+		encoded, encodeErr := json.Marshal(reservation)
+		if encodeErr != nil {
+			return encodeErr
+		}
+		return b.Put([]byte(reservation.Name), encoded)
+	})
+}
+
+func (s *boltIPReservationStorage) GetByName(name string) (IPReservation, error) {
+	var reservation IPReservation
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("reservations"))
+		payload := b.Get([]byte(name))
+		if payload == nil {
+			return ErrIPReservationDoesNotExist
+		}
+		return json.Unmarshal(payload, &reservation)
+	})
+	return reservation, err
+}
+
+func (s *boltIPReservationStorage) List() ([]IPReservation, error) {
+	var reservations []IPReservation
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("reservations"))
+		return b.ForEach(func(_, v []byte) error {
+			var reservation IPReservation
+			if err := json.Unmarshal(v, &reservation); err != nil {
+				return err
+			}
+			reservations = append(reservations, reservation)
+			return nil
+		})
+	})
+	return reservations, err
+}
+
+func (s *boltIPReservationStorage) DeleteByName(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("reservations"))
+		return b.Delete([]byte(name))
+	})
+}
+
+// Close closes the database
+func (s *boltIPReservationStorage) Close() error {
+	return s.db.Close()
+}
+
+// NewBoltIPReservationStorage creates a new BoltDB (persistent, on-disk storage) IPReservationStorage instance
+func NewBoltIPReservationStorage(path string) IPReservationStorage {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		logrus.Panicf("failed to open bolt db: %v", err)
+	}
+	if updateErr := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("reservations"))
+		return err
+	}); updateErr != nil {
+		logrus.Panicf("failed to create BoltDB bucket: %v", updateErr)
+	}
+	return &boltIPReservationStorage{db: db}
+}
@@ -0,0 +1,155 @@
+package pairing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyRotation is attached to pairing requests of peers, that replace their Wireguard key pair.
+// It proves, that the peer possesses the private key of the previous pair.
+type KeyRotation struct {
+	PreviousPublicKey string `json:"previous_public_key"`
+	// Proof is the name of the peer and its new public key, encrypted using the previous
+	// private key of the peer and the public key of the server
+	Proof []byte `json:"proof"`
+}
+
+func keyRotationPayload(peerName, newPublicKey string) []byte {
+	return []byte(fmt.Sprintf("wormhole key rotation\n%s\n%s", peerName, newPublicKey))
+}
+
+// NewKeyRotation creates a new KeyRotation for the peer replacing the previous key pair with
+// the one, that has the new public key
+func NewKeyRotation(peerName string, previous KeyPair, newPublicKey, serverPublicKey string) (*KeyRotation, error) {
+	proof, encryptErr := wg.Encrypt(keyRotationPayload(peerName, newPublicKey), previous.PrivateKey, serverPublicKey)
+	if encryptErr != nil {
+		return nil, encryptErr
+	}
+	return &KeyRotation{
+		PreviousPublicKey: previous.PublicKey,
+		Proof:             proof,
+	}, nil
+}
+
+// Verify checks if the rotation was created by the owner of the previous key pair
+func (r *KeyRotation) Verify(peerName, newPublicKey string, server KeyPair) error {
+	payload, decryptErr := wg.Decrypt(r.Proof, server.PrivateKey, r.PreviousPublicKey)
+	if decryptErr != nil {
+		return fmt.Errorf("invalid key rotation proof: %w", decryptErr)
+	}
+	if !bytes.Equal(payload, keyRotationPayload(peerName, newPublicKey)) {
+		return errors.New("key rotation proof was issued for a different peer or key")
+	}
+	return nil
+}
+
+// KeyRotatingClient is a Client, that is also able to replace the key pair it paired with
+type KeyRotatingClient interface {
+	Client
+	// Rotate pairs with the server using the new key pair, keeping the name and the assigned IP
+	Rotate(serverPublicKey string, newKeyPair KeyPair) (Response, error)
+}
+
+// KeyRotator replaces the Wireguard key pair of a paired client
+type KeyRotator struct {
+	lock   sync.Mutex
+	client KeyRotatingClient
+	cache  KeyCachingPairingClientStorage
+	keys   wg.KeyStorage
+}
+
+// Rotate generates a new key pair and replaces the current one with it. If the previous
+// rotation did not complete, its key pair is used instead, as the server may already have it.
+func (r *KeyRotator) Rotate() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	cached, getErr := r.cache.Get()
+	if getErr != nil {
+		return fmt.Errorf("cannot rotate keys before pairing with the server: %w", getErr)
+	}
+	private, public, _, loadErr := r.keys.LoadPending()
+	if loadErr == wg.ErrNoPendingKeyPair {
+		var generateErr error
+		if private, public, generateErr = wg.GenerateKeyPair(); generateErr != nil {
+			return generateErr
+		}
+		// Persisted before contacting the server, so the rotation can be resumed after a crash
+		if storeErr := r.keys.StorePending(private, public, time.Time{}); storeErr != nil {
+			return fmt.Errorf("failed to store the new key pair: %w", storeErr)
+		}
+	} else if loadErr != nil {
+		return loadErr
+	}
+	return r.rotateTo(cached.Wireguard.PublicKey, KeyPair{PublicKey: public, PrivateKey: private})
+}
+
+// Resume completes the rotation interrupted by a restart, if any. It should be called
+// before pairing, as the server may already know only the pending key pair.
+func (r *KeyRotator) Resume() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	private, public, _, loadErr := r.keys.LoadPending()
+	if loadErr == wg.ErrNoPendingKeyPair {
+		return nil
+	} else if loadErr != nil {
+		return loadErr
+	}
+	cached, getErr := r.cache.Get()
+	if getErr != nil {
+		// Never paired, so the server does not know any of the keys
+		return r.keys.ClearPending()
+	}
+	logrus.Infof("Resuming interrupted rotation to Wireguard public key %s", public)
+	return r.rotateTo(cached.Wireguard.PublicKey, KeyPair{PublicKey: public, PrivateKey: private})
+}
+
+func (r *KeyRotator) rotateTo(serverPublicKey string, keyPair KeyPair) error {
+	response, rotateErr := r.client.Rotate(serverPublicKey, keyPair)
+	if rotateErr != nil {
+		return rotateErr
+	}
+	if storeErr := r.keys.Store(keyPair.PrivateKey, keyPair.PublicKey); storeErr != nil {
+		return fmt.Errorf("keys were rotated, but failed to store the new key pair: %w", storeErr)
+	}
+	if clearErr := r.keys.ClearPending(); clearErr != nil {
+		logrus.Errorf("Failed to clear the pending key pair: %v", clearErr)
+	}
+	if setErr := r.cache.Set(response); setErr != nil {
+		logrus.Errorf("Failed to store pairing response: %v", setErr)
+	}
+	logrus.Infof("Rotated Wireguard key pair, new public key: %s", keyPair.PublicKey)
+	return nil
+}
+
+// RotateEvery rotates the keys in given intervals, it blocks until the context is done
+func (r *KeyRotator) RotateEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if rotateErr := r.Rotate(); rotateErr != nil {
+				logrus.Errorf("Failed to rotate Wireguard key pair: %v", rotateErr)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// NewKeyRotator creates a new KeyRotator instance. The cache is used to obtain the public key of
+// the server, the new key pair is persisted in the key storage.
+func NewKeyRotator(client KeyRotatingClient, cache KeyCachingPairingClientStorage, keys wg.KeyStorage) *KeyRotator {
+	return &KeyRotator{
+		client: client,
+		cache:  cache,
+		keys:   keys,
+	}
+}
@@ -0,0 +1,134 @@
+package pairing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRotationTestServer(t *testing.T, peers PeerStorage) (KeyPair, *forwardingClientTransport) {
+	server, serverKeys, child := newTestServer(t, peers, nil)
+	go server.Start(context.Background())
+	return serverKeys, &forwardingClientTransport{child}
+}
+
+func TestKeyRotationKeepsNameAndIP(t *testing.T) {
+	// given
+	peers := NewInMemoryPeerStorage()
+	serverKeys, transport := newRotationTestServer(t, peers)
+	wgConfig := &wg.Config{}
+	client := NewDefaultPairingClient(
+		"client1", wgConfig, generateTestKeyPair(t), &noOpWireguardReloader{}, NewJSONPairingEncoder(), transport,
+	)
+	paired, pairErr := client.Pair()
+	assert.NoError(t, pairErr)
+	newKeys := generateTestKeyPair(t)
+
+	// when
+	rotated, rotateErr := client.Rotate(serverKeys.PublicKey, newKeys)
+
+	// then
+	assert.NoError(t, rotateErr)
+	assert.Equal(t, paired.AssignedIP, rotated.AssignedIP)
+	stored, getErr := peers.GetByName("client1")
+	assert.NoError(t, getErr)
+	assert.Equal(t, newKeys.PublicKey, stored.PublicKey)
+	assert.Equal(t, paired.AssignedIP, stored.IP)
+	assert.Equal(t, newKeys.PrivateKey, wgConfig.PrivateKey)
+}
+
+func TestKeyRotationRequiresPreviousKey(t *testing.T) {
+	// given
+	peers := NewInMemoryPeerStorage()
+	serverKeys, transport := newRotationTestServer(t, peers)
+	owner := NewDefaultPairingClient(
+		"client1", &wg.Config{}, generateTestKeyPair(t), &noOpWireguardReloader{}, NewJSONPairingEncoder(), transport,
+	)
+	_, pairErr := owner.Pair()
+	assert.NoError(t, pairErr)
+	stored, _ := peers.GetByName("client1")
+	impostorKeys := generateTestKeyPair(t)
+	impostorKeys.PublicKey = stored.PublicKey
+	impostor := NewDefaultPairingClient(
+		"client1", &wg.Config{}, impostorKeys, &noOpWireguardReloader{}, NewJSONPairingEncoder(), transport,
+	)
+
+	// when
+	_, rotateErr := impostor.Rotate(serverKeys.PublicKey, generateTestKeyPair(t))
+
+	// then
+	assert.Error(t, rotateErr)
+	afterRotation, _ := peers.GetByName("client1")
+	assert.Equal(t, stored.PublicKey, afterRotation.PublicKey)
+}
+
+func TestKeyRotationProofIsBoundToNewKey(t *testing.T) {
+	// given
+	serverKeys := generateTestKeyPair(t)
+	previous := generateTestKeyPair(t)
+	newKeys := generateTestKeyPair(t)
+	rotation, rotationErr := NewKeyRotation("client1", previous, newKeys.PublicKey, serverKeys.PublicKey)
+	assert.NoError(t, rotationErr)
+
+	// when
+	validErr := rotation.Verify("client1", newKeys.PublicKey, serverKeys)
+	otherKeyErr := rotation.Verify("client1", generateTestKeyPair(t).PublicKey, serverKeys)
+	otherPeerErr := rotation.Verify("client2", newKeys.PublicKey, serverKeys)
+
+	// then
+	assert.NoError(t, validErr)
+	assert.Error(t, otherKeyErr)
+	assert.Error(t, otherPeerErr)
+}
+
+func TestKeyRotatorResumesInterruptedRotation(t *testing.T) {
+	tests := []struct {
+		name            string
+		serverHasNewKey bool
+	}{
+		{name: "interrupted before contacting the server"},
+		{name: "interrupted after the server accepted the new key", serverHasNewKey: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			peers := NewInMemoryPeerStorage()
+			serverKeys, transport := newRotationTestServer(t, peers)
+			oldKeys, newKeys := generateTestKeyPair(t), generateTestKeyPair(t)
+			keys := wg.NewInMemoryKeyStorage()
+			assert.NoError(t, keys.Store(oldKeys.PrivateKey, oldKeys.PublicKey))
+			assert.NoError(t, keys.StorePending(newKeys.PrivateKey, newKeys.PublicKey, time.Time{}))
+			cache := NewInMemoryKeyCachingPairingClientStorage()
+			beforeRestart := NewDefaultPairingClient(
+				"client1", &wg.Config{}, oldKeys, &noOpWireguardReloader{}, NewJSONPairingEncoder(), transport,
+			)
+			paired, pairErr := beforeRestart.Pair()
+			assert.NoError(t, pairErr)
+			assert.NoError(t, cache.Set(paired))
+			if tt.serverHasNewKey {
+				_, rotateErr := beforeRestart.Rotate(serverKeys.PublicKey, newKeys)
+				assert.NoError(t, rotateErr)
+			}
+			afterRestart := NewDefaultPairingClient(
+				"client1", &wg.Config{}, oldKeys, &noOpWireguardReloader{}, NewJSONPairingEncoder(), transport,
+			)
+
+			// when
+			resumeErr := NewKeyRotator(afterRestart, cache, keys).Resume()
+
+			// then
+			assert.NoError(t, resumeErr)
+			private, public, loadErr := keys.Load()
+			assert.NoError(t, loadErr)
+			assert.Equal(t, newKeys, KeyPair{PublicKey: public, PrivateKey: private})
+			_, _, _, pendingErr := keys.LoadPending()
+			assert.Equal(t, wg.ErrNoPendingKeyPair, pendingErr)
+			stored, getErr := peers.GetByName("client1")
+			assert.NoError(t, getErr)
+			assert.Equal(t, newKeys.PublicKey, stored.PublicKey)
+		})
+	}
+}
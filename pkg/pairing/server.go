@@ -1,11 +1,17 @@
 package pairing
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/glothriel/wormhole/pkg/metrics"
+	"github.com/glothriel/wormhole/pkg/tracing"
 	"github.com/glothriel/wormhole/pkg/wg"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Server is a server that can pair with multiple clients
@@ -14,108 +20,264 @@ type Server struct {
 	publicWgHostPort string     // Public Wireguard host:port
 	wgConfig         *wg.Config // Local Wireguard config
 	keyPair          KeyPair    // Local Wireguard key pair
+	keyRotator       *ServerKeyRotator
+	configLock       sync.Locker
 
 	wgReloader wg.WireguardConfigReloader
 	marshaler  Encoder
+	encoders   []Encoder
+	invites    InviteStorage
 	transport  ServerTransport
 	ips        IPPool
 	storage    PeerStorage
 	enrichers  []MetadataEnricher
 }
 
-// Start starts the pairing server
-func (s *Server) Start() { // nolint: funlen, gocognit
-	for incomingRequest := range s.transport.Requests() {
-		request, requestErr := s.marshaler.DecodeRequest(incomingRequest.Request)
-		if requestErr != nil {
-			incomingRequest.Err <- NewClientError(requestErr)
-			continue
+// ServerOption allows customizing the pairing server
+type ServerOption func(*Server)
+
+// WithEncoders makes the server accept pairing requests encoded using any of the given
+// encoders, besides the default one. The server responds using the same encoder as the request.
+func WithEncoders(encoders ...Encoder) ServerOption {
+	return func(s *Server) {
+		s.encoders = append(s.encoders, encoders...)
+	}
+}
+
+// WithInvites makes the server honor the invites, that the requests were encrypted with. Each
+// new peer paired using an invite counts as its use.
+func WithInvites(invites InviteStorage) ServerOption {
+	return func(s *Server) {
+		s.invites = invites
+	}
+}
+
+// WithServerKeyRotator makes the server respond with the current key of the rotator and
+// accept key rotations of the peers proven using either the current or the previous key
+func WithServerKeyRotator(rotator *ServerKeyRotator) ServerOption {
+	return func(s *Server) {
+		s.keyRotator = rotator
+	}
+}
+
+// WithConfigLock makes the server hold the lock while updating the Wireguard config, so it can
+// be shared with other components modifying the same config, like PeerDeleter
+func WithConfigLock(lock sync.Locker) ServerOption {
+	return func(s *Server) {
+		s.configLock = lock
+	}
+}
+
+// keyPairs returns the current key pair of the server, followed by the previous one, if any
+func (s *Server) keyPairs() []KeyPair {
+	if s.keyRotator == nil {
+		return []KeyPair{s.keyPair}
+	}
+	return s.keyRotator.KeyPairs()
+}
+
+// authorize checks if the peer may pair using the certificate or invite the request came with.
+// The invite, if any, is returned, so it can be checked and marked as used if the peer is new.
+// Already paired peers may re-pair and rotate their keys using a used up or expired invite.
+func (s *Server) authorize(incomingRequest IncomingPairingRequest, request Request) (*Invite, error) {
+	if incomingRequest.Identity != "" && incomingRequest.Identity != request.Name {
+		logrus.Errorf(
+			"attempted peering as `%s` using certificate issued for `%s`",
+			request.Name, incomingRequest.Identity,
+		)
+		return nil, NewClientError(errors.New("peer name does not match the certificate"))
+	}
+	if incomingRequest.Invite == "" || s.invites == nil {
+		return nil, nil
+	}
+	invite, inviteErr := s.invites.GetByName(incomingRequest.Invite)
+	if inviteErr != nil {
+		if inviteErr == ErrInviteDoesNotExist {
+			return nil, NewClientError(inviteErr)
 		}
+		return nil, NewServerError(inviteErr)
+	}
+	if invite.Peer != "" && invite.Peer != request.Name {
+		logrus.Errorf("attempted peering as `%s` using invite `%s` issued for `%s`", request.Name, invite.Name, invite.Peer)
+		return nil, NewClientError(errors.New("peer name does not match the invite"))
+	}
+	return &invite, nil
+}
 
-		var ip string
-		var publicKey string
-		existingPeer, peerErr := s.storage.GetByName(request.Name)
-		if peerErr != nil {
-			if peerErr != ErrPeerDoesNotExist {
-				incomingRequest.Err <- NewServerError(peerErr)
-				continue
-			}
-			// Peer is not in the Database
-			var ipErr error
-			ip, ipErr = s.ips.Next()
-			if ipErr != nil {
-				incomingRequest.Err <- NewServerError(ipErr)
-				continue
-			}
-			publicKey = request.Wireguard.PublicKey
-
-			// Store peer info
-			storeErr := s.storage.Store(PeerInfo{
-				Name:      request.Name,
-				IP:        ip,
-				PublicKey: publicKey,
-			})
-
-			if storeErr != nil {
-				incomingRequest.Err <- NewServerError(storeErr)
-				continue
-			}
-		} else {
-			if existingPeer.PublicKey != request.Wireguard.PublicKey {
-				logrus.Errorf(
-					"attempted peering from peer `%s`: error, public key mismatch. "+
-						"There's existing peer `%s` with a different public key.",
-					request.Name, existingPeer.Name,
-				)
-				incomingRequest.Err <- NewServerError(
-					errors.New("please see the server log for error details"),
-				)
-				continue
-			}
-			// Peer is in the Database
-			ip = existingPeer.IP
-			publicKey = existingPeer.PublicKey
+// rotateKey replaces the public key of the existing peer, if the request proves, that the peer
+// owns the previous one. The name and the IP of the peer are kept.
+func (s *Server) rotateKey(existingPeer PeerInfo, request Request) (PeerInfo, error) {
+	rotation := request.Wireguard.Rotation
+	if rotation == nil || rotation.PreviousPublicKey != existingPeer.PublicKey {
+		logrus.Errorf(
+			"attempted peering from peer `%s`: error, public key mismatch. "+
+				"There's existing peer `%s` with a different public key.",
+			request.Name, existingPeer.Name,
+		)
+		return PeerInfo{}, NewServerError(
+			errors.New("please see the server log for error details"),
+		)
+	}
+	var verifyErr error
+	for _, keyPair := range s.keyPairs() {
+		if verifyErr = rotation.Verify(request.Name, request.Wireguard.PublicKey, keyPair); verifyErr == nil {
+			break
+		}
+	}
+	if verifyErr != nil {
+		logrus.Errorf("attempted key rotation of peer `%s`: %v", request.Name, verifyErr)
+		return PeerInfo{}, NewClientError(verifyErr)
+	}
+	existingPeer.PublicKey = request.Wireguard.PublicKey
+	if storeErr := s.storage.Store(existingPeer); storeErr != nil {
+		return PeerInfo{}, NewServerError(storeErr)
+	}
+	logrus.Infof("Rotated public key of peer %s", request.Name)
+	return existingPeer, nil
+}
+
+// Start starts the pairing server. It handles the requests until the transport closes their
+// channel, returning an error if it happened before the context was done.
+func (s *Server) Start(ctx context.Context) error {
+	for incomingRequest := range s.transport.Requests() {
+		metrics.PairingRequests.WithLabelValues(s.handle(incomingRequest)).Inc()
+	}
+	if ctx.Err() == nil {
+		return errors.New("pairing transport stopped unexpectedly")
+	}
+	return nil
+}
+
+// handle responds to a single pairing request, returning its outcome
+func (s *Server) handle(incomingRequest IncomingPairingRequest) (result string) { // nolint: funlen
+	encoder, request, requestErr := s.decode(incomingRequest.Request)
+	if requestErr != nil {
+		incomingRequest.Err <- NewClientError(requestErr)
+		return metrics.PairingOutcomeInvalid
+	}
+	_, span := tracing.Start(
+		tracing.Decode(request.Metadata[traceMetadataKey]), "pairing.server.pair", attribute.String("peer", request.Name),
+	)
+	defer func() {
+		span.SetAttributes(attribute.String("outcome", result))
+		span.End()
+	}()
+	invite, authErr := s.authorize(incomingRequest, request)
+	if authErr != nil {
+		incomingRequest.Err <- authErr
+		return metrics.PairingOutcomeUnauthorized
+	}
+
+	outcome := metrics.PairingOutcomePaired
+	var ip string
+	var publicKey string
+	existingPeer, peerErr := s.storage.GetByName(request.Name)
+	if peerErr != nil {
+		if peerErr != ErrPeerDoesNotExist {
+			incomingRequest.Err <- NewServerError(peerErr)
+			return metrics.PairingOutcomeError
 		}
+		// Peer is not in the Database
+		if invite != nil && !invite.IsUsable(time.Now()) {
+			incomingRequest.Err <- NewClientError(fmt.Errorf("invite `%s` is expired or used up", invite.Name))
+			return metrics.PairingOutcomeUnauthorized
+		}
+		var ipErr error
+		ip, ipErr = s.ips.Next(request.Name)
+		if ipErr != nil {
+			logrus.Errorf("failed to assign IP to peer `%s`: %v", request.Name, ipErr)
+			incomingRequest.Err <- NewServerError(ipErr)
+			return metrics.PairingOutcomeError
+		}
+		publicKey = request.Wireguard.PublicKey
 
-		// Update local wireguard config
-		s.wgConfig.Upsert(wg.Peer{
-			Name:       request.Name,
-			PublicKey:  publicKey,
-			AllowedIPs: fmt.Sprintf("%s/32,%s/32", ip, s.wgConfig.Address),
+		// Store peer info
+		storeErr := s.storage.Store(PeerInfo{
+			Name:      request.Name,
+			IP:        ip,
+			PublicKey: publicKey,
 		})
-		wgUpdateErr := s.wgReloader.Update(*s.wgConfig)
-		if wgUpdateErr != nil {
-			incomingRequest.Err <- NewServerError(wgUpdateErr)
-			continue
-		}
 
-		// Enrich metadata
-		metadata := map[string]string{}
-		for _, enricher := range s.enrichers {
-			for k, v := range enricher.Metadata() {
-				metadata[k] = v
+		if storeErr != nil {
+			incomingRequest.Err <- NewServerError(storeErr)
+			return metrics.PairingOutcomeError
+		}
+		if invite != nil {
+			invite.Uses++
+			if inviteErr := s.invites.Store(*invite); inviteErr != nil {
+				incomingRequest.Err <- NewServerError(inviteErr)
+				return metrics.PairingOutcomeError
+			}
+		}
+	} else {
+		if existingPeer.PublicKey != request.Wireguard.PublicKey {
+			var rotateErr error
+			if existingPeer, rotateErr = s.rotateKey(existingPeer, request); rotateErr != nil {
+				incomingRequest.Err <- rotateErr
+				return metrics.PairingOutcomeUnauthorized
 			}
+			outcome = metrics.PairingOutcomeRotated
 		}
+		// Peer is in the Database
+		ip = existingPeer.IP
+		publicKey = existingPeer.PublicKey
+	}
 
-		// Respond to the client
-		response := Response{
-			Name:             s.serverName,
-			AssignedIP:       ip,
-			InternalServerIP: s.wgConfig.Address,
-			Wireguard: ResponseWireguardConfig{
-				PublicKey: s.keyPair.PublicKey,
-				Endpoint:  s.publicWgHostPort,
-			},
-			Metadata: metadata,
+	// Update local wireguard config
+	s.configLock.Lock()
+	s.wgConfig.Upsert(wg.Peer{
+		Name:       request.Name,
+		PublicKey:  publicKey,
+		AllowedIPs: fmt.Sprintf("%s,%s", wg.HostCIDR(ip), wg.HostCIDR(s.wgConfig.Address)),
+	})
+	wgUpdateErr := s.wgReloader.Update(*s.wgConfig)
+	s.configLock.Unlock()
+	if wgUpdateErr != nil {
+		incomingRequest.Err <- NewServerError(wgUpdateErr)
+		return metrics.PairingOutcomeError
+	}
+
+	// Enrich metadata
+	metadata := map[string]string{}
+	for _, enricher := range s.enrichers {
+		for k, v := range enricher.Metadata() {
+			metadata[k] = v
 		}
-		encoded, encodeErr := s.marshaler.EncodeResponse(response)
-		if encodeErr != nil {
-			incomingRequest.Err <- NewServerError(encodeErr)
-			continue
+	}
+
+	// Respond to the client
+	response := Response{
+		Name:             s.serverName,
+		AssignedIP:       ip,
+		InternalServerIP: s.wgConfig.Address,
+		Wireguard: ResponseWireguardConfig{
+			PublicKey: s.keyPairs()[0].PublicKey,
+			Endpoint:  s.publicWgHostPort,
+		},
+		Metadata: metadata,
+	}
+	encoded, encodeErr := encoder.EncodeResponse(response)
+	if encodeErr != nil {
+		incomingRequest.Err <- NewServerError(encodeErr)
+		return metrics.PairingOutcomeError
+	}
+	logrus.Infof("Pairing request from %s, assigned IP %s", request.Name, response.AssignedIP)
+	incomingRequest.Response <- encoded
+	return outcome
+}
+
+// decode decodes the request using the first encoder, that is able to do it
+func (s *Server) decode(request []byte) (Encoder, Request, error) {
+	decoded, decodeErr := s.marshaler.DecodeRequest(request)
+	if decodeErr == nil {
+		return s.marshaler, decoded, nil
+	}
+	for _, encoder := range s.encoders {
+		if decodedRequest, err := encoder.DecodeRequest(request); err == nil {
+			return encoder, decodedRequest, nil
 		}
-		logrus.Infof("Pairing request from %s, assigned IP %s", request.Name, response.AssignedIP)
-		incomingRequest.Response <- encoded
 	}
+	return nil, Request{}, decodeErr
 }
 
 // NewServer creates a new PairingServer instance
@@ -130,11 +292,13 @@ func NewServer(
 	ips IPPool,
 	storage PeerStorage,
 	enrichers []MetadataEnricher,
+	opts ...ServerOption,
 ) *Server {
-	return &Server{
+	s := &Server{
 		serverName:       serverName,
 		publicWgHostPort: publicWgHostPort,
 		wgConfig:         wgConfig,
+		configLock:       &sync.Mutex{},
 		keyPair:          keyPair,
 		wgReloader:       wgReloader,
 		marshaler:        encoder,
@@ -143,6 +307,10 @@ func NewServer(
 		storage:          storage,
 		enrichers:        enrichers,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // MetadataEnricher is an interface that allows transports exchanging information between
@@ -0,0 +1,189 @@
+package pairing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/metrics"
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type noOpWireguardReloader struct{}
+
+func (r *noOpWireguardReloader) Update(wg.Config) error {
+	return nil
+}
+
+type mockServerTransport struct {
+	requests chan IncomingPairingRequest
+}
+
+func (t *mockServerTransport) Requests() <-chan IncomingPairingRequest {
+	return t.requests
+}
+
+type forwardingClientTransport struct {
+	server *mockServerTransport
+}
+
+func (t *forwardingClientTransport) Send(req []byte) ([]byte, error) {
+	incoming := IncomingPairingRequest{Request: req, Response: make(chan []byte), Err: make(chan error)}
+	t.server.requests <- incoming
+	select {
+	case resp := <-incoming.Response:
+		return resp, nil
+	case err := <-incoming.Err:
+		return nil, err
+	}
+}
+
+func generateTestKeyPair(t *testing.T) KeyPair {
+	private, public, err := wg.GenerateKeyPair()
+	assert.NoError(t, err)
+	return KeyPair{PublicKey: public, PrivateKey: private}
+}
+
+// newTestServer creates a pairing server, that handles the requests sent to the returned
+// transport, optionally wrapped, for example in a PSK transport. The server is not started.
+func newTestServer(
+	t *testing.T, peers PeerStorage, wrap func(ServerTransport) ServerTransport, opts ...ServerOption,
+) (*Server, KeyPair, *mockServerTransport) {
+	serverKeys := generateTestKeyPair(t)
+	child := &mockServerTransport{requests: make(chan IncomingPairingRequest)}
+	var transport ServerTransport = child
+	if wrap != nil {
+		transport = wrap(child)
+	}
+	server := NewServer(
+		"server",
+		"wormhole.example.com:51820",
+		&wg.Config{Address: "10.188.0.1"},
+		serverKeys,
+		&noOpWireguardReloader{},
+		NewJSONPairingEncoder(),
+		transport,
+		newTestIPPool(t, peers),
+		peers,
+		[]MetadataEnricher{},
+		opts...,
+	)
+	return server, serverKeys, child
+}
+
+func TestServerStartReturnsAfterTransportStops(t *testing.T) {
+	tests := []struct {
+		name        string
+		shutdown    bool
+		expectedErr bool
+	}{
+		{name: "Shutdown", shutdown: true, expectedErr: false},
+		{name: "Transport failure", shutdown: false, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			server, _, child := newTestServer(t, NewInMemoryPeerStorage(), func(child ServerTransport) ServerTransport {
+				return NewPSKPairingServerTransport("psk", child)
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.shutdown {
+				cancel()
+			}
+			defer cancel()
+
+			// when
+			close(child.requests)
+			startErr := server.Start(ctx)
+
+			// then
+			assert.Equal(t, tt.expectedErr, startErr != nil)
+		})
+	}
+}
+
+func TestPairingRequestsAreCountedByOutcome(t *testing.T) {
+	// given
+	server, serverKeys, child := newTestServer(t, NewInMemoryPeerStorage(), nil)
+	go server.Start(context.Background())
+	client := NewDefaultPairingClient(
+		"client1", &wg.Config{}, generateTestKeyPair(t), &noOpWireguardReloader{}, NewJSONPairingEncoder(),
+		&forwardingClientTransport{child},
+	)
+	paired := testutil.ToFloat64(metrics.PairingRequests.WithLabelValues(metrics.PairingOutcomePaired))
+	rotated := testutil.ToFloat64(metrics.PairingRequests.WithLabelValues(metrics.PairingOutcomeRotated))
+
+	// when
+	_, pairErr := client.Pair()
+	_, rotateErr := client.Rotate(serverKeys.PublicKey, generateTestKeyPair(t))
+
+	// then
+	assert.NoError(t, pairErr)
+	assert.NoError(t, rotateErr)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.PairingRequests.WithLabelValues(metrics.PairingOutcomePaired)) >= paired+1 &&
+			testutil.ToFloat64(metrics.PairingRequests.WithLabelValues(metrics.PairingOutcomeRotated)) >= rotated+1
+	}, time.Second, time.Millisecond*10)
+}
+
+type countingClientTransport struct {
+	child ClientTransport
+	sent  int
+}
+
+func (t *countingClientTransport) Send(req []byte) ([]byte, error) {
+	t.sent++
+	return t.child.Send(req)
+}
+
+func TestClientsAndServersOfDifferentVersionsCanPair(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverOpts    []ServerOption
+		clientEncoder Encoder
+		expectedSent  int
+	}{
+		{
+			name:          "protobuf client, protobuf server",
+			serverOpts:    []ServerOption{WithEncoders(NewProtobufPairingEncoder())},
+			clientEncoder: NewProtobufPairingEncoder(),
+			expectedSent:  2,
+		},
+		{
+			name:          "protobuf client, json only server",
+			clientEncoder: NewProtobufPairingEncoder(),
+			expectedSent:  3,
+		},
+		{
+			name:          "json client, protobuf server",
+			serverOpts:    []ServerOption{WithEncoders(NewProtobufPairingEncoder())},
+			clientEncoder: NewJSONPairingEncoder(),
+			expectedSent:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			server, serverKeys, child := newTestServer(t, NewInMemoryPeerStorage(), nil, tt.serverOpts...)
+			go server.Start(context.Background())
+			transport := &countingClientTransport{child: &forwardingClientTransport{child}}
+			client := NewDefaultPairingClient(
+				"client1", &wg.Config{}, generateTestKeyPair(t), &noOpWireguardReloader{}, tt.clientEncoder,
+				transport, WithFallbackEncoder(NewJSONPairingEncoder()),
+			)
+
+			// when
+			paired, pairErr := client.Pair()
+			_, rotateErr := client.Rotate(serverKeys.PublicKey, generateTestKeyPair(t))
+
+			// then
+			assert.NoError(t, pairErr)
+			assert.NoError(t, rotateErr)
+			assert.Equal(t, serverKeys.PublicKey, paired.Wireguard.PublicKey)
+			assert.Equal(t, tt.expectedSent, transport.sent)
+		})
+	}
+}
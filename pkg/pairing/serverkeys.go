@@ -0,0 +1,260 @@
+package pairing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ServerNextPublicKeyMetadataKey holds the public key, that the server switches to
+	ServerNextPublicKeyMetadataKey = "server_next_public_key"
+	// ServerKeyRotationAtMetadataKey holds the time (RFC3339), when the server switches the keys
+	ServerKeyRotationAtMetadataKey = "server_key_rotation_at"
+)
+
+// ServerKeyRotator replaces the Wireguard key pair of the server. The next key is published
+// to the peers for the grace period, so they can switch to it at the same time as the server.
+type ServerKeyRotator struct {
+	ctx        context.Context
+	lock       sync.Mutex
+	keys       wg.KeyStorage
+	wgConfig   *wg.Config
+	configLock sync.Locker
+	wgReloader wg.WireguardConfigReloader
+	grace      time.Duration
+
+	current  KeyPair
+	previous *KeyPair // Kept after the switch, for the peers, that did not notice it yet
+	next     *KeyPair
+	switchAt time.Time
+	timer    *time.Timer
+}
+
+// Rotate generates the next key pair and schedules the switch to it after the grace period
+func (r *ServerKeyRotator) Rotate() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.next != nil {
+		return fmt.Errorf("key rotation is already in progress, switching at %s", r.switchAt.Format(time.RFC3339))
+	}
+	if r.ctx.Err() != nil {
+		return r.ctx.Err()
+	}
+	private, public, generateErr := wg.GenerateKeyPair()
+	if generateErr != nil {
+		return generateErr
+	}
+	switchAt := time.Now().Add(r.grace)
+	if storeErr := r.keys.StorePending(private, public, switchAt); storeErr != nil {
+		return fmt.Errorf("failed to store the next key pair: %w", storeErr)
+	}
+	r.schedule(KeyPair{PublicKey: public, PrivateKey: private}, switchAt)
+	return nil
+}
+
+// Resume schedules the switch to the next key pair, if the server was restarted during the
+// grace period. The switch happens immediately, if the grace period has already passed.
+func (r *ServerKeyRotator) Resume() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	private, public, switchAt, loadErr := r.keys.LoadPending()
+	if loadErr == wg.ErrNoPendingKeyPair {
+		return nil
+	} else if loadErr != nil {
+		return loadErr
+	}
+	if public == r.current.PublicKey {
+		// The switch completed, but the pending key pair was not cleared
+		return r.keys.ClearPending()
+	}
+	r.schedule(KeyPair{PublicKey: public, PrivateKey: private}, switchAt)
+	return nil
+}
+
+func (r *ServerKeyRotator) schedule(next KeyPair, switchAt time.Time) {
+	r.next = &next
+	r.switchAt = switchAt
+	r.timer = time.AfterFunc(time.Until(switchAt), r.switchKeys)
+	logrus.Infof("Scheduled server key rotation to %s at %s", next.PublicKey, switchAt.Format(time.RFC3339))
+}
+
+func (r *ServerKeyRotator) switchKeys() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.next == nil || r.ctx.Err() != nil {
+		return
+	}
+	next := *r.next
+	r.next = nil
+	if storeErr := r.keys.Store(next.PrivateKey, next.PublicKey); storeErr != nil {
+		// The peers, that already switched, fail to ping the server and pair again
+		logrus.Errorf("Failed to store the rotated server key pair, aborting the rotation: %v", storeErr)
+		if clearErr := r.keys.ClearPending(); clearErr != nil {
+			logrus.Errorf("Failed to clear the pending server key pair: %v", clearErr)
+		}
+		return
+	}
+	if clearErr := r.keys.ClearPending(); clearErr != nil {
+		logrus.Errorf("Failed to clear the pending server key pair: %v", clearErr)
+	}
+	r.configLock.Lock()
+	r.wgConfig.PrivateKey = next.PrivateKey
+	updateErr := r.wgReloader.Update(*r.wgConfig)
+	r.configLock.Unlock()
+	if updateErr != nil {
+		logrus.Errorf("Failed to update Wireguard config: %v", updateErr)
+	}
+	previous := r.current
+	r.previous = &previous
+	r.current = next
+	logrus.Infof("Rotated server key pair, new public key: %s", r.current.PublicKey)
+}
+
+// stop cancels the scheduled switch, the pending key pair is kept, so it can be resumed
+func (r *ServerKeyRotator) stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+}
+
+// KeyPairs returns the current key pair of the server, followed by the previous one, if any
+func (r *ServerKeyRotator) KeyPairs() []KeyPair {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.previous == nil {
+		return []KeyPair{r.current}
+	}
+	return []KeyPair{r.current, *r.previous}
+}
+
+// Metadata implements MetadataEnricher, publishing the next key during the grace period
+func (r *ServerKeyRotator) Metadata() map[string]string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.next == nil {
+		return map[string]string{}
+	}
+	return map[string]string{
+		ServerNextPublicKeyMetadataKey: r.next.PublicKey,
+		ServerKeyRotationAtMetadataKey: r.switchAt.Format(time.RFC3339Nano),
+	}
+}
+
+// NewServerKeyRotator creates a new ServerKeyRotator instance. The next key pair is kept in the
+// key storage during the grace period, see Resume. The scheduled switch is cancelled, when the
+// context is done. The config lock should be shared with the other components modifying the
+// Wireguard config, see WithConfigLock.
+func NewServerKeyRotator(
+	ctx context.Context,
+	keyPair KeyPair,
+	keys wg.KeyStorage,
+	wgConfig *wg.Config,
+	configLock sync.Locker,
+	wgReloader wg.WireguardConfigReloader,
+	grace time.Duration,
+) *ServerKeyRotator {
+	r := &ServerKeyRotator{
+		ctx:        ctx,
+		current:    keyPair,
+		keys:       keys,
+		wgConfig:   wgConfig,
+		configLock: configLock,
+		wgReloader: wgReloader,
+		grace:      grace,
+	}
+	context.AfterFunc(ctx, r.stop)
+	return r
+}
+
+// ServerKeyFollower switches the client to the next key of the server, when the server rotates it
+type ServerKeyFollower struct {
+	ctx        context.Context
+	lock       sync.Mutex
+	wgConfig   *wg.Config
+	wgReloader wg.WireguardConfigReloader
+	cache      KeyCachingPairingClientStorage
+
+	scheduled string
+	timer     *time.Timer
+}
+
+// Observe schedules the switch to the next key of the server, if the metadata announces one
+func (f *ServerKeyFollower) Observe(metadata map[string]string) {
+	nextKey, rawSwitchAt := metadata[ServerNextPublicKeyMetadataKey], metadata[ServerKeyRotationAtMetadataKey]
+	if nextKey == "" || rawSwitchAt == "" {
+		return
+	}
+	switchAt, parseErr := time.Parse(time.RFC3339Nano, rawSwitchAt)
+	if parseErr != nil {
+		logrus.Errorf("Invalid %s in server metadata: %v", ServerKeyRotationAtMetadataKey, parseErr)
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.scheduled == nextKey || f.ctx.Err() != nil {
+		return
+	}
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	f.scheduled = nextKey
+	logrus.Infof("Server announced key rotation to %s at %s", nextKey, switchAt.Format(time.RFC3339))
+	f.timer = time.AfterFunc(time.Until(switchAt), func() {
+		if switchErr := f.switchTo(nextKey); switchErr != nil {
+			logrus.Errorf("Failed to switch to the rotated server key: %v", switchErr)
+		}
+	})
+}
+
+func (f *ServerKeyFollower) stop() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+}
+
+func (f *ServerKeyFollower) switchTo(publicKey string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.ctx.Err() != nil {
+		return nil
+	}
+	response, getErr := f.cache.Get()
+	if getErr != nil {
+		return getErr
+	}
+	response.Wireguard.PublicKey = publicKey
+	f.wgConfig.Upsert(serverPeer(response))
+	if updateErr := f.wgReloader.Update(*f.wgConfig); updateErr != nil {
+		return updateErr
+	}
+	logrus.Infof("Switched to the rotated server key %s", publicKey)
+	return f.cache.Set(response)
+}
+
+// NewServerKeyFollower creates a new ServerKeyFollower instance. The cached pairing response
+// is used to build the peer entry of the server and updated with the new key. The scheduled
+// switch is cancelled, when the context is done.
+func NewServerKeyFollower(
+	ctx context.Context,
+	wgConfig *wg.Config,
+	wgReloader wg.WireguardConfigReloader,
+	cache KeyCachingPairingClientStorage,
+) *ServerKeyFollower {
+	f := &ServerKeyFollower{
+		ctx:        ctx,
+		wgConfig:   wgConfig,
+		wgReloader: wgReloader,
+		cache:      cache,
+	}
+	context.AfterFunc(ctx, f.stop)
+	return f
+}
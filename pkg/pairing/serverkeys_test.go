@@ -0,0 +1,164 @@
+package pairing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/wg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerKeyRotatorPublishesNextKeyDuringGracePeriod(t *testing.T) {
+	// given
+	current := generateTestKeyPair(t)
+	keys := wg.NewInMemoryKeyStorage()
+	wgConfig := &wg.Config{PrivateKey: current.PrivateKey}
+	rotator := NewServerKeyRotator(
+		context.Background(), current, keys, wgConfig, &sync.Mutex{}, &noOpWireguardReloader{}, time.Hour,
+	)
+
+	// when
+	rotateErr := rotator.Rotate()
+	secondRotateErr := rotator.Rotate()
+	metadata := rotator.Metadata()
+
+	// then
+	assert.NoError(t, rotateErr)
+	assert.Error(t, secondRotateErr)
+	assert.NotEmpty(t, metadata[ServerNextPublicKeyMetadataKey])
+	assert.NotEqual(t, current.PublicKey, metadata[ServerNextPublicKeyMetadataKey])
+	assert.NotEmpty(t, metadata[ServerKeyRotationAtMetadataKey])
+	assert.Equal(t, []KeyPair{current}, rotator.KeyPairs())
+	assert.Equal(t, current.PrivateKey, wgConfig.PrivateKey)
+}
+
+func TestServerKeyRotatorSwitchesKeysAfterGracePeriod(t *testing.T) {
+	// given
+	current := generateTestKeyPair(t)
+	keys := wg.NewInMemoryKeyStorage()
+	wgConfig := &wg.Config{PrivateKey: current.PrivateKey}
+	rotator := NewServerKeyRotator(
+		context.Background(), current, keys, wgConfig, &sync.Mutex{}, &noOpWireguardReloader{}, time.Hour,
+	)
+	assert.NoError(t, rotator.Rotate())
+	next := rotator.Metadata()[ServerNextPublicKeyMetadataKey]
+
+	// when
+	rotator.switchKeys()
+
+	// then
+	keyPairs := rotator.KeyPairs()
+	assert.Len(t, keyPairs, 2)
+	assert.Equal(t, next, keyPairs[0].PublicKey)
+	assert.Equal(t, current, keyPairs[1])
+	assert.Equal(t, keyPairs[0].PrivateKey, wgConfig.PrivateKey)
+	assert.Empty(t, rotator.Metadata())
+	_, storedPublic, loadErr := keys.Load()
+	assert.NoError(t, loadErr)
+	assert.Equal(t, next, storedPublic)
+}
+
+func TestServerKeyRotatorResumesRotationAfterRestart(t *testing.T) {
+	// given
+	current := generateTestKeyPair(t)
+	keys := wg.NewInMemoryKeyStorage()
+	assert.NoError(t, keys.Store(current.PrivateKey, current.PublicKey))
+	beforeRestart := NewServerKeyRotator(
+		context.Background(), current, keys, &wg.Config{}, &sync.Mutex{}, &noOpWireguardReloader{}, time.Hour,
+	)
+	assert.NoError(t, beforeRestart.Rotate())
+	metadata := beforeRestart.Metadata()
+	afterRestart := NewServerKeyRotator(
+		context.Background(), current, keys, &wg.Config{}, &sync.Mutex{}, &noOpWireguardReloader{}, time.Hour,
+	)
+
+	// when
+	resumeErr := afterRestart.Resume()
+
+	// then
+	assert.NoError(t, resumeErr)
+	assert.Equal(t, metadata, afterRestart.Metadata())
+}
+
+type failingKeyStorage struct {
+	wg.KeyStorage
+}
+
+func (s *failingKeyStorage) Store(_, _ string) error {
+	return errors.New("storage unavailable")
+}
+
+func TestServerKeyRotatorAbortsSwitchIfKeysCannotBeStored(t *testing.T) {
+	// given
+	current := generateTestKeyPair(t)
+	keys := &failingKeyStorage{wg.NewInMemoryKeyStorage()}
+	wgConfig := &wg.Config{PrivateKey: current.PrivateKey}
+	rotator := NewServerKeyRotator(
+		context.Background(), current, keys, wgConfig, &sync.Mutex{}, &noOpWireguardReloader{}, time.Hour,
+	)
+	assert.NoError(t, rotator.Rotate())
+
+	// when
+	rotator.switchKeys()
+
+	// then
+	assert.Equal(t, []KeyPair{current}, rotator.KeyPairs())
+	assert.Equal(t, current.PrivateKey, wgConfig.PrivateKey)
+	assert.Empty(t, rotator.Metadata())
+	_, _, _, pendingErr := keys.LoadPending()
+	assert.Equal(t, wg.ErrNoPendingKeyPair, pendingErr)
+}
+
+func TestServerKeyRotatorCancelsSwitchWhenContextIsDone(t *testing.T) {
+	// given
+	ctx, cancel := context.WithCancel(context.Background())
+	current := generateTestKeyPair(t)
+	keys := wg.NewInMemoryKeyStorage()
+	rotator := NewServerKeyRotator(
+		ctx, current, keys, &wg.Config{}, &sync.Mutex{}, &noOpWireguardReloader{}, time.Millisecond*50,
+	)
+	assert.NoError(t, rotator.Rotate())
+
+	// when
+	cancel()
+	time.Sleep(time.Millisecond * 100)
+
+	// then
+	assert.Equal(t, []KeyPair{current}, rotator.KeyPairs())
+	_, _, _, pendingErr := keys.LoadPending()
+	assert.NoError(t, pendingErr)
+	assert.Error(t, rotator.Rotate())
+}
+
+func TestServerKeyFollowerSwitchesServerPeer(t *testing.T) {
+	// given
+	cache := NewInMemoryKeyCachingPairingClientStorage()
+	assert.NoError(t, cache.Set(Response{
+		Name:             "server",
+		AssignedIP:       "10.188.0.2",
+		InternalServerIP: "10.188.0.1",
+		Wireguard:        ResponseWireguardConfig{PublicKey: "old-key", Endpoint: "wormhole.example.com:51820"},
+	}))
+	wgConfig := &wg.Config{}
+	follower := NewServerKeyFollower(context.Background(), wgConfig, &noOpWireguardReloader{}, cache)
+
+	// when
+	follower.Observe(map[string]string{
+		ServerNextPublicKeyMetadataKey: "new-key",
+		ServerKeyRotationAtMetadataKey: time.Now().Format(time.RFC3339Nano),
+	})
+
+	// then
+	assert.Eventually(t, func() bool {
+		cached, getErr := cache.Get()
+		return getErr == nil && cached.Wireguard.PublicKey == "new-key"
+	}, time.Second, time.Millisecond*10)
+	follower.lock.Lock()
+	defer follower.lock.Unlock()
+	assert.Len(t, wgConfig.Peers, 1)
+	assert.Equal(t, "new-key", wgConfig.Peers[0].PublicKey)
+	assert.Equal(t, "10.188.0.1/32,10.188.0.2/32", wgConfig.Peers[0].AllowedIPs)
+}
@@ -3,6 +3,7 @@ package pairing
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"sync"
 
 	"github.com/sirupsen/logrus"
@@ -55,6 +56,57 @@ func NewInMemoryPeerStorage() PeerStorage {
 	return &inMemoryPeerStorage{}
 }
 
+type cachingPeerStorage struct {
+	storage PeerStorage
+	cache   sync.Map
+}
+
+func (s *cachingPeerStorage) Store(peer PeerInfo) error {
+	if storeErr := s.storage.Store(peer); storeErr != nil {
+		return storeErr
+	}
+	s.cache.Store(peer.Name, peer)
+	return nil
+}
+
+func (s *cachingPeerStorage) GetByName(name string) (PeerInfo, error) {
+	if peer, ok := s.cache.Load(name); ok {
+		return peer.(PeerInfo), nil
+	}
+	peer, getErr := s.storage.GetByName(name)
+	if getErr != nil {
+		return PeerInfo{}, getErr
+	}
+	s.cache.Store(name, peer)
+	return peer, nil
+}
+
+func (s *cachingPeerStorage) List() ([]PeerInfo, error) {
+	return s.storage.List()
+}
+
+func (s *cachingPeerStorage) DeleteByName(name string) error {
+	if deleteErr := s.storage.DeleteByName(name); deleteErr != nil {
+		return deleteErr
+	}
+	s.cache.Delete(name)
+	return nil
+}
+
+// Close closes the underlying storage, if it can be closed
+func (s *cachingPeerStorage) Close() error {
+	if closer, ok := s.storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// NewCachingPeerStorage creates a new PeerStorage, that serves the peers from memory once they
+// were read or written. All the writes have to go through it, so the cache stays up to date.
+func NewCachingPeerStorage(storage PeerStorage) PeerStorage {
+	return &cachingPeerStorage{storage: storage}
+}
+
 type boltPeerStorage struct {
 	db *bolt.DB
 }
@@ -112,6 +164,11 @@ func (s *boltPeerStorage) DeleteByName(name string) error {
 	})
 }
 
+// Close closes the database
+func (s *boltPeerStorage) Close() error {
+	return s.db.Close()
+}
+
 // NewBoltPeerStorage creates a new BoltDB (persistent, on-disk storage) PeerStorage instance
 func NewBoltPeerStorage(path string) PeerStorage {
 	db, err := bolt.Open(path, 0600, nil)
@@ -0,0 +1,44 @@
+package pairing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingPeerStorage struct {
+	PeerStorage
+	gets int
+}
+
+func (s *countingPeerStorage) GetByName(name string) (PeerInfo, error) {
+	s.gets++
+	return s.PeerStorage.GetByName(name)
+}
+
+func TestCachingPeerStorageServesReadsFromMemory(t *testing.T) {
+	// given
+	child := &countingPeerStorage{PeerStorage: NewInMemoryPeerStorage()}
+	assert.NoError(t, child.Store(PeerInfo{Name: "client1", IP: "10.188.0.2"}))
+	storage := NewCachingPeerStorage(child)
+
+	// when
+	first, firstErr := storage.GetByName("client1")
+	second, secondErr := storage.GetByName("client1")
+	storeErr := storage.Store(PeerInfo{Name: "client1", IP: "10.188.0.3"})
+	updated, updatedErr := storage.GetByName("client1")
+	deleteErr := storage.DeleteByName("client1")
+	_, deletedErr := storage.GetByName("client1")
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.NoError(t, secondErr)
+	assert.NoError(t, storeErr)
+	assert.NoError(t, updatedErr)
+	assert.NoError(t, deleteErr)
+	assert.Equal(t, "10.188.0.2", first.IP)
+	assert.Equal(t, first, second)
+	assert.Equal(t, "10.188.0.3", updated.IP)
+	assert.Equal(t, ErrPeerDoesNotExist, deletedErr)
+	assert.Equal(t, 2, child.gets)
+}
@@ -0,0 +1,149 @@
+package pairing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// certificateReloader loads the certificate from the given files and reloads it, when
+// the files change, so the certificates can be rotated without restarting
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	lock        sync.Mutex
+	certificate *tls.Certificate
+	modTimes    [2]time.Time
+}
+
+func (r *certificateReloader) get() (*tls.Certificate, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	modTimes, statErr := r.modificationTimes()
+	if statErr != nil {
+		if r.certificate != nil {
+			logrus.Errorf("Failed to check TLS certificate for changes, using the loaded one: %v", statErr)
+			return r.certificate, nil
+		}
+		return nil, statErr
+	}
+	if r.certificate != nil && modTimes == r.modTimes {
+		return r.certificate, nil
+	}
+	certificate, loadErr := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if loadErr != nil {
+		if r.certificate != nil {
+			logrus.Errorf("Failed to reload TLS certificate, using the previous one: %v", loadErr)
+			return r.certificate, nil
+		}
+		return nil, loadErr
+	}
+	if r.certificate != nil {
+		logrus.Infof("Reloaded TLS certificate from %s", r.certFile)
+	}
+	r.certificate = &certificate
+	r.modTimes = modTimes
+	return r.certificate, nil
+}
+
+func (r *certificateReloader) modificationTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{r.certFile, r.keyFile} {
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			return modTimes, statErr
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if _, loadErr := reloader.get(); loadErr != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", loadErr)
+	}
+	return reloader, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, readErr := os.ReadFile(caFile) // nolint: gosec
+	if readErr != nil {
+		return nil, readErr
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// NewServerTLSConfig creates TLS config for the pairing server. The certificate is reloaded
+// when the files change. If clientCAFile is set, the clients have to present a certificate
+// signed by one of the CAs from the file.
+func NewServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both TLS certificate and key files are required")
+	}
+	reloader, reloaderErr := newCertificateReloader(certFile, keyFile)
+	if reloaderErr != nil {
+		return nil, reloaderErr
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return reloader.get()
+		},
+	}
+	if clientCAFile != "" {
+		pool, poolErr := loadCertPool(clientCAFile)
+		if poolErr != nil {
+			return nil, fmt.Errorf("failed to load client CA: %w", poolErr)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// NewClientTLSConfig creates TLS config for the pairing client. If caFile is set, only
+// the server certificates signed by the CAs from the file are trusted, instead of the
+// system ones. If certFile and keyFile are set, the client presents the certificate to the
+// server, it's reloaded when the files change.
+func NewClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pool, poolErr := loadCertPool(caFile)
+		if poolErr != nil {
+			return nil, fmt.Errorf("failed to load server CA: %w", poolErr)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		reloader, reloaderErr := newCertificateReloader(certFile, keyFile)
+		if reloaderErr != nil {
+			return nil, reloaderErr
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.get()
+		}
+	}
+	return config, nil
+}
+
+// identityFromTLS returns the common name of the verified client certificate, if any
+func identityFromTLS(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
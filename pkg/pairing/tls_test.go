@@ -0,0 +1,148 @@
+package pairing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, commonName string, parent *testCertificate) *testCertificate {
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, keyErr)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, certErr := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	assert.NoError(t, certErr)
+	cert, parseErr := x509.ParseCertificate(der)
+	assert.NoError(t, parseErr)
+	return &testCertificate{cert: cert, key: key}
+}
+
+func (c *testCertificate) write(t *testing.T, dir, name string) (string, string) {
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	keyDER, keyErr := x509.MarshalECPrivateKey(c.key)
+	assert.NoError(t, keyErr)
+	assert.NoError(t, os.WriteFile(
+		certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600,
+	))
+	assert.NoError(t, os.WriteFile(
+		keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600,
+	))
+	return certFile, keyFile
+}
+
+func TestCertificateReloaderReloadsChangedFiles(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	ca := newTestCertificate(t, "ca", nil)
+	certFile, keyFile := newTestCertificate(t, "first", ca).write(t, dir, "server")
+	reloader, reloaderErr := newCertificateReloader(certFile, keyFile)
+	assert.NoError(t, reloaderErr)
+	newTestCertificate(t, "second", ca).write(t, dir, "server")
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, future, future))
+
+	// when
+	certificate, getErr := reloader.get()
+
+	// then
+	assert.NoError(t, getErr)
+	leaf, parseErr := x509.ParseCertificate(certificate.Certificate[0])
+	assert.NoError(t, parseErr)
+	assert.Equal(t, "second", leaf.Subject.CommonName)
+}
+
+func TestMutualTLSExposesClientIdentity(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	ca := newTestCertificate(t, "ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert, serverKey := newTestCertificate(t, "server", ca).write(t, dir, "server")
+	clientCert, clientKey := newTestCertificate(t, "client1", ca).write(t, dir, "client")
+	serverConfig, serverErr := NewServerTLSConfig(serverCert, serverKey, caFile)
+	assert.NoError(t, serverErr)
+	clientConfig, clientErr := NewClientTLSConfig(caFile, clientCert, clientKey)
+	assert.NoError(t, clientErr)
+	listener, listenErr := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	assert.NoError(t, listenErr)
+	defer listener.Close()
+	identity := make(chan string)
+	go func() {
+		conn, acceptErr := listener.Accept()
+		assert.NoError(t, acceptErr)
+		tlsConn, _ := conn.(*tls.Conn)
+		assert.NoError(t, tlsConn.Handshake())
+		state := tlsConn.ConnectionState()
+		identity <- identityFromTLS(&state)
+		tlsConn.Close()
+	}()
+
+	// when
+	conn, dialErr := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+
+	// then
+	assert.NoError(t, dialErr)
+	assert.Equal(t, "client1", <-identity)
+	conn.Close()
+}
+
+func TestClientTLSConfigPinsServerCA(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	ca := newTestCertificate(t, "ca", nil)
+	otherCAFile, _ := newTestCertificate(t, "other-ca", nil).write(t, dir, "other-ca")
+	serverCert, serverKey := newTestCertificate(t, "server", ca).write(t, dir, "server")
+	serverConfig, serverErr := NewServerTLSConfig(serverCert, serverKey, "")
+	assert.NoError(t, serverErr)
+	clientConfig, clientErr := NewClientTLSConfig(otherCAFile, "", "")
+	assert.NoError(t, clientErr)
+	listener, listenErr := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	assert.NoError(t, listenErr)
+	defer listener.Close()
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr == nil {
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	// when
+	_, dialErr := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+
+	// then
+	assert.Error(t, dialErr)
+}
@@ -12,7 +12,13 @@ type ServerTransport interface {
 
 // IncomingPairingRequest is a request that was received by the server
 type IncomingPairingRequest struct {
-	Request  []byte
+	Request []byte
+	// Identity of the peer, verified by the transport (for example using client certificate),
+	// empty if the transport does not verify the peers
+	Identity string
+	// Invite is the name of the invite, that the request was encrypted with, empty if the
+	// request was not encrypted using an invite
+	Invite   string
 	Response chan []byte
 	Err      chan error
 }
@@ -0,0 +1,168 @@
+// Package proxy implements an Exposer, that proxies the TCP connections of the apps in the process.
+// It is used instead of NGINX, when the tunnel is not available to the other processes, for
+// example with the userspace Wireguard interface.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/listeners"
+	"github.com/glothriel/wormhole/pkg/nginx"
+	"github.com/sirupsen/logrus"
+)
+
+const dialTimeout = 10 * time.Second
+
+// ListenFunc listens for connections on the address, it has the signature of net.Listen
+type ListenFunc func(network, address string) (net.Listener, error)
+
+// DialFunc connects to the address, it has the signature of net.Dialer.DialContext
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+type exposedApp struct {
+	listener net.Listener
+	port     int
+}
+
+// Exposer is an Exposer implementation, that accepts the connections using the listen function
+// and proxies them to the apps using the dial function
+type Exposer struct {
+	lock   sync.Mutex
+	host   string
+	ports  nginx.PortAllocator
+	listen ListenFunc
+	dial   DialFunc
+
+	exposed map[string]exposedApp
+}
+
+// Add implements listeners.Exposer
+func (e *Exposer) Add(_ context.Context, app apps.App) (apps.App, error) {
+	if apps.ProtocolOf(app) == apps.ProtocolUDP {
+		return apps.App{}, fmt.Errorf("UDP app %s cannot be proxied, only TCP is supported", app.Name)
+	}
+	port, portErr := e.ports.Allocate()
+	if portErr != nil {
+		return apps.App{}, fmt.Errorf("Could not allocate port: %v", portErr)
+	}
+	listener, listenErr := e.listen("tcp", net.JoinHostPort(e.host, strconv.Itoa(port)))
+	if listenErr != nil {
+		e.ports.Return(port)
+		return apps.App{}, fmt.Errorf("Could not listen on port %d: %v", port, listenErr)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.close(appKey(app))
+	e.exposed[appKey(app)] = exposedApp{listener: listener, port: port}
+	go e.serve(listener, app.Address)
+	logrus.Infof("Proxying port %d to %s", port, app.Address)
+	return apps.WithAddress(app, fmt.Sprintf("localhost:%d", port)), nil
+}
+
+// Withdraw implements listeners.Exposer
+func (e *Exposer) Withdraw(_ context.Context, app apps.App) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.close(appKey(app))
+	return nil
+}
+
+// WithdrawAll implements listeners.Exposer
+func (e *Exposer) WithdrawAll() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for key := range e.exposed {
+		e.close(key)
+	}
+	return nil
+}
+
+// close stops proxying the app, it must be called with the lock held
+func (e *Exposer) close(key string) {
+	exposed, ok := e.exposed[key]
+	if !ok {
+		return
+	}
+	if closeErr := exposed.listener.Close(); closeErr != nil {
+		logrus.Errorf("Could not close listener on port %d: %v", exposed.port, closeErr)
+	}
+	e.ports.Return(exposed.port)
+	delete(e.exposed, key)
+	logrus.Infof("Stopped proxying port %d", exposed.port)
+}
+
+func (e *Exposer) serve(listener net.Listener, upstream string) {
+	for {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			if !errors.Is(acceptErr, net.ErrClosed) {
+				logrus.Errorf("Could not accept connection for %s: %v", upstream, acceptErr)
+			}
+			return
+		}
+		go e.proxy(conn, upstream)
+	}
+}
+
+func (e *Exposer) proxy(conn net.Conn, upstream string) {
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	upstreamConn, dialErr := e.dial(ctx, "tcp", upstream)
+	if dialErr != nil {
+		logrus.Warnf("Could not connect to %s: %v", upstream, dialErr)
+		return
+	}
+	defer upstreamConn.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		pipe(upstreamConn, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		pipe(conn, upstreamConn)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// closeWriter is implemented by the connections, that support TCP half-close
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe copies the data until src is drained, then closes the writing side of dst, so the
+// other direction can still finish. If it is not supported, dst is closed.
+func pipe(dst, src net.Conn) {
+	_, _ = io.Copy(dst, src)
+	if cw, ok := dst.(closeWriter); ok {
+		if closeErr := cw.CloseWrite(); closeErr == nil {
+			return
+		}
+	}
+	_ = dst.Close()
+}
+
+func appKey(app apps.App) string {
+	return app.Peer + "/" + app.Name
+}
+
+// NewExposer creates a new proxy exposer, that listens on the ports allocated on the host
+func NewExposer(host string, allocator nginx.PortAllocator, listen ListenFunc, dial DialFunc) listeners.Exposer {
+	return &Exposer{
+		host:    host,
+		ports:   allocator,
+		listen:  listen,
+		dial:    dial,
+		exposed: make(map[string]exposedApp),
+	}
+}
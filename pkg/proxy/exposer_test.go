@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/nginx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEchoServer(t *testing.T) string {
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, listenErr)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				fmt.Fprintf(conn, "echo: %s", line)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// newReadAllServer responds to every connection after the client finishes sending
+func newReadAllServer(t *testing.T) string {
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, listenErr)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				request, _ := io.ReadAll(conn)
+				fmt.Fprintf(conn, "received: %s", request)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func newTestExposer() *Exposer {
+	return NewExposer(
+		"127.0.0.1", nginx.NewRangePortAllocator(31000, 31100), net.Listen, (&net.Dialer{}).DialContext,
+	).(*Exposer)
+}
+
+func TestExposerProxiesConnections(t *testing.T) {
+	// given
+	exposer := newTestExposer()
+	defer exposer.WithdrawAll() // nolint: errcheck
+	app := apps.App{Name: "echo", Peer: "client1", Address: newEchoServer(t)}
+
+	// when
+	exposed, addErr := exposer.Add(context.Background(), app)
+	assert.NoError(t, addErr)
+	_, port, _ := net.SplitHostPort(exposed.Address)
+	conn, dialErr := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	assert.NoError(t, dialErr)
+	defer conn.Close()
+	fmt.Fprint(conn, "hello\n")
+	response, readErr := bufio.NewReader(conn).ReadString('\n')
+
+	// then
+	assert.NoError(t, readErr)
+	assert.Equal(t, "echo: hello\n", response)
+}
+
+func TestExposerKeepsHalfClosedConnectionsOpen(t *testing.T) {
+	// given
+	exposer := newTestExposer()
+	defer exposer.WithdrawAll() // nolint: errcheck
+	app := apps.App{Name: "read-all", Peer: "client1", Address: newReadAllServer(t)}
+	exposed, addErr := exposer.Add(context.Background(), app)
+	assert.NoError(t, addErr)
+	_, port, _ := net.SplitHostPort(exposed.Address)
+	conn, dialErr := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	assert.NoError(t, dialErr)
+	defer conn.Close()
+
+	// when
+	fmt.Fprint(conn, "hello")
+	closeErr := conn.(*net.TCPConn).CloseWrite()
+	response, readErr := io.ReadAll(conn)
+
+	// then
+	assert.NoError(t, closeErr)
+	assert.NoError(t, readErr)
+	assert.Equal(t, "received: hello", string(response))
+}
+
+func TestExposerWithdrawStopsListening(t *testing.T) {
+	// given
+	exposer := newTestExposer()
+	app := apps.App{Name: "echo", Peer: "client1", Address: newEchoServer(t)}
+	exposed, addErr := exposer.Add(context.Background(), app)
+	assert.NoError(t, addErr)
+
+	// when
+	withdrawErr := exposer.Withdraw(context.Background(), app)
+
+	// then
+	assert.NoError(t, withdrawErr)
+	_, port, _ := net.SplitHostPort(exposed.Address)
+	_, dialErr := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	assert.Error(t, dialErr)
+	assert.Empty(t, exposer.exposed)
+}
+
+func TestExposerRejectsUDPApps(t *testing.T) {
+	// given
+	exposer := newTestExposer()
+
+	// when
+	_, addErr := exposer.Add(context.Background(), apps.App{Name: "dns", Address: "10.0.0.2:53", Protocol: apps.ProtocolUDP})
+
+	// then
+	assert.Error(t, addErr)
+	assert.Empty(t, exposer.exposed)
+}
@@ -3,7 +3,7 @@ package syncing
 
 import (
 	"fmt"
-	"strings"
+	"net"
 	"sync"
 
 	"github.com/glothriel/wormhole/pkg/apps"
@@ -51,13 +51,12 @@ func (s *addressEnrichingAppSource) List() ([]apps.App, error) {
 	}
 	newApps := make([]apps.App, len(theApps))
 	for i := range theApps {
-		segments := strings.Split(theApps[i].Address, ":")
-		if len(segments) != 2 {
+		_, port, splitErr := net.SplitHostPort(theApps[i].Address)
+		if splitErr != nil {
 			return nil, fmt.Errorf("invalid address: %s", theApps[i].Address)
 		}
 
-		segments[0] = s.hostname
-		newApps[i] = apps.WithAddress(theApps[i], strings.Join(segments, ":"))
+		newApps[i] = apps.WithAddress(theApps[i], net.JoinHostPort(s.hostname, port))
 	}
 	return newApps, nil
 }
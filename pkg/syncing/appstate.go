@@ -16,12 +16,40 @@ type AppStateChangeGenerator struct {
 	lock    sync.Mutex
 }
 
-// UpdateForPeer is called when a sync message is received
-func (s *AppStateChangeGenerator) UpdateForPeer(peer string, theApps []apps.App) {
+// UpdateForPeer is called when a sync message is received, the changes continue the traces
+// received along with the apps
+func (s *AppStateChangeGenerator) UpdateForPeer(peer string, theApps []apps.App, traces AppTraces) {
 	logrus.Debugf("Received sync from %s with %d apps", peer, len(theApps))
+	s.update(peer, patchPeer(theApps, peer), traces)
+}
+
+// UpdateForRelay is called when a sync message is received from a peer, that may relay apps
+// exposed by other peers (the hub). Apps, that do not declare their originating peer are
+// attributed to the relaying peer.
+func (s *AppStateChangeGenerator) UpdateForRelay(peer string, theApps []apps.App, traces AppTraces) {
+	logrus.Debugf("Received sync from %s with %d apps", peer, len(theApps))
+	s.update(peer, patchEmptyPeer(theApps, peer), traces)
+}
+
+// WithdrawPeer withdraws all the apps of the peer, returning them
+func (s *AppStateChangeGenerator) WithdrawPeer(peer string) []apps.App {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	withdrawn := s.peerApps[peer]
+	for _, app := range withdrawn {
+		logrus.Infof("App %s.%s removed", app.Peer, app.Name)
+		s.changes <- svcdetector.AppStateChange{
+			App:   app,
+			State: svcdetector.AppStateChangeWithdrawn,
+		}
+	}
+	delete(s.peerApps, peer)
+	return withdrawn
+}
+
+func (s *AppStateChangeGenerator) update(peer string, theApps []apps.App, traces AppTraces) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	theApps = patchPeer(theApps, peer)
 	oldApps, oldAppsOk := s.peerApps[peer]
 	if !oldAppsOk {
 		oldApps = make([]apps.App, 0)
@@ -43,7 +71,7 @@ func (s *AppStateChangeGenerator) UpdateForPeer(peer string, theApps []apps.App)
 
 	for _, app := range theApps {
 		for _, oldApp := range oldApps {
-			if app.Name == oldApp.Name && app.Address != oldApp.Address {
+			if app.Name == oldApp.Name && app.Peer == oldApp.Peer && app.Address != oldApp.Address {
 				changedApps = append(changedApps, app)
 			}
 		}
@@ -54,6 +82,7 @@ func (s *AppStateChangeGenerator) UpdateForPeer(peer string, theApps []apps.App)
 		s.changes <- svcdetector.AppStateChange{
 			App:   app,
 			State: svcdetector.AppStateChangeAdded,
+			Trace: traces.of(app.Name),
 		}
 	}
 
@@ -62,6 +91,7 @@ func (s *AppStateChangeGenerator) UpdateForPeer(peer string, theApps []apps.App)
 		s.changes <- svcdetector.AppStateChange{
 			App:   app,
 			State: svcdetector.AppStateChangeWithdrawn,
+			Trace: traces.Sync,
 		}
 	}
 
@@ -70,10 +100,12 @@ func (s *AppStateChangeGenerator) UpdateForPeer(peer string, theApps []apps.App)
 		s.changes <- svcdetector.AppStateChange{
 			App:   app,
 			State: svcdetector.AppStateChangeWithdrawn,
+			Trace: traces.of(app.Name),
 		}
 		s.changes <- svcdetector.AppStateChange{
 			App:   app,
 			State: svcdetector.AppStateChangeAdded,
+			Trace: traces.of(app.Name),
 		}
 	}
 
@@ -95,7 +127,7 @@ func NewAppStateChangeGenerator() *AppStateChangeGenerator {
 
 func contains(apps []apps.App, app apps.App) bool {
 	for _, a := range apps {
-		if a.Name == app.Name {
+		if a.Name == app.Name && a.Peer == app.Peer {
 			return true
 		}
 	}
@@ -108,3 +140,12 @@ func patchPeer(a []apps.App, peerName string) []apps.App {
 	}
 	return a
 }
+
+func patchEmptyPeer(a []apps.App, peerName string) []apps.App {
+	for i := range a {
+		if a[i].Peer == "" {
+			a[i] = apps.WithPeer(a[i], peerName)
+		}
+	}
+	return a
+}
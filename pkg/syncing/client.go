@@ -1,12 +1,20 @@
 package syncing
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/glothriel/wormhole/pkg/metrics"
 	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/glothriel/wormhole/pkg/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client is a struct that orchestrates all the operations that are performed client-side
@@ -20,52 +28,199 @@ type Client struct {
 	transport            ClientTransport
 	failureThreshold     int
 	metadata             MetadataFactory
+
+	longPoll bool
+	notifier ChangeNotifier
+	observer MetadataObserver
+	dial     DialFunc
+	traces   TraceSource
+
+	incoming *incomingApps
+	outgoing *outgoingApps
+}
+
+// ClientOption allows customizing the syncing client
+type ClientOption func(*Client)
+
+// WithChangeNotifier allows the client to push the changes of its apps to the server as soon
+// as they happen, when the server supports long polling
+func WithChangeNotifier(notifier ChangeNotifier) ClientOption {
+	return func(c *Client) {
+		c.notifier = notifier
+	}
+}
+
+// MetadataObserver is notified about the metadata, that the server sends in sync responses
+type MetadataObserver interface {
+	Observe(map[string]string)
+}
+
+// WithMetadataObserver passes the string values of the metadata of every sync response to
+// the observer
+func WithMetadataObserver(observer MetadataObserver) ClientOption {
+	return func(c *Client) {
+		c.observer = observer
+	}
+}
+
+// WithDialer makes the clients created using NewHTTPClient connect to the server using the
+// dial function, for example over a userspace Wireguard interface
+func WithDialer(dial DialFunc) ClientOption {
+	return func(c *Client) {
+		c.dial = dial
+	}
 }
 
-// Start starts the syncing client
-func (c *Client) Start() error {
+// WithRequestTraces sends the traces of the apps of the client to the server, so the server
+// can continue them when exposing the apps
+func WithRequestTraces(source TraceSource) ClientOption {
+	return func(c *Client) {
+		c.traces = source
+	}
+}
+
+// withLongPolling makes the client wait for the changes on the server instead of periodic polling
+func withLongPolling() ClientOption {
+	return func(c *Client) {
+		c.longPoll = true
+	}
+}
+
+// Start starts the syncing client. It syncs until the context is done, returning nil, or the
+// syncs fail too many times in a row.
+func (c *Client) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var pushing sync.WaitGroup
+	defer pushing.Wait()
+	defer cancel()
+	if c.longPoll && c.notifier != nil {
+		pushing.Add(1)
+		go func() {
+			defer pushing.Done()
+			c.pushOnChange(ctx)
+		}()
+	}
 	failures := 0
 	for {
-		time.Sleep(c.interval)
-		apps, listErr := c.apps.List()
-		if listErr != nil {
-			logrus.Errorf("failed to list apps: %v", listErr)
-			continue
-		}
-		metadata, metadataErr := c.metadata.Get()
-		if metadataErr != nil {
-			logrus.Errorf("failed to get metadata: %v", metadataErr)
-			continue
+		if !c.longPoll && !sleep(ctx, c.interval) {
+			return nil
 		}
-		encodedApps, encodeErr := c.encoder.Encode(Message{
-			Peer:     c.myName,
-			Metadata: metadata,
-			Apps:     apps,
-		})
-		if encodeErr != nil {
-			logrus.Errorf("failed to encode apps: %v", encodeErr)
-			continue
+		received, err := c.sync(ctx, c.longPoll)
+		if ctx.Err() != nil {
+			return nil
 		}
-		incomingApps, err := c.transport.Sync(encodedApps)
 		if err != nil {
 			if failures >= c.failureThreshold {
 				return fmt.Errorf("fatal: failed to sync %d times in a row: %v", failures, err)
 			}
 			failures++
 			logrus.Errorf("failed to sync apps: %v", err)
+			if c.longPoll && !sleep(ctx, c.interval) {
+				return nil
+			}
 			continue
 		}
 		failures = 0
-		decodedMsg, decodeErr := c.encoder.Decode(incomingApps)
-		if decodeErr != nil {
-			logrus.Errorf("failed to decode incoming apps: %v", decodeErr)
-			continue
+		if c.longPoll && received.Revision == 0 {
+			// The server did not hold the request, do not flood it with syncs
+			if !sleep(ctx, c.interval) {
+				return nil
+			}
 		}
-		c.stateChangeGenerator.UpdateForPeer(
+	}
+}
+
+// pushOnChange syncs immediately after the local apps change
+func (c *Client) pushOnChange(ctx context.Context) {
+	changed := c.notifier.Changed()
+	for {
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+		changed = c.notifier.Changed()
+		if _, err := c.sync(ctx, false); err != nil && ctx.Err() == nil {
+			logrus.Errorf("failed to push changed apps: %v", err)
+		}
+	}
+}
+
+// sync performs a single sync with the server. Only transport errors are returned, the other
+// ones are logged, as retrying them immediately would not help.
+func (c *Client) sync(ctx context.Context, wait bool) (Message, error) {
+	_, span := tracing.Start(trace.SpanContext{}, "syncing.client.sync",
+		attribute.String("peer", c.myName),
+		attribute.Bool("long_poll", wait),
+	)
+	received, err := c.roundTrip(ctx, span, wait)
+	tracing.End(span, err)
+	return received, err
+}
+
+func (c *Client) roundTrip(ctx context.Context, span trace.Span, wait bool) (Message, error) {
+	msg, ok := c.message(span, wait)
+	if !ok {
+		return Message{}, nil
+	}
+	encodedApps, encodeErr := c.encoder.Encode(msg)
+	if encodeErr != nil {
+		logrus.Errorf("failed to encode apps: %v", encodeErr)
+		return Message{}, nil
+	}
+	startedAt := time.Now()
+	incomingApps, err := c.transport.Sync(ctx, encodedApps)
+	if err != nil {
+		metrics.SyncRoundTrips.WithLabelValues(c.myName, metrics.SyncResultFailure).Inc()
+		return Message{}, err
+	}
+	metrics.SyncRoundTripDuration.WithLabelValues(c.myName, strconv.FormatBool(wait)).Observe(
+		time.Since(startedAt).Seconds(),
+	)
+	metrics.SyncRoundTrips.WithLabelValues(c.myName, metrics.SyncResultSuccess).Inc()
+	decodedMsg, decodeErr := c.encoder.Decode(incomingApps)
+	if decodeErr != nil {
+		logrus.Errorf("failed to decode incoming apps: %v", decodeErr)
+		return Message{}, nil
+	}
+	_, appTraces := extractTraces(&decodedMsg)
+	c.outgoing.acknowledge(decodedMsg.Ack)
+	if c.observer != nil && len(decodedMsg.Metadata) > 0 {
+		c.observer.Observe(decodedMsg.Metadata.Strings())
+	}
+	serverApps, _, changed := c.incoming.apply(decodedMsg)
+	if changed {
+		c.stateChangeGenerator.UpdateForRelay(
 			decodedMsg.Peer,
-			decodedMsg.Apps,
+			serverApps,
+			AppTraces{Sync: span.SpanContext(), Apps: appTraces},
 		)
 	}
+	return decodedMsg, nil
+}
+
+// message prepares the message sent to the server, the errors are logged
+func (c *Client) message(span trace.Span, wait bool) (Message, bool) {
+	apps, listErr := c.apps.List()
+	if listErr != nil {
+		logrus.Errorf("failed to list apps: %v", listErr)
+		span.RecordError(listErr)
+		return Message{}, false
+	}
+	metadata, metadataErr := c.metadata.Get()
+	if metadataErr != nil {
+		logrus.Errorf("failed to get metadata: %v", metadataErr)
+		span.RecordError(metadataErr)
+		return Message{}, false
+	}
+	msg := Message{
+		Peer: c.myName,
+		Ack:  c.incoming.acknowledged(),
+		Wait: wait,
+	}
+	c.outgoing.prepare(&msg, apps)
+	msg.Metadata = withTraces(metadata, msg, span.SpanContext(), c.traces)
+	return msg, true
 }
 
 // NewClient creates a new SyncingClient instance
@@ -77,8 +232,9 @@ func NewClient(
 	apps AppSource,
 	transport ClientTransport,
 	MetadataFactory MetadataFactory,
+	opts ...ClientOption,
 ) *Client {
-	return &Client{
+	c := &Client{
 		myName:               myName,
 		stateChangeGenerator: nginxAdapter,
 		encoder:              encoder,
@@ -87,10 +243,17 @@ func NewClient(
 		transport:            transport,
 		failureThreshold:     3,
 		metadata:             MetadataFactory,
+		incoming:             &incomingApps{},
+		outgoing:             newOutgoingApps(),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
-// NewHTTPClient creates a new SyncingClient instance with HTTP transport
+// NewHTTPClient creates a new SyncingClient instance with HTTP transport, or gRPC transport
+// if the server advertised a gRPC address
 func NewHTTPClient(
 	myName string,
 	nginxAdapter *AppStateChangeGenerator,
@@ -99,20 +262,29 @@ func NewHTTPClient(
 	apps AppSource,
 	pr pairing.Response,
 	metadata MetadataFactory,
-
+	opts ...ClientOption,
 ) (*Client, error) {
 	syncServerAddress, ok := pr.Metadata["sync_server_address"]
 	if !ok {
 		return nil, errors.New("sync_server_address not found in pairing response metadata")
 	}
-	transport := NewHTTPClientTransport(syncServerAddress, 3*time.Second)
-	return NewClient(
-		myName,
-		nginxAdapter,
-		encoder,
-		interval,
-		apps,
-		transport,
-		metadata,
-	), nil
+	timeout := 3 * time.Second
+	if rawLongPollTimeout, longPollOk := pr.Metadata[longPollTimeoutMetadataKey]; longPollOk {
+		longPollTimeout, parseErr := time.ParseDuration(rawLongPollTimeout)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid %s in pairing response metadata: %w", longPollTimeoutMetadataKey, parseErr)
+		}
+		logrus.Infof("Server supports long polling, waiting up to %s for changes", longPollTimeout)
+		timeout += longPollTimeout
+		opts = append(opts, withLongPolling())
+	}
+	c := NewClient(myName, nginxAdapter, encoder, interval, apps, nil, metadata, opts...)
+	c.transport = NewHTTPClientTransport(syncServerAddress, timeout, c.dial)
+	if strings.HasPrefix(syncServerAddress, grpcAddressPrefix) {
+		var transportErr error
+		if c.transport, transportErr = NewGRPCClientTransport(syncServerAddress, timeout, c.dial); transportErr != nil {
+			return nil, transportErr
+		}
+	}
+	return c, nil
 }
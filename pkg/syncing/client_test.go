@@ -1,8 +1,10 @@
 package syncing
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,7 +15,7 @@ type mockSyncClientTransport struct {
 	returnError    error
 }
 
-func (m *mockSyncClientTransport) Sync(data []byte) ([]byte, error) {
+func (m *mockSyncClientTransport) Sync(_ context.Context, data []byte) ([]byte, error) {
 	m.lastCalledWith = data
 	return m.returnValue, m.returnError
 }
@@ -33,9 +35,30 @@ func TestClientStartFailsAfterXSyncFailures(t *testing.T) {
 	)
 
 	// when
-	startErr := client.Start()
+	startErr := client.Start(context.Background())
 
 	// then
 	assert.Error(t, startErr)
 	assert.Contains(t, startErr.Error(), "failed to sync 3 times in a row")
 }
+
+func TestClientStartReturnsWhenContextIsDone(t *testing.T) {
+	// given
+	client := NewClient(
+		"client",
+		NewAppStateChangeGenerator(),
+		NewJSONSyncingEncoder(),
+		time.Hour,
+		NewInMemoryAppStorage(),
+		&mockSyncClientTransport{},
+		NewStaticMetadataFactory(Metadata{}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	startErr := client.Start(ctx)
+
+	// then
+	assert.NoError(t, startErr)
+}
@@ -2,8 +2,23 @@ package syncing
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/glothriel/wormhole/pkg/wormholepb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// EncodingJSON is the name of the encoding used by NewJSONSyncingEncoder
+	EncodingJSON = "json"
+	// EncodingProtobuf is the name of the encoding used by NewProtobufSyncingEncoder
+	EncodingProtobuf = "protobuf"
+
+	// encodingsMetadataKey is used to advertise the encodings supported by the server
+	// in pairing metadata
+	encodingsMetadataKey = "sync_encodings"
 )
 
 // Message is a message that contains a list of apps and the peer that sent them
@@ -11,6 +26,18 @@ type Message struct {
 	Peer     string
 	Metadata Metadata
 	Apps     []apps.App
+
+	// Revision identifies the list of apps of the sender, zero if the sender does not
+	// support revisions
+	Revision uint64 `json:",omitempty"`
+	// Ack is the last revision of the receiver's list of apps, that the sender applied
+	Ack uint64 `json:",omitempty"`
+	// Delta, when set, is sent instead of Apps and contains only the changes since the
+	// revision acknowledged by the receiver
+	Delta *Delta `json:",omitempty"`
+	// Wait asks the server to hold the response until the apps differ from the ones, that
+	// the client acknowledged (long polling)
+	Wait bool `json:",omitempty"`
 }
 
 // Encoder is an interface for encoding and decoding syncing messages
@@ -35,3 +62,79 @@ func (e *jsonEncoder) Decode(data []byte) (Message, error) {
 func NewJSONSyncingEncoder() Encoder {
 	return &jsonEncoder{}
 }
+
+type protobufEncoder struct{}
+
+func (e *protobufEncoder) Encode(msg Message) ([]byte, error) {
+	metadata, metadataErr := structpb.NewStruct(msg.Metadata)
+	if metadataErr != nil {
+		return nil, metadataErr
+	}
+	pbMsg := &wormholepb.SyncMessage{
+		Peer:     msg.Peer,
+		Metadata: metadata,
+		Apps:     wormholepb.FromApps(msg.Apps),
+		Revision: msg.Revision,
+		Ack:      msg.Ack,
+		Wait:     msg.Wait,
+	}
+	if msg.Delta != nil {
+		pbMsg.Delta = &wormholepb.Delta{
+			Base:     msg.Delta.Base,
+			Upserted: wormholepb.FromApps(msg.Delta.Upserted),
+			Removed:  wormholepb.FromApps(msg.Delta.Removed),
+		}
+	}
+	return wormholepb.Marshal(pbMsg)
+}
+
+func (e *protobufEncoder) Decode(data []byte) (Message, error) {
+	var pbMsg wormholepb.SyncMessage
+	if unmarshalErr := wormholepb.Unmarshal(data, &pbMsg); unmarshalErr != nil {
+		return Message{}, unmarshalErr
+	}
+	msg := Message{
+		Peer:     pbMsg.GetPeer(),
+		Metadata: pbMsg.GetMetadata().AsMap(),
+		Apps:     wormholepb.ToApps(pbMsg.GetApps()),
+		Revision: pbMsg.GetRevision(),
+		Ack:      pbMsg.GetAck(),
+		Wait:     pbMsg.GetWait(),
+	}
+	if pbMsg.Delta != nil {
+		msg.Delta = &Delta{
+			Base:     pbMsg.Delta.GetBase(),
+			Upserted: wormholepb.ToApps(pbMsg.Delta.GetUpserted()),
+			Removed:  wormholepb.ToApps(pbMsg.Delta.GetRemoved()),
+		}
+	}
+	return msg, nil
+}
+
+// NewProtobufSyncingEncoder creates a new SyncingEncoder instance, that uses compact protobuf
+// encoding. Servers accept it only when configured using WithEncoders.
+func NewProtobufSyncingEncoder() Encoder {
+	return &protobufEncoder{}
+}
+
+// NegotiateEncoder returns the encoder the client should use, based on the encodings
+// advertised by the server in the pairing response. Servers, that do not advertise any
+// encodings, support only JSON.
+func NegotiateEncoder(pr pairing.Response) Encoder {
+	for _, encoding := range strings.Split(pr.Metadata[encodingsMetadataKey], ",") {
+		if strings.TrimSpace(encoding) == EncodingProtobuf {
+			return NewProtobufSyncingEncoder()
+		}
+	}
+	return NewJSONSyncingEncoder()
+}
+
+func encodingOf(encoder Encoder) string {
+	switch encoder.(type) {
+	case *jsonEncoder:
+		return EncodingJSON
+	case *protobufEncoder:
+		return EncodingProtobuf
+	}
+	return ""
+}
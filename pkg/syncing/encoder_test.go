@@ -0,0 +1,113 @@
+package syncing
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtobufEncoderRoundTrip(t *testing.T) {
+	// given
+	msg := Message{
+		Peer:     "client1",
+		Metadata: Metadata{"region": "eu", "replicas": float64(3)},
+		Apps: []apps.App{{
+			Name:         "nginx",
+			Address:      "10.0.0.2:20000",
+			Peer:         "client1",
+			OriginalPort: 80,
+			TargetLabels: "app=nginx",
+			Protocol:     apps.ProtocolTCP,
+			AllowedPeers: []string{"client2"},
+		}},
+		Revision: 12,
+		Ack:      7,
+		Delta: &Delta{
+			Base:     11,
+			Upserted: []apps.App{{Name: "redis", Peer: "client1"}},
+			Removed:  []apps.App{{Name: "postgres", Peer: "client1"}},
+		},
+		Wait: true,
+	}
+	encoder := NewProtobufSyncingEncoder()
+
+	// when
+	encoded, encodeErr := encoder.Encode(msg)
+	decoded, decodeErr := encoder.Decode(encoded)
+
+	// then
+	assert.NoError(t, encodeErr)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, msg, decoded)
+}
+
+func TestProtobufEncoderIsSmallerThanJSON(t *testing.T) {
+	// given
+	msg := Message{Peer: "client1", Metadata: Metadata{}}
+	for i := 0; i < 500; i++ {
+		msg.Apps = append(msg.Apps, apps.App{
+			Name:         fmt.Sprintf("app-%d", i),
+			Address:      fmt.Sprintf("10.0.0.2:%d", 20000+i),
+			Peer:         "client1",
+			OriginalPort: 8080,
+		})
+	}
+
+	// when
+	jsonEncoded, jsonErr := NewJSONSyncingEncoder().Encode(msg)
+	protobufEncoded, protobufErr := NewProtobufSyncingEncoder().Encode(msg)
+
+	// then
+	assert.NoError(t, jsonErr)
+	assert.NoError(t, protobufErr)
+	assert.Less(t, len(protobufEncoded)*2, len(jsonEncoded))
+}
+
+func TestProtobufEncoderRejectsJSON(t *testing.T) {
+	// given
+	encoded, encodeErr := NewJSONSyncingEncoder().Encode(Message{Peer: "client1"})
+	assert.NoError(t, encodeErr)
+
+	// when
+	_, decodeErr := NewProtobufSyncingEncoder().Decode(encoded)
+
+	// then
+	assert.Error(t, decodeErr)
+}
+
+func TestNegotiateEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		expected Encoder
+	}{
+		{
+			name:     "Server without advertised encodings",
+			metadata: map[string]string{},
+			expected: NewJSONSyncingEncoder(),
+		},
+		{
+			name:     "Server supporting only JSON",
+			metadata: map[string]string{encodingsMetadataKey: "json"},
+			expected: NewJSONSyncingEncoder(),
+		},
+		{
+			name:     "Server supporting protobuf",
+			metadata: map[string]string{encodingsMetadataKey: "json,protobuf"},
+			expected: NewProtobufSyncingEncoder(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			encoder := NegotiateEncoder(pairing.Response{Metadata: tt.metadata})
+
+			// then
+			assert.IsType(t, tt.expected, encoder)
+		})
+	}
+}
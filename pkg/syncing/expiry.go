@@ -0,0 +1,115 @@
+package syncing
+
+import (
+	"context"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/sirupsen/logrus"
+)
+
+// expiryCheckInterval is how often the server looks for peers, that stopped syncing
+const expiryCheckInterval = 10 * time.Second
+
+// PeerDeleter removes the peers, that stopped syncing, together with their Wireguard configuration
+type PeerDeleter interface {
+	Delete(name string) (pairing.PeerInfo, error)
+}
+
+type peerExpiry struct {
+	appsTTL time.Duration
+	peerTTL time.Duration
+	deleter PeerDeleter
+}
+
+// WithPeerExpiry withdraws the apps of the peers, that did not sync for appsTTL. If peerTTL is
+// not zero, the peers silent for that long are deleted using the deleter, freeing their IPs.
+// Peers, that did not sync since the server started, are counted as silent since the start.
+func WithPeerExpiry(appsTTL, peerTTL time.Duration, deleter PeerDeleter) ServerOption {
+	return func(s *Server) {
+		s.expiry = &peerExpiry{
+			appsTTL: appsTTL,
+			peerTTL: peerTTL,
+			deleter: deleter,
+		}
+	}
+}
+
+func (s *Server) expirePeersEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.expirePeers(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// expirePeers withdraws the apps of the silent peers and deletes the ones silent for too long
+func (s *Server) expirePeers(now time.Time) {
+	peers, listErr := s.peers.List()
+	if listErr != nil {
+		logrus.Errorf("Failed to list peers for expiry: %v", listErr)
+		return
+	}
+	for _, peer := range peers {
+		silence := now.Sub(s.lastSeen(peer.Name))
+		if s.expiry.peerTTL > 0 && silence > s.expiry.peerTTL {
+			logrus.Infof("Peer %s did not sync for %s, deleting it", peer.Name, silence.Round(time.Second))
+			if _, deleteErr := s.expiry.deleter.Delete(peer.Name); deleteErr != nil {
+				logrus.Errorf("Failed to delete expired peer %s: %v", peer.Name, deleteErr)
+				continue
+			}
+			s.ForgetPeer(peer.Name)
+			continue
+		}
+		if s.expiry.appsTTL > 0 && silence > s.expiry.appsTTL && s.isTracked(peer.Name) {
+			logrus.Infof("Peer %s did not sync for %s, withdrawing its apps", peer.Name, silence.Round(time.Second))
+			s.withdrawPeer(peer.Name)
+		}
+	}
+}
+
+// lastSeen returns the time of the last sync of the peer, or the start of the server
+func (s *Server) lastSeen(peer string) time.Time {
+	if lastSync, synced := s.LastSync(peer); synced {
+		return lastSync
+	}
+	return s.startedAt
+}
+
+// isTracked checks if the server tracks the apps of the peer, that is if the peer synced since
+// its apps were last withdrawn
+func (s *Server) isTracked(peer string) bool {
+	s.revisionsLock.Lock()
+	defer s.revisionsLock.Unlock()
+	_, tracked := s.incoming[peer]
+	return tracked
+}
+
+// withdrawPeer withdraws all the apps of the peer. The revisions exchanged with the peer are
+// reset, so the full lists of apps are exchanged on the next sync.
+func (s *Server) withdrawPeer(peer string) []apps.App {
+	s.revisionsLock.Lock()
+	delete(s.incoming, peer)
+	delete(s.outgoing, peer)
+	s.revisionsLock.Unlock()
+	if s.relay != nil {
+		s.relay.WithdrawPeer(peer)
+	}
+	return s.stateGenerator.WithdrawPeer(peer)
+}
+
+// ForgetPeer withdraws all the apps of the peer and forgets its syncs, it should be called
+// when the peer is deleted. The withdrawn apps are returned.
+func (s *Server) ForgetPeer(peer string) []apps.App {
+	withdrawn := s.withdrawPeer(peer)
+	s.revisionsLock.Lock()
+	defer s.revisionsLock.Unlock()
+	delete(s.lastSyncs, peer)
+	return withdrawn
+}
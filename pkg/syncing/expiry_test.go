@@ -0,0 +1,125 @@
+package syncing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/k8s/svcdetector"
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPeerDeleter struct {
+	peers   pairing.PeerStorage
+	deleted []string
+}
+
+func (d *mockPeerDeleter) Delete(name string) (pairing.PeerInfo, error) {
+	d.deleted = append(d.deleted, name)
+	return pairing.PeerInfo{Name: name}, d.peers.DeleteByName(name)
+}
+
+func newExpiryTestServer(
+	t *testing.T, appsTTL, peerTTL time.Duration,
+) (*Server, *mockPeerDeleter, chan svcdetector.AppStateChange) {
+	peers := pairing.NewInMemoryPeerStorage()
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client1"}))
+	deleter := &mockPeerDeleter{peers: peers}
+	generator := NewAppStateChangeGenerator()
+	changes := make(chan svcdetector.AppStateChange, 10)
+	go func() {
+		for change := range generator.Changes() {
+			changes <- change
+		}
+	}()
+	server := NewServer(
+		"server",
+		generator,
+		&staticAppSource{},
+		NewJSONSyncingEncoder(),
+		nil,
+		peers,
+		NewInMemoryMetadataStorage(),
+		WithPeerExpiry(appsTTL, peerTTL, deleter),
+	)
+	server.revisionsFor("client1")
+	server.recordSync("client1")
+	generator.UpdateForPeer("client1", []apps.App{{Name: "nginx", Address: "10.188.0.2:20000"}}, AppTraces{})
+	<-changes
+	return server, deleter, changes
+}
+
+func TestServerWithdrawsAppsOfSilentPeers(t *testing.T) {
+	// given
+	server, deleter, changes := newExpiryTestServer(t, time.Minute, time.Hour)
+
+	// when
+	server.expirePeers(time.Now().Add(time.Minute * 2))
+
+	// then
+	change := <-changes
+	assert.Equal(t, svcdetector.AppStateChangeWithdrawn, change.State)
+	assert.Equal(t, "nginx", change.App.Name)
+	assert.Equal(t, "client1", change.App.Peer)
+	assert.False(t, server.isTracked("client1"))
+	_, synced := server.LastSync("client1")
+	assert.True(t, synced)
+	assert.Empty(t, deleter.deleted)
+}
+
+func TestServerKeepsAppsOfSyncingPeers(t *testing.T) {
+	// given
+	server, deleter, changes := newExpiryTestServer(t, time.Minute, time.Hour)
+
+	// when
+	server.expirePeers(time.Now().Add(time.Second * 30))
+
+	// then
+	assert.Empty(t, changes)
+	assert.True(t, server.isTracked("client1"))
+	assert.Empty(t, deleter.deleted)
+}
+
+func TestServerDeletesPeersSilentForPeerTTL(t *testing.T) {
+	tests := []struct {
+		name            string
+		peerTTL         time.Duration
+		expectedDeleted []string
+	}{
+		{name: "Eviction enabled", peerTTL: time.Hour, expectedDeleted: []string{"client1"}},
+		{name: "Eviction disabled", peerTTL: 0, expectedDeleted: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			server, deleter, changes := newExpiryTestServer(t, time.Minute, tt.peerTTL)
+
+			// when
+			server.expirePeers(time.Now().Add(time.Hour * 2))
+
+			// then
+			change := <-changes
+			assert.Equal(t, svcdetector.AppStateChangeWithdrawn, change.State)
+			assert.Equal(t, tt.expectedDeleted, deleter.deleted)
+			_, synced := server.LastSync("client1")
+			assert.Equal(t, tt.expectedDeleted == nil, synced)
+		})
+	}
+}
+
+func TestServerForgetPeerReturnsWithdrawnApps(t *testing.T) {
+	// given
+	server, _, changes := newExpiryTestServer(t, time.Minute, 0)
+
+	// when
+	withdrawn := server.ForgetPeer("client1")
+
+	// then
+	assert.Equal(t, []apps.App{{Name: "nginx", Address: "10.188.0.2:20000", Peer: "client1"}}, withdrawn)
+	assert.Equal(t, svcdetector.AppStateChangeWithdrawn, (<-changes).State)
+	assert.False(t, server.isTracked("client1"))
+	_, synced := server.LastSync("client1")
+	assert.False(t, synced)
+}
@@ -0,0 +1,248 @@
+package syncing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/wormholepb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// grpcAddressPrefix marks sync server addresses, that should be accessed using gRPC
+const grpcAddressPrefix = "grpc://"
+
+type grpcServerTransport struct {
+	wormholepb.UnimplementedSyncingServer
+
+	syncs   chan IncomingSyncRequest
+	address string
+}
+
+func (t *grpcServerTransport) Syncs() <-chan IncomingSyncRequest {
+	return t.syncs
+}
+
+func (t *grpcServerTransport) Metadata() map[string]string {
+	return map[string]string{
+		"sync_server_address": grpcAddressPrefix + t.address,
+	}
+}
+
+func (t *grpcServerTransport) Sync(stream wormholepb.Syncing_SyncServer) error {
+	var sendLock sync.Mutex
+	var inFlight sync.WaitGroup
+	defer inFlight.Wait()
+	for {
+		envelope, recvErr := stream.Recv()
+		if recvErr != nil {
+			if errors.Is(recvErr, io.EOF) {
+				return nil
+			}
+			return recvErr
+		}
+		req := IncomingSyncRequest{
+			Request:  envelope.Payload,
+			Response: make(chan []byte),
+			Err:      make(chan error),
+		}
+		t.syncs <- req
+		inFlight.Add(1)
+		go func(id uint64) {
+			defer inFlight.Done()
+			response := &wormholepb.Envelope{Id: id}
+			select {
+			case resp := <-req.Response:
+				response.Payload = resp
+			case err := <-req.Err:
+				response.Error = err.Error()
+			}
+			if stream.Context().Err() != nil {
+				return
+			}
+			sendLock.Lock()
+			defer sendLock.Unlock()
+			if sendErr := stream.Send(response); sendErr != nil {
+				logrus.Errorf("Failed to send sync response: %v", sendErr)
+			}
+		}(envelope.Id)
+	}
+}
+
+// serve serves the syncs until the listener fails or the context is done. In the latter case
+// it returns after all the streams are closed, so no more syncs are received.
+func (t *grpcServerTransport) serve(ctx context.Context, listener net.Listener) error {
+	server := grpc.NewServer(grpc.WaitForHandlers(true))
+	wormholepb.RegisterSyncingServer(server, t)
+	served, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			server.Stop()
+		case <-served:
+		}
+	}()
+	serveErr := server.Serve(listener)
+	close(served)
+	<-stopped
+	return serveErr
+}
+
+// NewGRPCServerSyncingTransport creates a new SyncServerTransport instance, that receives
+// the syncs over gRPC streams. When the context is done, the server is stopped, waiting for
+// the syncs in progress.
+func NewGRPCServerSyncingTransport(ctx context.Context, address string) ServerTransport {
+	transport := &grpcServerTransport{
+		syncs:   make(chan IncomingSyncRequest),
+		address: address,
+	}
+	go func() {
+		defer close(transport.syncs)
+		for ctx.Err() == nil {
+			logrus.Infof("Starting gRPC syncing transport server on %s", address)
+			listener, listenErr := net.Listen("tcp", address)
+			if listenErr != nil {
+				logrus.Errorf("Failed to start gRPC syncing transport server: %v", listenErr)
+				sleep(ctx, time.Second*5)
+				continue
+			}
+			if serveErr := transport.serve(ctx, listener); serveErr != nil && ctx.Err() == nil {
+				logrus.Errorf("gRPC syncing transport server failed: %v", serveErr)
+				sleep(ctx, time.Second*5)
+			}
+		}
+		logrus.Infof("Stopped gRPC syncing transport server on %s", address)
+	}()
+	return transport
+}
+
+// grpcClientTransport keeps a single stream open and multiplexes the syncs over it, the
+// responses are matched with the requests using envelope ids
+type grpcClientTransport struct {
+	client  wormholepb.SyncingClient
+	timeout time.Duration
+
+	lock    sync.Mutex
+	stream  wormholepb.Syncing_SyncClient
+	cancel  context.CancelFunc
+	lastID  uint64
+	pending map[uint64]chan *wormholepb.Envelope
+}
+
+func (t *grpcClientTransport) Sync(ctx context.Context, req []byte) ([]byte, error) {
+	id, responses, sendErr := t.send(req)
+	if sendErr != nil {
+		return nil, sendErr
+	}
+	timeout := time.NewTimer(t.timeout)
+	defer timeout.Stop()
+	select {
+	case response, ok := <-responses:
+		if !ok {
+			return nil, errors.New("sync stream was closed before receiving the response")
+		}
+		if response.Error != "" {
+			return nil, fmt.Errorf("server failed to process the sync: %s", response.Error)
+		}
+		return response.Payload, nil
+	case <-timeout.C:
+		t.forget(id)
+		return nil, fmt.Errorf("timed out after %s waiting for the sync response", t.timeout)
+	case <-ctx.Done():
+		t.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+// forget stops waiting for the response of the sync with the given id
+func (t *grpcClientTransport) forget(id uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.pending, id)
+}
+
+func (t *grpcClientTransport) send(req []byte) (uint64, chan *wormholepb.Envelope, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.stream == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, streamErr := t.client.Sync(ctx)
+		if streamErr != nil {
+			cancel()
+			return 0, nil, streamErr
+		}
+		t.stream = stream
+		t.cancel = cancel
+		go t.receive(stream)
+	}
+	t.lastID++
+	responses := make(chan *wormholepb.Envelope, 1)
+	t.pending[t.lastID] = responses
+	if sendErr := t.stream.Send(&wormholepb.Envelope{Id: t.lastID, Payload: req}); sendErr != nil {
+		delete(t.pending, t.lastID)
+		t.closeStream()
+		return 0, nil, sendErr
+	}
+	return t.lastID, responses, nil
+}
+
+func (t *grpcClientTransport) receive(stream wormholepb.Syncing_SyncClient) {
+	for {
+		envelope, recvErr := stream.Recv()
+		t.lock.Lock()
+		if recvErr != nil {
+			if t.stream == stream {
+				logrus.Warnf("Sync stream closed: %v", recvErr)
+				t.closeStream()
+			}
+			t.lock.Unlock()
+			return
+		}
+		responses, ok := t.pending[envelope.Id]
+		delete(t.pending, envelope.Id)
+		t.lock.Unlock()
+		if ok {
+			responses <- envelope
+		}
+	}
+}
+
+// closeStream drops the current stream, failing all the pending syncs. Must be called with
+// the lock held.
+func (t *grpcClientTransport) closeStream() {
+	t.cancel()
+	t.stream = nil
+	for id, responses := range t.pending {
+		close(responses)
+		delete(t.pending, id)
+	}
+}
+
+// NewGRPCClientTransport creates a new SyncClientTransport instance, that syncs over a gRPC
+// stream. The stream is reopened on the next sync after it breaks. Connections are opened
+// using the dial function, or the default dialer, if it is nil.
+func NewGRPCClientTransport(serverAddress string, timeout time.Duration, dial DialFunc) (ClientTransport, error) {
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if dial != nil {
+		dialOpts = append(dialOpts, grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return dial(ctx, "tcp", address)
+		}))
+	}
+	conn, connErr := grpc.NewClient(strings.TrimPrefix(serverAddress, grpcAddressPrefix), dialOpts...)
+	if connErr != nil {
+		return nil, connErr
+	}
+	return &grpcClientTransport{
+		client:  wormholepb.NewSyncingClient(conn),
+		timeout: timeout,
+		pending: make(map[uint64]chan *wormholepb.Envelope),
+	}, nil
+}
@@ -0,0 +1,65 @@
+package syncing
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGRPCTransportMatchesOutOfOrderResponses(t *testing.T) {
+	// given
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, listenErr)
+	server := &grpcServerTransport{syncs: make(chan IncomingSyncRequest)}
+	go func() {
+		_ = server.serve(context.Background(), listener)
+	}()
+	client, clientErr := NewGRPCClientTransport(grpcAddressPrefix+listener.Addr().String(), time.Second*5, nil)
+	assert.NoError(t, clientErr)
+
+	// when
+	held := make(chan []byte)
+	go func() {
+		resp, err := client.Sync(context.Background(), []byte("held"))
+		assert.NoError(t, err)
+		held <- resp
+	}()
+	heldReq := <-server.Syncs()
+	immediate := make(chan []byte)
+	go func() {
+		resp, err := client.Sync(context.Background(), []byte("immediate"))
+		assert.NoError(t, err)
+		immediate <- resp
+	}()
+	immediateReq := <-server.Syncs()
+	immediateReq.Response <- append([]byte("re: "), immediateReq.Request...)
+	immediateResp := <-immediate
+	heldReq.Response <- append([]byte("re: "), heldReq.Request...)
+	heldResp := <-held
+
+	// then
+	assert.Equal(t, "re: immediate", string(immediateResp))
+	assert.Equal(t, "re: held", string(heldResp))
+}
+
+func TestGRPCServerTransportClosesSyncsOnShutdown(t *testing.T) {
+	// given
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := NewGRPCServerSyncingTransport(ctx, "127.0.0.1:0")
+
+	// when
+	cancel()
+
+	// then
+	assert.Eventually(t, func() bool {
+		select {
+		case _, open := <-transport.Syncs():
+			return !open
+		default:
+			return false
+		}
+	}, time.Second*5, time.Millisecond*10)
+}
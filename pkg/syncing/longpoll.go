@@ -0,0 +1,97 @@
+package syncing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// longPollTimeoutMetadataKey is used to advertise long polling support in pairing metadata
+const longPollTimeoutMetadataKey = "sync_long_poll_timeout"
+
+// ChangeNotifier allows waiting for changes, for example of the list of apps
+type ChangeNotifier interface {
+	// Changed returns a channel, that is closed the next time a change occurs
+	Changed() <-chan struct{}
+}
+
+type changeBroadcaster struct {
+	lock      sync.Mutex
+	changed   chan struct{}
+	notifiers []ChangeNotifier
+}
+
+func (b *changeBroadcaster) Changed() <-chan struct{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return b.changed
+}
+
+func (b *changeBroadcaster) notify() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
+
+// forward notifies the broadcaster about every change of its notifiers, until the context is done
+func (b *changeBroadcaster) forward(ctx context.Context) {
+	for _, notifier := range b.notifiers {
+		go func(notifier ChangeNotifier) {
+			for {
+				select {
+				case <-notifier.Changed():
+					b.notify()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(notifier)
+	}
+}
+
+// WithLongPolling allows the clients to wait up to given timeout for changes of the apps,
+// instead of polling the server periodically. The server is notified about the changes
+// by the given notifiers.
+func WithLongPolling(timeout time.Duration, notifiers ...ChangeNotifier) ServerOption {
+	return func(s *Server) {
+		s.longPollTimeout = timeout
+		s.changes = &changeBroadcaster{notifiers: notifiers}
+	}
+}
+
+// respondOnChange holds the response until the apps visible to the peer differ from the ones
+// it acknowledged, the long polling timeout is reached or the context is done
+func (s *Server) respondOnChange(ctx context.Context, pending pendingSync) {
+	timeout := time.NewTimer(s.longPollTimeout)
+	defer timeout.Stop()
+	for {
+		changed := s.changes.Changed()
+		theApps, listErr := s.listFor(pending.peer)
+		if listErr != nil {
+			pending.request.Err <- listErr
+			return
+		}
+		if !pending.outgoing.upToDate(theApps) {
+			s.respond(pending, theApps)
+			return
+		}
+		select {
+		case <-changed:
+			logrus.Debugf("Apps changed, checking if the held sync of %s should be answered", pending.peer)
+		case <-timeout.C:
+			s.respond(pending, theApps)
+			return
+		case <-ctx.Done():
+			s.respond(pending, theApps)
+			return
+		}
+	}
+}
@@ -3,6 +3,8 @@ package syncing
 import (
 	"encoding/json"
 	"errors"
+	"io"
+	"reflect"
 	"sync"
 
 	"github.com/sirupsen/logrus"
@@ -15,6 +17,17 @@ var ErrPeerNotFound = errors.New("not found")
 // Metadata allows storing arbitrary metadata in sync messages
 type Metadata map[string]any
 
+// Strings returns the metadata entries with string values
+func (m Metadata) Strings() map[string]string {
+	strings := make(map[string]string, len(m))
+	for k, v := range m {
+		if s, ok := v.(string); ok {
+			strings[k] = s
+		}
+	}
+	return strings
+}
+
 // MetadataListItem is used to present metadata in a list
 type MetadataListItem struct {
 	Peer     string
@@ -134,6 +147,11 @@ func (s *boltMetadataStorage) Get(peer string) (Metadata, error) {
 	return metadata, err
 }
 
+// Close closes the database
+func (s *boltMetadataStorage) Close() error {
+	return s.db.Close()
+}
+
 // NewBoltMetadataStorage creates a new metadata storage that stores metadata in a BoltDB database
 func NewBoltMetadataStorage(path string) (MetadataStorage, error) {
 	db, err := bolt.Open(path, 0600, nil)
@@ -158,7 +176,12 @@ func (s *cachingMetadataStorage) List() ([]MetadataListItem, error) {
 	return s.cache.List()
 }
 
+// Set stores the metadata, unless it did not change. Peers send their metadata with every
+// sync, so the writes to the underlying storage are skipped most of the time.
 func (s *cachingMetadataStorage) Set(peer string, metadata Metadata) error {
+	if cached, getErr := s.cache.Get(peer); getErr == nil && reflect.DeepEqual(cached, metadata) {
+		return nil
+	}
 	childErr := s.storage.Set(peer, metadata)
 	if childErr != nil {
 		return childErr
@@ -166,6 +189,14 @@ func (s *cachingMetadataStorage) Set(peer string, metadata Metadata) error {
 	return s.cache.Set(peer, metadata)
 }
 
+// Close closes the underlying storage, if it can be closed
+func (s *cachingMetadataStorage) Close() error {
+	if closer, ok := s.storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 func (s *cachingMetadataStorage) Get(peer string) (Metadata, error) {
 	metadata, err := s.cache.Get(peer)
 	if err == nil {
@@ -0,0 +1,37 @@
+package syncing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingMetadataStorage struct {
+	MetadataStorage
+	sets int
+}
+
+func (s *countingMetadataStorage) Set(peer string, metadata Metadata) error {
+	s.sets++
+	return s.MetadataStorage.Set(peer, metadata)
+}
+
+func TestCachingMetadataStorageSkipsUnchangedMetadata(t *testing.T) {
+	// given
+	child := &countingMetadataStorage{MetadataStorage: NewInMemoryMetadataStorage()}
+	storage := NewCachingMetadataStorage(child)
+
+	// when
+	firstErr := storage.Set("client1", Metadata{"version": "1.0"})
+	repeatedErr := storage.Set("client1", Metadata{"version": "1.0"})
+	changedErr := storage.Set("client1", Metadata{"version": "1.1"})
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.NoError(t, repeatedErr)
+	assert.NoError(t, changedErr)
+	assert.Equal(t, 2, child.sets)
+	stored, getErr := child.Get("client1")
+	assert.NoError(t, getErr)
+	assert.Equal(t, Metadata{"version": "1.1"}, stored)
+}
@@ -0,0 +1,143 @@
+package syncing
+
+import (
+	"fmt"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+)
+
+// AppPolicy decides which peers are allowed to see a given app
+type AppPolicy interface {
+	IsAllowed(app apps.App, peer string) bool
+	// IsAllowedForAny checks if there may be any peer allowed to see the app
+	IsAllowedForAny(app apps.App) bool
+}
+
+type allPeersAppPolicy struct{}
+
+func (p *allPeersAppPolicy) IsAllowed(_ apps.App, _ string) bool {
+	return true
+}
+
+func (p *allPeersAppPolicy) IsAllowedForAny(_ apps.App) bool {
+	return true
+}
+
+// NewAllPeersAppPolicy creates an AppPolicy, that allows every peer to see every app
+func NewAllPeersAppPolicy() AppPolicy {
+	return &allPeersAppPolicy{}
+}
+
+type noPeersAppPolicy struct{}
+
+func (p *noPeersAppPolicy) IsAllowed(_ apps.App, _ string) bool {
+	return false
+}
+
+func (p *noPeersAppPolicy) IsAllowedForAny(_ apps.App) bool {
+	return false
+}
+
+// NewNoPeersAppPolicy creates an AppPolicy, that does not allow any peer to see any app
+func NewNoPeersAppPolicy() AppPolicy {
+	return &noPeersAppPolicy{}
+}
+
+type allowedPeersAppPolicy struct{}
+
+func (p *allowedPeersAppPolicy) IsAllowed(app apps.App, peer string) bool {
+	return apps.IsAllowedFor(app, peer)
+}
+
+func (p *allowedPeersAppPolicy) IsAllowedForAny(_ apps.App) bool {
+	// Apps without allowed peers may be seen by all the peers
+	return true
+}
+
+// NewAllowedPeersAppPolicy creates an AppPolicy, that allows only the peers listed in the
+// app's access control list to see it
+func NewAllowedPeersAppPolicy() AppPolicy {
+	return &allowedPeersAppPolicy{}
+}
+
+// NewAppPolicy creates an AppPolicy from its name, as passed in the command line
+func NewAppPolicy(name string) (AppPolicy, error) {
+	switch name {
+	case "all":
+		return NewAllPeersAppPolicy(), nil
+	case "none":
+		return NewNoPeersAppPolicy(), nil
+	}
+	return nil, fmt.Errorf("unknown app policy: %s", name)
+}
+
+// Relay passes apps exposed by one peer on to the other peers. The traffic is relayed by
+// proxies exposed on the hub, so the peers do not need to be able to reach each other directly.
+// Every app decides which peers may see it using its allowed peers, the policy of the relay
+// applies only to the apps, that do not list them.
+type Relay struct {
+	generator *AppStateChangeGenerator
+	apps      AppSource
+	policy    AppPolicy
+}
+
+// UpdateForPeer is called when a sync message is received from a peer
+func (r *Relay) UpdateForPeer(peer string, theApps []apps.App, traces AppTraces) {
+	relayedApps := make([]apps.App, 0, len(theApps))
+	for _, app := range theApps {
+		if r.isRelayed(app) {
+			relayedApps = append(relayedApps, app)
+		}
+	}
+	r.generator.UpdateForPeer(peer, relayedApps, traces)
+}
+
+// WithdrawPeer stops relaying the apps of the peer
+func (r *Relay) WithdrawPeer(peer string) {
+	r.generator.WithdrawPeer(peer)
+}
+
+// ListFor returns the relayed apps, that the given peer is allowed to see. Peers never
+// receive their own apps back.
+func (r *Relay) ListFor(peer string) ([]apps.App, error) {
+	relayedApps, listErr := r.apps.List()
+	if listErr != nil {
+		return nil, listErr
+	}
+	visibleApps := make([]apps.App, 0)
+	for _, app := range relayedApps {
+		if app.Peer == peer || !r.isAllowed(app, peer) {
+			continue
+		}
+		visibleApps = append(visibleApps, app)
+	}
+	return visibleApps, nil
+}
+
+// isAllowed checks if the peer may see the relayed app
+func (r *Relay) isAllowed(app apps.App, peer string) bool {
+	if len(app.AllowedPeers) > 0 {
+		return apps.IsAllowedFor(app, peer)
+	}
+	return r.policy.IsAllowed(app, peer)
+}
+
+// isRelayed checks if any peer may see the app, the apps nobody may see are not exposed on
+// the hub at all
+func (r *Relay) isRelayed(app apps.App) bool {
+	if len(app.AllowedPeers) > 0 {
+		return true
+	}
+	return r.policy.IsAllowedForAny(app)
+}
+
+// NewRelay creates a new Relay instance. The generator should feed the registry, that exposes
+// the relayed apps on the hub, while relayedApps should list them with addresses reachable by
+// the other peers. The policy applies to the apps, that do not list their allowed peers.
+func NewRelay(generator *AppStateChangeGenerator, relayedApps AppSource, policy AppPolicy) *Relay {
+	return &Relay{
+		generator: generator,
+		apps:      relayedApps,
+		policy:    policy,
+	}
+}
@@ -0,0 +1,166 @@
+package syncing
+
+import (
+	"testing"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/k8s/svcdetector"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticAppSource struct {
+	apps []apps.App
+}
+
+func (s *staticAppSource) List() ([]apps.App, error) {
+	return s.apps, nil
+}
+
+func TestRelayListForDoesNotReturnPeersOwnApps(t *testing.T) {
+	// given
+	relay := NewRelay(NewAppStateChangeGenerator(), &staticAppSource{apps: []apps.App{
+		{Name: "nginx", Peer: "client1", Address: "10.0.0.1:30001"},
+		{Name: "nginx", Peer: "client2", Address: "10.0.0.1:30002"},
+	}}, NewAllPeersAppPolicy())
+
+	// when
+	relayedApps, err := relay.ListFor("client1")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []apps.App{
+		{Name: "nginx", Peer: "client2", Address: "10.0.0.1:30002"},
+	}, relayedApps)
+}
+
+func TestRelayListForHonorsPolicy(t *testing.T) {
+	// given
+	relay := NewRelay(NewAppStateChangeGenerator(), &staticAppSource{apps: []apps.App{
+		{Name: "nginx", Peer: "client2", Address: "10.0.0.1:30002"},
+	}}, NewNoPeersAppPolicy())
+
+	// when
+	relayedApps, err := relay.ListFor("client1")
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, relayedApps)
+}
+
+func TestRelayListForUsesAllowedPeersOfTheApp(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   AppPolicy
+		peer     string
+		expected []string
+	}{
+		{name: "Listed peer, none by default", policy: NewNoPeersAppPolicy(), peer: "client3",
+			expected: []string{"restricted"}},
+		{name: "Not listed peer, none by default", policy: NewNoPeersAppPolicy(), peer: "client1",
+			expected: []string{}},
+		{name: "Listed peer, all by default", policy: NewAllPeersAppPolicy(), peer: "client3",
+			expected: []string{"restricted", "unrestricted"}},
+		{name: "Not listed peer, all by default", policy: NewAllPeersAppPolicy(), peer: "client1",
+			expected: []string{"unrestricted"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			relay := NewRelay(NewAppStateChangeGenerator(), &staticAppSource{apps: []apps.App{
+				{Name: "restricted", Peer: "client2", AllowedPeers: []string{"client3"}},
+				{Name: "unrestricted", Peer: "client2"},
+			}}, tt.policy)
+
+			// when
+			relayedApps, err := relay.ListFor(tt.peer)
+
+			// then
+			assert.NoError(t, err)
+			names := make([]string, 0)
+			for _, app := range relayedApps {
+				names = append(names, app.Name)
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
+
+func TestRelayDoesNotExposeAppsNobodyMaySee(t *testing.T) {
+	// given
+	generator := NewAppStateChangeGenerator()
+	relay := NewRelay(generator, &staticAppSource{}, NewNoPeersAppPolicy())
+	changes := make([]svcdetector.AppStateChange, 0)
+	done := make(chan bool)
+	go func() {
+		for change := range generator.Changes() {
+			changes = append(changes, change)
+		}
+		done <- true
+	}()
+
+	// when
+	relay.UpdateForPeer("client2", []apps.App{
+		{Name: "restricted", AllowedPeers: []string{"client3"}},
+		{Name: "unrestricted"},
+	}, AppTraces{})
+	close(generator.changes)
+	<-done
+
+	// then
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "restricted", changes[0].App.Name)
+}
+
+func TestUpdateForRelayKeepsOriginatingPeer(t *testing.T) {
+	// given
+	generator := NewAppStateChangeGenerator()
+	changes := make([]svcdetector.AppStateChange, 0)
+	done := make(chan bool)
+	go func() {
+		for change := range generator.Changes() {
+			changes = append(changes, change)
+		}
+		done <- true
+	}()
+
+	// when
+	generator.UpdateForRelay("server", []apps.App{
+		{Name: "nginx", Address: "10.0.0.1:20000"},
+		{Name: "nginx", Peer: "client2", Address: "10.0.0.1:30002"},
+	}, AppTraces{})
+	close(generator.changes)
+	<-done
+
+	// then
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "server", changes[0].App.Peer)
+	assert.Equal(t, "client2", changes[1].App.Peer)
+}
+
+func TestServerListForHonorsAllowedPeers(t *testing.T) {
+	// given
+	server := NewServer(
+		"server",
+		NewAppStateChangeGenerator(),
+		&staticAppSource{apps: []apps.App{
+			{Name: "public", Peer: "server"},
+			{Name: "tenant1", Peer: "server", AllowedPeers: []string{"client1"}},
+			{Name: "tenant2", Peer: "server", AllowedPeers: []string{"client2"}},
+		}},
+		NewJSONSyncingEncoder(),
+		nil,
+		nil,
+		NewInMemoryMetadataStorage(),
+	)
+
+	// when
+	visibleApps, err := server.listFor("client1")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []apps.App{
+		{Name: "public", Peer: "server"},
+		{Name: "tenant1", Peer: "server"},
+	}, visibleApps, "the allowed peers should not be passed on")
+}
@@ -0,0 +1,174 @@
+package syncing
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+)
+
+// Delta contains the changes of the list of apps since the Base revision
+type Delta struct {
+	Base uint64
+	// Upserted contains the apps that were added or changed
+	Upserted []apps.App `json:",omitempty"`
+	// Removed contains the apps that were removed, only their Name and Peer are set
+	Removed []apps.App `json:",omitempty"`
+}
+
+type appKey struct {
+	peer string
+	name string
+}
+
+func keyOf(app apps.App) appKey {
+	return appKey{peer: app.Peer, name: app.Name}
+}
+
+// diffApps returns the changes, that turn the previous list of apps into the current one
+func diffApps(previous, current []apps.App) *Delta {
+	delta := &Delta{}
+	previousByKey := make(map[appKey]apps.App, len(previous))
+	for _, app := range previous {
+		previousByKey[keyOf(app)] = app
+	}
+	for _, app := range current {
+		previousApp, exists := previousByKey[keyOf(app)]
+		if !exists || !apps.Equal(previousApp, app) {
+			delta.Upserted = append(delta.Upserted, app)
+		}
+		delete(previousByKey, keyOf(app))
+	}
+	for _, app := range previous {
+		if _, removed := previousByKey[keyOf(app)]; removed {
+			delta.Removed = append(delta.Removed, apps.App{Name: app.Name, Peer: app.Peer})
+		}
+	}
+	return delta
+}
+
+// applyDelta returns a new list of apps with the changes applied
+func applyDelta(previous []apps.App, delta *Delta) []apps.App {
+	removed := make(map[appKey]bool, len(delta.Removed)+len(delta.Upserted))
+	for _, app := range delta.Removed {
+		removed[keyOf(app)] = true
+	}
+	for _, app := range delta.Upserted {
+		removed[keyOf(app)] = true
+	}
+	current := make([]apps.App, 0, len(previous)+len(delta.Upserted))
+	for _, app := range previous {
+		if !removed[keyOf(app)] {
+			current = append(current, app)
+		}
+	}
+	return append(current, delta.Upserted...)
+}
+
+func (d *Delta) isEmpty() bool {
+	return len(d.Upserted) == 0 && len(d.Removed) == 0
+}
+
+// epochShift is the number of low bits of the revision, that count the changes of the list of
+// apps, the high bits identify the epoch
+const epochShift = 32
+
+// newEpoch returns a random, non-zero epoch in the high bits of the revision. Every list of
+// outgoing apps starts a new epoch, so the revisions of a restarted peer are not compared with
+// the ones from before the restart, whatever its clock says. The revisions are never zero,
+// which is reserved for peers, that do not support revisions.
+func newEpoch() uint64 {
+	return (uint64(rand.Uint32N(math.MaxUint32)) + 1) << epochShift
+}
+
+// sameEpoch checks if both revisions come from the same list of outgoing apps
+func sameEpoch(a, b uint64) bool {
+	return a>>epochShift == b>>epochShift
+}
+
+// outgoingApps tracks the list of apps sent to the other side of the sync
+type outgoingApps struct {
+	lock     sync.Mutex
+	revision uint64
+	apps     []apps.App
+	acked    uint64
+}
+
+func newOutgoingApps() *outgoingApps {
+	return &outgoingApps{revision: newEpoch()}
+}
+
+// acknowledge records the last revision, that the other side applied
+func (o *outgoingApps) acknowledge(revision uint64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.acked = revision
+}
+
+// upToDate checks if the other side already applied the given list of apps
+func (o *outgoingApps) upToDate(theApps []apps.App) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.acked == o.revision && diffApps(o.apps, theApps).isEmpty()
+}
+
+// prepare fills the message with the given apps, as a delta if the other side acknowledged
+// the latest revision or as a full snapshot otherwise
+func (o *outgoingApps) prepare(msg *Message, theApps []apps.App) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	delta := diffApps(o.apps, theApps)
+	if o.acked == o.revision {
+		delta.Base = o.revision
+		msg.Delta = delta
+	} else {
+		msg.Apps = theApps
+	}
+	if !delta.isEmpty() {
+		o.revision++
+		o.apps = theApps
+	}
+	msg.Revision = o.revision
+}
+
+// incomingApps tracks the list of apps received from the other side of the sync
+type incomingApps struct {
+	lock     sync.Mutex
+	revision uint64
+	apps     []apps.App
+}
+
+// acknowledged returns the last revision, that was applied
+func (i *incomingApps) acknowledged() uint64 {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.revision
+}
+
+// apply updates the list of apps with the received message. It returns the current list of
+// apps, whether the message could be applied and whether the list may have changed. Deltas
+// against other revisions and stale snapshots of the same epoch (for example delayed by
+// concurrent requests) are not applied, the other side will send a full snapshot after seeing
+// the acknowledged revision. Snapshots of other epochs are always applied.
+func (i *incomingApps) apply(msg Message) (theApps []apps.App, applied, changed bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if msg.Delta != nil {
+		if msg.Delta.Base != i.revision || i.revision == 0 {
+			return i.apps, false, false
+		}
+		i.revision = msg.Revision
+		if msg.Delta.isEmpty() {
+			return i.apps, true, false
+		}
+		i.apps = applyDelta(i.apps, msg.Delta)
+		return i.apps, true, true
+	}
+	if msg.Revision != 0 && sameEpoch(msg.Revision, i.revision) && msg.Revision < i.revision {
+		return i.apps, false, false
+	}
+	i.revision = msg.Revision
+	i.apps = msg.Apps
+	return i.apps, true, true
+}
@@ -0,0 +1,146 @@
+package syncing
+
+import (
+	"testing"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDeltaRecreatesCurrentApps(t *testing.T) {
+	// given
+	previous := []apps.App{
+		{Name: "nginx", Peer: "client1", Address: "10.0.0.1:80"},
+		{Name: "redis", Peer: "client1", Address: "10.0.0.1:6379"},
+		{Name: "nginx", Peer: "client2", Address: "10.0.0.2:80"},
+	}
+	current := []apps.App{
+		{Name: "nginx", Peer: "client1", Address: "10.0.0.1:8080"},
+		{Name: "nginx", Peer: "client2", Address: "10.0.0.2:80"},
+		{Name: "postgres", Peer: "client2", Address: "10.0.0.2:5432"},
+	}
+
+	// when
+	delta := diffApps(previous, current)
+
+	// then
+	assert.Equal(t, []apps.App{
+		{Name: "nginx", Peer: "client1", Address: "10.0.0.1:8080"},
+		{Name: "postgres", Peer: "client2", Address: "10.0.0.2:5432"},
+	}, delta.Upserted)
+	assert.Equal(t, []apps.App{{Name: "redis", Peer: "client1"}}, delta.Removed)
+	assert.ElementsMatch(t, current, applyDelta(previous, delta))
+}
+
+func TestOutgoingAppsSendsDeltaOnlyAfterAcknowledgement(t *testing.T) {
+	// given
+	outgoing := newOutgoingApps()
+	initialApps := []apps.App{{Name: "nginx", Peer: "client1"}}
+	changedApps := []apps.App{{Name: "nginx", Peer: "client1"}, {Name: "redis", Peer: "client1"}}
+
+	// when
+	first := Message{}
+	outgoing.prepare(&first, initialApps)
+	outgoing.acknowledge(first.Revision)
+	second := Message{}
+	outgoing.prepare(&second, changedApps)
+
+	// then
+	assert.Nil(t, first.Delta)
+	assert.Equal(t, initialApps, first.Apps)
+	assert.NotZero(t, first.Revision)
+	assert.Nil(t, second.Apps)
+	assert.Equal(t, &Delta{
+		Base:     first.Revision,
+		Upserted: []apps.App{{Name: "redis", Peer: "client1"}},
+	}, second.Delta)
+	assert.Equal(t, first.Revision+1, second.Revision)
+}
+
+func TestOutgoingAppsFallsBackToSnapshotOnRevisionMismatch(t *testing.T) {
+	// given
+	outgoing := newOutgoingApps()
+	first := Message{}
+	outgoing.prepare(&first, []apps.App{{Name: "nginx", Peer: "client1"}})
+	outgoing.acknowledge(first.Revision - 1)
+
+	// when
+	second := Message{}
+	outgoing.prepare(&second, []apps.App{{Name: "redis", Peer: "client1"}})
+
+	// then
+	assert.Nil(t, second.Delta)
+	assert.Equal(t, []apps.App{{Name: "redis", Peer: "client1"}}, second.Apps)
+}
+
+const testEpoch = 7 << epochShift
+
+func TestIncomingAppsApply(t *testing.T) {
+	tests := []struct {
+		name            string
+		msg             Message
+		expectedApps    []apps.App
+		expectedApplied bool
+		expectedChanged bool
+	}{
+		{
+			name:            "Snapshot",
+			msg:             Message{Revision: testEpoch + 20, Apps: []apps.App{{Name: "redis"}}},
+			expectedApps:    []apps.App{{Name: "redis"}},
+			expectedApplied: true,
+			expectedChanged: true,
+		},
+		{
+			name:            "Snapshot without revision",
+			msg:             Message{Apps: []apps.App{{Name: "redis"}}},
+			expectedApps:    []apps.App{{Name: "redis"}},
+			expectedApplied: true,
+			expectedChanged: true,
+		},
+		{
+			name:         "Stale snapshot",
+			msg:          Message{Revision: testEpoch + 5, Apps: []apps.App{{Name: "redis"}}},
+			expectedApps: []apps.App{{Name: "nginx"}},
+		},
+		{
+			name:            "Lower snapshot of another epoch",
+			msg:             Message{Revision: testEpoch - 1<<epochShift + 5, Apps: []apps.App{{Name: "redis"}}},
+			expectedApps:    []apps.App{{Name: "redis"}},
+			expectedApplied: true,
+			expectedChanged: true,
+		},
+		{
+			name:            "Delta",
+			msg:             Message{Revision: testEpoch + 11, Delta: &Delta{Base: testEpoch + 10, Upserted: []apps.App{{Name: "redis"}}}},
+			expectedApps:    []apps.App{{Name: "nginx"}, {Name: "redis"}},
+			expectedApplied: true,
+			expectedChanged: true,
+		},
+		{
+			name:            "Empty delta",
+			msg:             Message{Revision: testEpoch + 10, Delta: &Delta{Base: testEpoch + 10}},
+			expectedApps:    []apps.App{{Name: "nginx"}},
+			expectedApplied: true,
+		},
+		{
+			name:         "Delta against other revision",
+			msg:          Message{Revision: testEpoch + 13, Delta: &Delta{Base: testEpoch + 12, Removed: []apps.App{{Name: "nginx"}}}},
+			expectedApps: []apps.App{{Name: "nginx"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			incoming := &incomingApps{revision: testEpoch + 10, apps: []apps.App{{Name: "nginx"}}}
+
+			// when
+			theApps, applied, changed := incoming.apply(tt.msg)
+
+			// then
+			assert.Equal(t, tt.expectedApps, theApps)
+			assert.Equal(t, tt.expectedApplied, applied)
+			assert.Equal(t, tt.expectedChanged, changed)
+		})
+	}
+}
@@ -1,7 +1,18 @@
 package syncing
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/metrics"
 	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/glothriel/wormhole/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // IncomingSyncRequest is a struct that represents raw incoming sync requests
@@ -14,15 +25,20 @@ type IncomingSyncRequest struct {
 // ClientTransport is an interface for syncing clients transport. Example implementations
 // can be http, grpc, etc.
 type ClientTransport interface {
-	Sync([]byte) ([]byte, error)
+	Sync(context.Context, []byte) ([]byte, error)
 }
 
-// ServerTransport is an interface for syncing servers transport, similar to SyncClientTransport
+// ServerTransport is an interface for syncing servers transport, similar to SyncClientTransport.
+// The transports close the channel of the syncs after they stop, once all the syncs they
+// received were responded to.
 type ServerTransport interface {
 	Syncs() <-chan IncomingSyncRequest
 	Metadata() map[string]string
 }
 
+// unknownPeer labels the metrics of the syncs, that could not be attributed to a paired peer
+const unknownPeer = "unknown"
+
 // Server orchestrates all the operations that are performed server-side
 // when executing app list synchronizations
 type Server struct {
@@ -32,52 +48,260 @@ type Server struct {
 	apps AppSource
 
 	encoder   Encoder
+	encoders  []Encoder
 	transport ServerTransport
 	peers     pairing.PeerStorage
 	metadata  MetadataStorage
+	relay     *Relay
+	policy    AppPolicy
+	enrichers []pairing.MetadataEnricher
+	traces    TraceSource
+
+	longPollTimeout time.Duration
+	changes         *changeBroadcaster
+	expiry          *peerExpiry
+	startedAt       time.Time
+
+	revisionsLock sync.Mutex
+	incoming      map[string]*incomingApps
+	outgoing      map[string]*outgoingApps
+	lastSyncs     map[string]time.Time
+}
+
+// ServerOption allows customizing the syncing server
+type ServerOption func(*Server)
+
+// WithRelay enables passing apps exposed by one peer on to the other peers
+func WithRelay(relay *Relay) ServerOption {
+	return func(s *Server) {
+		s.relay = relay
+	}
+}
+
+// WithEncoders makes the server accept syncs encoded using any of the given encoders, besides
+// the default one. The server responds using the same encoder as the request and advertises
+// all the encodings to the clients during the pairing.
+func WithEncoders(encoders ...Encoder) ServerOption {
+	return func(s *Server) {
+		s.encoders = append(s.encoders, encoders...)
+	}
+}
+
+// WithResponseMetadata attaches the metadata of the given enrichers to every sync response
+func WithResponseMetadata(enrichers ...pairing.MetadataEnricher) ServerOption {
+	return func(s *Server) {
+		s.enrichers = append(s.enrichers, enrichers...)
+	}
+}
+
+// WithResponseTraces sends the traces of the apps of the server to the peers, so the peers
+// can continue them when exposing the apps
+func WithResponseTraces(source TraceSource) ServerOption {
+	return func(s *Server) {
+		s.traces = source
+	}
+}
+
+// pendingSync holds everything needed to respond to a sync request of a peer
+type pendingSync struct {
+	request  IncomingSyncRequest
+	encoder  Encoder
+	peer     string
+	incoming *incomingApps
+	outgoing *outgoingApps
+	trace    trace.SpanContext
 }
 
-// Start starts the syncing server
-func (s *Server) Start() {
+// Start starts the syncing server. It serves the syncs until the transport closes their channel,
+// held syncs are answered once the context is done. The error is returned, if the transport
+// stopped before the context was done.
+func (s *Server) Start(ctx context.Context) error {
+	if s.expiry != nil {
+		go s.expirePeersEvery(ctx, expiryCheckInterval)
+	}
+	if s.changes != nil {
+		s.changes.forward(ctx)
+	}
+	var held sync.WaitGroup
+	defer held.Wait()
 	for incomingSync := range s.transport.Syncs() {
-		msg, decodeErr := s.encoder.Decode(incomingSync.Request)
+		encoder, msg, decodeErr := s.decode(incomingSync.Request)
 		if decodeErr != nil {
+			metrics.SyncRequests.WithLabelValues(unknownPeer, metrics.SyncResultFailure).Inc()
 			incomingSync.Err <- decodeErr
 			continue
 		}
-
-		peer, peerErr := s.peers.GetByName(msg.Peer)
-		if peerErr != nil {
-			incomingSync.Err <- peerErr
+		syncTrace, appTraces := extractTraces(&msg)
+		_, span := tracing.Start(syncTrace, "syncing.server.receive", attribute.String("peer", msg.Peer))
+		pending := pendingSync{
+			request: incomingSync,
+			encoder: encoder,
+			// Names of unknown peers are not used as labels, so they cannot flood the metrics
+			peer:  unknownPeer,
+			trace: span.SpanContext(),
+		}
+		apps, hold, receiveErr := s.receive(&pending, msg, AppTraces{Sync: span.SpanContext(), Apps: appTraces})
+		tracing.End(span, receiveErr)
+		if receiveErr != nil {
+			metrics.SyncRequests.WithLabelValues(pending.peer, metrics.SyncResultFailure).Inc()
+			incomingSync.Err <- receiveErr
 			continue
 		}
-		metadataSetErr := s.metadata.Set(peer.Name, msg.Metadata)
-		if metadataSetErr != nil {
-			incomingSync.Err <- metadataSetErr
+		if hold {
+			held.Add(1)
+			go func() {
+				defer held.Done()
+				s.respondOnChange(ctx, pending)
+			}()
 			continue
 		}
+		s.respond(pending, apps)
+	}
+	if ctx.Err() == nil {
+		return errors.New("syncing transport stopped unexpectedly")
+	}
+	return nil
+}
+
+// receive applies the apps received from the peer and returns the apps, that the peer should
+// receive back. When the peer waits for changes and it is up to date, the response should be held.
+func (s *Server) receive(pending *pendingSync, msg Message, traces AppTraces) ([]apps.App, bool, error) {
+	peer, peerErr := s.peers.GetByName(msg.Peer)
+	if peerErr != nil {
+		return nil, false, peerErr
+	}
+	pending.peer = peer.Name
+	if metadataSetErr := s.metadata.Set(peer.Name, msg.Metadata); metadataSetErr != nil {
+		return nil, false, metadataSetErr
+	}
+	pending.incoming, pending.outgoing = s.revisionsFor(peer.Name)
+	s.recordSync(peer.Name)
+	peerApps, applied, changed := pending.incoming.apply(msg)
+	if changed {
+		if s.relay != nil {
+			s.relay.UpdateForPeer(peer.Name, peerApps, traces)
+		}
 		s.stateGenerator.UpdateForPeer(
 			peer.Name,
-			msg.Apps,
+			peerApps,
+			traces,
 		)
-		apps, listErr := s.apps.List()
-		if listErr != nil {
-			incomingSync.Err <- listErr
-			continue
+	}
+	pending.outgoing.acknowledge(msg.Ack)
+	apps, listErr := s.listFor(peer.Name)
+	if listErr != nil {
+		return nil, false, listErr
+	}
+	// When the delta could not be applied, the client needs to know it immediately
+	return apps, msg.Wait && s.changes != nil && applied && pending.outgoing.upToDate(apps), nil
+}
+
+// decode decodes the request using the first encoder, that is able to do it
+func (s *Server) decode(request []byte) (Encoder, Message, error) {
+	msg, decodeErr := s.encoder.Decode(request)
+	if decodeErr == nil {
+		return s.encoder, msg, nil
+	}
+	for _, encoder := range s.encoders {
+		if encodedMsg, err := encoder.Decode(request); err == nil {
+			return encoder, encodedMsg, nil
 		}
+	}
+	return nil, Message{}, decodeErr
+}
 
-		encoded, encodeErr := s.encoder.Encode(
-			Message{
-				Peer: s.myName,
-				Apps: apps,
-			},
-		)
-		if encodeErr != nil {
-			incomingSync.Err <- encodeErr
-			continue
+func (s *Server) respond(pending pendingSync, theApps []apps.App) {
+	_, span := tracing.Start(pending.trace, "syncing.server.respond", attribute.String("peer", pending.peer))
+	msg := Message{
+		Peer: s.myName,
+		Ack:  pending.incoming.acknowledged(),
+	}
+	for _, enricher := range s.enrichers {
+		for k, v := range enricher.Metadata() {
+			if msg.Metadata == nil {
+				msg.Metadata = Metadata{}
+			}
+			msg.Metadata[k] = v
+		}
+	}
+	pending.outgoing.prepare(&msg, theApps)
+	msg.Metadata = withTraces(msg.Metadata, msg, span.SpanContext(), s.traces)
+	encoded, encodeErr := pending.encoder.Encode(msg)
+	tracing.End(span, encodeErr)
+	if encodeErr != nil {
+		metrics.SyncRequests.WithLabelValues(pending.peer, metrics.SyncResultFailure).Inc()
+		pending.request.Err <- encodeErr
+		return
+	}
+	metrics.SyncRequests.WithLabelValues(pending.peer, metrics.SyncResultSuccess).Inc()
+	pending.request.Response <- encoded
+}
+
+// Metadata implements pairing.MetadataEnricher, advertising the supported encodings and
+// long polling to the clients
+func (s *Server) Metadata() map[string]string {
+	encodings := make([]string, 0, len(s.encoders)+1)
+	for _, encoder := range append([]Encoder{s.encoder}, s.encoders...) {
+		if encoding := encodingOf(encoder); encoding != "" {
+			encodings = append(encodings, encoding)
 		}
-		incomingSync.Response <- encoded
 	}
+	metadata := map[string]string{
+		encodingsMetadataKey: strings.Join(encodings, ","),
+	}
+	if s.longPollTimeout > 0 {
+		metadata[longPollTimeoutMetadataKey] = s.longPollTimeout.String()
+	}
+	return metadata
+}
+
+// revisionsFor returns the state of the lists of apps exchanged with the given peer
+func (s *Server) revisionsFor(peer string) (*incomingApps, *outgoingApps) {
+	s.revisionsLock.Lock()
+	defer s.revisionsLock.Unlock()
+	if _, ok := s.incoming[peer]; !ok {
+		s.incoming[peer] = &incomingApps{}
+		s.outgoing[peer] = newOutgoingApps()
+	}
+	return s.incoming[peer], s.outgoing[peer]
+}
+
+func (s *Server) recordSync(peer string) {
+	s.revisionsLock.Lock()
+	defer s.revisionsLock.Unlock()
+	s.lastSyncs[peer] = time.Now()
+}
+
+// LastSync returns the time of the last sync request of the peer, that the server accepted
+func (s *Server) LastSync(peer string) (time.Time, bool) {
+	s.revisionsLock.Lock()
+	defer s.revisionsLock.Unlock()
+	lastSync, ok := s.lastSyncs[peer]
+	return lastSync, ok
+}
+
+// listFor returns the apps, that the given peer is allowed to see. The allowed peers are not
+// passed on, so the peers do not learn about each other.
+func (s *Server) listFor(peer string) ([]apps.App, error) {
+	theApps, listErr := s.apps.List()
+	if listErr != nil {
+		return nil, listErr
+	}
+	if s.relay != nil {
+		relayedApps, relayErr := s.relay.ListFor(peer)
+		if relayErr != nil {
+			return nil, relayErr
+		}
+		theApps = append(theApps, relayedApps...)
+	}
+	visibleApps := make([]apps.App, 0, len(theApps))
+	for _, app := range theApps {
+		if s.policy.IsAllowed(app, peer) {
+			app.AllowedPeers = nil
+			visibleApps = append(visibleApps, app)
+		}
+	}
+	return visibleApps, nil
 }
 
 // NewServer creates a new SyncingServer instance
@@ -89,8 +313,9 @@ func NewServer(
 	transport ServerTransport,
 	peers pairing.PeerStorage,
 	metadata MetadataStorage,
+	opts ...ServerOption,
 ) *Server {
-	return &Server{
+	s := &Server{
 		myName:         myName,
 		stateGenerator: stateGenerator,
 		apps:           apps,
@@ -98,5 +323,14 @@ func NewServer(
 		transport:      transport,
 		peers:          peers,
 		metadata:       metadata,
+		policy:         NewAllowedPeersAppPolicy(),
+		incoming:       make(map[string]*incomingApps),
+		outgoing:       make(map[string]*outgoingApps),
+		lastSyncs:      make(map[string]time.Time),
+		startedAt:      time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
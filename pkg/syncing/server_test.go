@@ -0,0 +1,323 @@
+package syncing
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSyncServerTransport struct {
+	syncs chan IncomingSyncRequest
+}
+
+func (m *mockSyncServerTransport) Syncs() <-chan IncomingSyncRequest {
+	return m.syncs
+}
+
+func (m *mockSyncServerTransport) Metadata() map[string]string {
+	return map[string]string{}
+}
+
+type mutableAppSource struct {
+	lock sync.Mutex
+	apps []apps.App
+}
+
+func (s *mutableAppSource) List() ([]apps.App, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.apps, nil
+}
+
+func (s *mutableAppSource) Set(theApps []apps.App) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.apps = theApps
+}
+
+func newSyncRequest(t *testing.T, msg Message) IncomingSyncRequest {
+	encoded, encodeErr := NewJSONSyncingEncoder().Encode(msg)
+	assert.NoError(t, encodeErr)
+	return IncomingSyncRequest{
+		Request:  encoded,
+		Response: make(chan []byte),
+		Err:      make(chan error),
+	}
+}
+
+func receiveSyncResponse(t *testing.T, req IncomingSyncRequest, timeout time.Duration) (Message, bool) {
+	select {
+	case resp := <-req.Response:
+		msg, decodeErr := NewJSONSyncingEncoder().Decode(resp)
+		assert.NoError(t, decodeErr)
+		return msg, true
+	case err := <-req.Err:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(timeout):
+	}
+	return Message{}, false
+}
+
+func TestServerHoldsLongPollUntilAppsChange(t *testing.T) {
+	// given
+	peers := pairing.NewInMemoryPeerStorage()
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client1"}))
+	appSource := &mutableAppSource{apps: []apps.App{{Name: "nginx", Peer: "server"}}}
+	notifier := &changeBroadcaster{}
+	transport := &mockSyncServerTransport{syncs: make(chan IncomingSyncRequest)}
+	server := NewServer(
+		"server",
+		NewAppStateChangeGenerator(),
+		appSource,
+		NewJSONSyncingEncoder(),
+		transport,
+		peers,
+		NewInMemoryMetadataStorage(),
+		WithLongPolling(time.Minute, notifier),
+	)
+	go server.Start(context.Background())
+
+	initialReq := newSyncRequest(t, Message{Peer: "client1", Revision: 1})
+	transport.syncs <- initialReq
+	initialMsg, _ := receiveSyncResponse(t, initialReq, time.Second)
+
+	// when
+	req := newSyncRequest(t, Message{
+		Peer:     "client1",
+		Revision: 1,
+		Delta:    &Delta{Base: 1},
+		Ack:      initialMsg.Revision,
+		Wait:     true,
+	})
+	transport.syncs <- req
+	_, respondedBeforeChange := receiveSyncResponse(t, req, time.Millisecond*100)
+	appSource.Set([]apps.App{{Name: "nginx", Peer: "server"}, {Name: "redis", Peer: "server"}})
+	notifier.notify()
+	msg, respondedAfterChange := receiveSyncResponse(t, req, time.Second)
+
+	// then
+	assert.False(t, respondedBeforeChange)
+	assert.True(t, respondedAfterChange)
+	assert.Equal(t, &Delta{
+		Base:     initialMsg.Revision,
+		Upserted: []apps.App{{Name: "redis", Peer: "server"}},
+	}, msg.Delta)
+	assert.Greater(t, msg.Revision, initialMsg.Revision)
+}
+
+func TestChangeBroadcasterStopsForwardingWhenContextIsDone(t *testing.T) {
+	// given
+	notifier := &changeBroadcaster{}
+	broadcaster := &changeBroadcaster{notifiers: []ChangeNotifier{notifier}}
+	ctx, cancel := context.WithCancel(context.Background())
+	broadcaster.forward(ctx)
+	forwarded := broadcaster.Changed()
+	assert.Eventually(t, func() bool {
+		notifier.notify()
+		select {
+		case <-forwarded:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond*10)
+
+	// when
+	cancel()
+	time.Sleep(time.Millisecond * 50)
+	changed := broadcaster.Changed()
+	notifier.notify()
+
+	// then
+	select {
+	case <-changed:
+		t.Fatal("change was forwarded after the context was done")
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestServerRespondsImmediatelyWhenClientIsOutdated(t *testing.T) {
+	// given
+	peers := pairing.NewInMemoryPeerStorage()
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client1"}))
+	transport := &mockSyncServerTransport{syncs: make(chan IncomingSyncRequest)}
+	server := NewServer(
+		"server",
+		NewAppStateChangeGenerator(),
+		&staticAppSource{apps: []apps.App{{Name: "nginx", Peer: "server"}}},
+		NewJSONSyncingEncoder(),
+		transport,
+		peers,
+		NewInMemoryMetadataStorage(),
+		WithLongPolling(time.Minute),
+	)
+	go server.Start(context.Background())
+
+	// when
+	req := newSyncRequest(t, Message{Peer: "client1", Revision: 1, Ack: 1, Wait: true})
+	transport.syncs <- req
+	msg, responded := receiveSyncResponse(t, req, time.Second)
+
+	// then
+	assert.True(t, responded)
+	assert.Nil(t, msg.Delta)
+	assert.Len(t, msg.Apps, 1)
+	assert.Equal(t, uint64(1), msg.Ack)
+}
+
+func TestServerRespondsUsingEncoderOfTheRequest(t *testing.T) {
+	// given
+	peers := pairing.NewInMemoryPeerStorage()
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client1"}))
+	transport := &mockSyncServerTransport{syncs: make(chan IncomingSyncRequest)}
+	server := NewServer(
+		"server",
+		NewAppStateChangeGenerator(),
+		&staticAppSource{apps: []apps.App{{Name: "nginx", Peer: "server"}}},
+		NewJSONSyncingEncoder(),
+		transport,
+		peers,
+		NewInMemoryMetadataStorage(),
+		WithEncoders(NewProtobufSyncingEncoder()),
+	)
+	go server.Start(context.Background())
+	encoded, encodeErr := NewProtobufSyncingEncoder().Encode(Message{Peer: "client1"})
+	assert.NoError(t, encodeErr)
+	req := IncomingSyncRequest{Request: encoded, Response: make(chan []byte), Err: make(chan error)}
+
+	// when
+	transport.syncs <- req
+	resp := <-req.Response
+	msg, decodeErr := NewProtobufSyncingEncoder().Decode(resp)
+
+	// then
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, []apps.App{{Name: "nginx", Peer: "server"}}, msg.Apps)
+	assert.Equal(t, "json,protobuf", server.Metadata()[encodingsMetadataKey])
+}
+
+type staticMetadataEnricher map[string]string
+
+func (e staticMetadataEnricher) Metadata() map[string]string {
+	return e
+}
+
+func TestServerAttachesResponseMetadata(t *testing.T) {
+	// given
+	peers := pairing.NewInMemoryPeerStorage()
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client1"}))
+	transport := &mockSyncServerTransport{syncs: make(chan IncomingSyncRequest)}
+	server := NewServer(
+		"server",
+		NewAppStateChangeGenerator(),
+		&staticAppSource{},
+		NewJSONSyncingEncoder(),
+		transport,
+		peers,
+		NewInMemoryMetadataStorage(),
+		WithResponseMetadata(staticMetadataEnricher{pairing.ServerNextPublicKeyMetadataKey: "next-key"}),
+	)
+	go server.Start(context.Background())
+
+	// when
+	req := newSyncRequest(t, Message{Peer: "client1"})
+	transport.syncs <- req
+	msg, responded := receiveSyncResponse(t, req, time.Second)
+
+	// then
+	assert.True(t, responded)
+	assert.Equal(t, map[string]string{pairing.ServerNextPublicKeyMetadataKey: "next-key"}, msg.Metadata.Strings())
+}
+
+func TestServerRecordsLastSyncOfPeers(t *testing.T) {
+	// given
+	peers := pairing.NewInMemoryPeerStorage()
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client1"}))
+	transport := &mockSyncServerTransport{syncs: make(chan IncomingSyncRequest)}
+	server := NewServer(
+		"server",
+		NewAppStateChangeGenerator(),
+		&staticAppSource{},
+		NewJSONSyncingEncoder(),
+		transport,
+		peers,
+		NewInMemoryMetadataStorage(),
+	)
+	go server.Start(context.Background())
+	before := time.Now()
+
+	// when
+	req := newSyncRequest(t, Message{Peer: "client1"})
+	transport.syncs <- req
+	_, responded := receiveSyncResponse(t, req, time.Second)
+
+	// then
+	assert.True(t, responded)
+	lastSync, synced := server.LastSync("client1")
+	assert.True(t, synced)
+	assert.False(t, lastSync.Before(before))
+	_, otherSynced := server.LastSync("client2")
+	assert.False(t, otherSynced)
+}
+
+func TestServerAnswersHeldSyncsOnShutdown(t *testing.T) {
+	// given
+	peers := pairing.NewInMemoryPeerStorage()
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client1"}))
+	transport := &mockSyncServerTransport{syncs: make(chan IncomingSyncRequest)}
+	server := NewServer(
+		"server",
+		NewAppStateChangeGenerator(),
+		&staticAppSource{},
+		NewJSONSyncingEncoder(),
+		transport,
+		peers,
+		NewInMemoryMetadataStorage(),
+		WithLongPolling(time.Minute),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- server.Start(ctx)
+	}()
+	initialReq := newSyncRequest(t, Message{Peer: "client1", Revision: 1})
+	transport.syncs <- initialReq
+	initialMsg, _ := receiveSyncResponse(t, initialReq, time.Second)
+	req := newSyncRequest(t, Message{Peer: "client1", Revision: 1, Ack: initialMsg.Revision, Wait: true})
+	transport.syncs <- req
+
+	// when
+	cancel()
+	_, responded := receiveSyncResponse(t, req, time.Second)
+	close(transport.syncs)
+
+	// then
+	assert.True(t, responded)
+	assert.NoError(t, <-stopped)
+}
+
+func TestServerStartFailsWhenTransportStops(t *testing.T) {
+	// given
+	transport := &mockSyncServerTransport{syncs: make(chan IncomingSyncRequest)}
+	server := NewServer(
+		"server",
+		NewAppStateChangeGenerator(),
+		&staticAppSource{},
+		NewJSONSyncingEncoder(),
+		transport,
+		pairing.NewInMemoryPeerStorage(),
+		NewInMemoryMetadataStorage(),
+	)
+	close(transport.syncs)
+
+	// when
+	startErr := server.Start(context.Background())
+
+	// then
+	assert.Error(t, startErr)
+}
@@ -0,0 +1,87 @@
+package syncing
+
+import (
+	"strings"
+
+	"github.com/glothriel/wormhole/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// syncTraceMetadataKey carries the span of the sync in the metadata of the sync messages
+	syncTraceMetadataKey = "traceparent"
+	// appTraceMetadataPrefix prefixes the metadata keys, that carry the spans, that exposed the
+	// apps on the sending peer
+	appTraceMetadataPrefix = "traceparent."
+)
+
+// TraceSource returns the span, that exposed the app with the given name
+type TraceSource interface {
+	Trace(name string) trace.SpanContext
+}
+
+// AppTraces holds the traces of the apps received in a sync message
+type AppTraces struct {
+	// Sync is the span of the sync, that delivered the apps
+	Sync trace.SpanContext
+	// Apps are the spans, that exposed the apps on the sending peer, by the app name
+	Apps map[string]trace.SpanContext
+}
+
+// of returns the trace, that the change of the app should continue. The apps, that were not
+// traced by the sending peer, continue the trace of the sync.
+func (t AppTraces) of(name string) trace.SpanContext {
+	if sc, ok := t.Apps[name]; ok {
+		return sc
+	}
+	return t.Sync
+}
+
+// withTraces returns a copy of the metadata with the span of the sync and the spans of the
+// apps sent in the message
+func withTraces(metadata Metadata, msg Message, sync trace.SpanContext, source TraceSource) Metadata {
+	traced := make(Metadata, len(metadata)+1)
+	for k, v := range metadata {
+		traced[k] = v
+	}
+	if encoded := tracing.Encode(sync); encoded != "" {
+		traced[syncTraceMetadataKey] = encoded
+	}
+	if source == nil {
+		return traced
+	}
+	sentApps := msg.Apps
+	if msg.Delta != nil {
+		sentApps = msg.Delta.Upserted
+	}
+	for _, app := range sentApps {
+		if encoded := tracing.Encode(source.Trace(app.Name)); encoded != "" {
+			traced[appTraceMetadataPrefix+app.Name] = encoded
+		}
+	}
+	return traced
+}
+
+// extractTraces removes the traces from the metadata of the message, so they are not stored
+// along with it, and returns the span of the sync and the spans of the apps
+func extractTraces(msg *Message) (trace.SpanContext, map[string]trace.SpanContext) {
+	var sync trace.SpanContext
+	appTraces := map[string]trace.SpanContext{}
+	for k, v := range msg.Metadata {
+		encoded, isString := v.(string)
+		switch {
+		case k == syncTraceMetadataKey:
+			if isString {
+				sync = tracing.Decode(encoded)
+			}
+		case strings.HasPrefix(k, appTraceMetadataPrefix):
+			if sc := tracing.Decode(encoded); isString && sc.IsValid() {
+				appTraces[strings.TrimPrefix(k, appTraceMetadataPrefix)] = sc
+			}
+		default:
+			continue
+		}
+		delete(msg.Metadata, k)
+	}
+	return sync, appTraces
+}
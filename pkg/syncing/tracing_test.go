@@ -0,0 +1,96 @@
+package syncing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glothriel/wormhole/pkg/apps"
+	"github.com/glothriel/wormhole/pkg/pairing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type staticTraceSource map[string]trace.SpanContext
+
+func (s staticTraceSource) Trace(name string) trace.SpanContext {
+	return s[name]
+}
+
+func newTestSpanContext(traceID, spanID byte) trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{traceID},
+		SpanID:     trace.SpanID{spanID},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+}
+
+func TestTracesAreCarriedInMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoder Encoder
+	}{
+		{name: "JSON", encoder: NewJSONSyncingEncoder()},
+		{name: "Protobuf", encoder: NewProtobufSyncingEncoder()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			syncSpan, appSpan := newTestSpanContext(1, 1), newTestSpanContext(2, 2)
+			metadata := Metadata{"cluster": "dev1"}
+			msg := Message{Peer: "client1", Apps: []apps.App{{Name: "nginx"}, {Name: "redis"}}}
+			msg.Metadata = withTraces(metadata, msg, syncSpan, staticTraceSource{"nginx": appSpan})
+			encoded, encodeErr := tt.encoder.Encode(msg)
+			assert.NoError(t, encodeErr)
+			decoded, decodeErr := tt.encoder.Decode(encoded)
+			assert.NoError(t, decodeErr)
+
+			// when
+			extractedSync, extractedApps := extractTraces(&decoded)
+
+			// then
+			assert.Equal(t, syncSpan, extractedSync)
+			assert.Equal(t, map[string]trace.SpanContext{"nginx": appSpan}, extractedApps)
+			assert.Equal(t, Metadata{"cluster": "dev1"}, decoded.Metadata)
+			assert.Equal(t, Metadata{"cluster": "dev1"}, metadata)
+		})
+	}
+}
+
+func TestServerChangesContinueTracesOfApps(t *testing.T) {
+	// given
+	peers := pairing.NewInMemoryPeerStorage()
+	assert.NoError(t, peers.Store(pairing.PeerInfo{Name: "client1"}))
+	generator := NewAppStateChangeGenerator()
+	transport := &mockSyncServerTransport{syncs: make(chan IncomingSyncRequest)}
+	metadataStorage := NewInMemoryMetadataStorage()
+	server := NewServer(
+		"server",
+		generator,
+		&staticAppSource{},
+		NewJSONSyncingEncoder(),
+		transport,
+		peers,
+		metadataStorage,
+	)
+	go server.Start(context.Background())
+	syncSpan, appSpan := newTestSpanContext(1, 1), newTestSpanContext(2, 2)
+	msg := Message{Peer: "client1", Apps: []apps.App{{Name: "nginx"}, {Name: "redis"}}}
+	msg.Metadata = withTraces(nil, msg, syncSpan, staticTraceSource{"nginx": appSpan})
+
+	// when
+	req := newSyncRequest(t, msg)
+	transport.syncs <- req
+	nginxChange, redisChange := <-generator.Changes(), <-generator.Changes()
+	_, responded := receiveSyncResponse(t, req, time.Second)
+
+	// then
+	assert.True(t, responded)
+	assert.Equal(t, appSpan, nginxChange.Trace)
+	assert.Equal(t, syncSpan, redisChange.Trace)
+	stored, getErr := metadataStorage.Get("client1")
+	assert.NoError(t, getErr)
+	assert.Empty(t, stored)
+}
@@ -2,8 +2,11 @@ package syncing
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"time"
 
@@ -25,8 +28,9 @@ func (t *httpServerTransport) Metadata() map[string]string {
 	}
 }
 
-// NewHTTPServerSyncingTransport creates a new SyncServerTransport instance
-func NewHTTPServerSyncingTransport(server *http.Server) ServerTransport {
+// NewHTTPServerSyncingTransport creates a new SyncServerTransport instance. When the context is
+// done, the server is shut down, waiting for the syncs in progress.
+func NewHTTPServerSyncingTransport(ctx context.Context, server *http.Server) ServerTransport {
 	syncs := make(chan IncomingSyncRequest)
 	router := http.NewServeMux()
 	router.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) { // nolint: dupl
@@ -55,12 +59,24 @@ func NewHTTPServerSyncingTransport(server *http.Server) ServerTransport {
 	go func() {
 		for {
 			logrus.Infof("Starting HTTP syncing transport server on %s", server.Addr)
-			if err := server.ListenAndServe(); err != nil {
-				logrus.Errorf("Failed to start HTTP syncing transport server: %v", err)
-				time.Sleep(time.Second * 5)
+			err := server.ListenAndServe()
+			if errors.Is(err, http.ErrServerClosed) {
+				return
+			}
+			logrus.Errorf("Failed to start HTTP syncing transport server: %v", err)
+			if !sleep(ctx, time.Second*5) {
+				return
 			}
 		}
 	}()
+	go func() {
+		<-ctx.Done()
+		logrus.Infof("Stopping HTTP syncing transport server on %s", server.Addr)
+		if shutdownErr := server.Shutdown(context.Background()); shutdownErr != nil {
+			logrus.Errorf("Failed to stop HTTP syncing transport server: %v", shutdownErr)
+		}
+		close(syncs)
+	}()
 	return &httpServerTransport{
 		syncs:  syncs,
 		server: server,
@@ -72,8 +88,13 @@ type httpClientTransport struct {
 	client    *http.Client
 }
 
-func (t *httpClientTransport) Sync(req []byte) ([]byte, error) {
-	resp, err := t.client.Post(t.serverURL+"/sync", "application/octet-stream", bytes.NewReader(req))
+func (t *httpClientTransport) Sync(ctx context.Context, req []byte) ([]byte, error) {
+	httpReq, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, t.serverURL+"/sync", bytes.NewReader(req))
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	httpReq.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := t.client.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
@@ -85,12 +106,33 @@ func (t *httpClientTransport) Sync(req []byte) ([]byte, error) {
 	return respBody, nil
 }
 
-// NewHTTPClientTransport creates a new SyncClientTransport instance
-func NewHTTPClientTransport(serverURL string, timeout time.Duration) ClientTransport {
+// DialFunc opens connections to the sync server, it has the signature of net.Dialer.DialContext
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// NewHTTPClientTransport creates a new SyncClientTransport instance. Connections are opened
+// using the dial function, or the default dialer, if it is nil.
+func NewHTTPClientTransport(serverURL string, timeout time.Duration, dial DialFunc) ClientTransport {
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	if dial != nil {
+		httpTransport.DialContext = dial
+	}
 	return &httpClientTransport{
 		serverURL: serverURL,
 		client: &http.Client{
-			Timeout: timeout,
+			Timeout:   timeout,
+			Transport: httpTransport,
 		},
 	}
 }
+
+// sleep waits for the given duration, it returns false if the context was done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,96 @@
+// Package tracing sets up OpenTelemetry tracing of the app exposure pipeline. The spans of a
+// single app follow it from the detection of the service, through the syncs, to the NGINX
+// configuration and Kubernetes resources created on the other peer.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/glothriel/wormhole"
+
+	traceparentKey = "traceparent"
+)
+
+// Tracer returns the tracer used by wormhole. Until Setup is called, it does not record
+// anything.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Setup makes Tracer export the spans to the OTLP gRPC collector. When the endpoint is empty,
+// the exporter falls back to the OTEL_EXPORTER_OTLP_* environment variables. The returned
+// function flushes the remaining spans.
+func Setup(ctx context.Context, peer, endpoint string, insecure bool) (func(context.Context) error, error) {
+	opts := []otlptracegrpc.Option{}
+	if endpoint != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+	}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, exporterErr := otlptracegrpc.New(ctx, opts...)
+	if exporterErr != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", exporterErr)
+	}
+	res, resErr := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("wormhole"),
+		semconv.ServiceInstanceID(peer),
+	))
+	if resErr != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", resErr)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span, that continues the trace of the given span context, or a new trace,
+// if it is not valid
+func Start(parent trace.SpanContext, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := context.Background()
+	if parent.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the error, if any, on the span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Encode returns the span context in the W3C traceparent format, or an empty string, if it
+// is not valid
+func Encode(sc trace.SpanContext) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+	return carrier.Get(traceparentKey)
+}
+
+// Decode parses the span context encoded using Encode, the returned span context is not
+// valid, if the traceparent is malformed
+func Decode(traceparent string) trace.SpanContext {
+	carrier := propagation.MapCarrier{traceparentKey: traceparent}
+	return trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+}
@@ -0,0 +1,193 @@
+package wg
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// PeerStats holds the state of a single peer, as reported by the Wireguard interface
+type PeerStats struct {
+	PublicKey     string
+	Endpoint      string
+	LastHandshake time.Time // Zero if there was no handshake yet
+	ReceiveBytes  int64
+	TransmitBytes int64
+}
+
+// StatsProvider returns the state of the peers of the Wireguard interface
+type StatsProvider interface {
+	Stats() ([]PeerStats, error)
+}
+
+// deviceClient is the part of wgctrl.Client used by DeviceReloader
+type deviceClient interface {
+	Device(name string) (*wgtypes.Device, error)
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+}
+
+// DeviceReloader applies the configuration directly to an existing Wireguard interface using
+// wgctrl. Peers are added, updated and removed in place, so the sessions of the other peers
+// are not interrupted. The interface and its address must be set up beforehand.
+type DeviceReloader struct {
+	lock   sync.Mutex
+	name   string
+	client deviceClient
+	last   *Config
+}
+
+// Update implements WireguardConfigReloader
+func (r *DeviceReloader) Update(settings Config) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if applyErr := r.apply(settings); applyErr != nil {
+		return applyErr
+	}
+	r.last = &settings
+	return nil
+}
+
+func (r *DeviceReloader) apply(settings Config) error {
+	device, deviceErr := r.client.Device(r.name)
+	if deviceErr != nil {
+		return fmt.Errorf("failed to read Wireguard interface %s: %w", r.name, deviceErr)
+	}
+	cfg, cfgErr := deviceConfig(settings, device)
+	if cfgErr != nil {
+		return cfgErr
+	}
+	if configureErr := r.client.ConfigureDevice(r.name, cfg); configureErr != nil {
+		return fmt.Errorf("failed to configure Wireguard interface %s: %w", r.name, configureErr)
+	}
+	return nil
+}
+
+// Reconcile applies the last configuration again, reverting changes made to the interface
+// by other means, for example by restarting it
+func (r *DeviceReloader) Reconcile() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.last == nil {
+		return nil
+	}
+	return r.apply(*r.last)
+}
+
+// ReconcileEvery reconciles the interface in given intervals, it blocks until the context is done
+func (r *DeviceReloader) ReconcileEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if reconcileErr := r.Reconcile(); reconcileErr != nil {
+				logrus.Errorf("Failed to reconcile Wireguard interface %s: %v", r.name, reconcileErr)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stats implements StatsProvider
+func (r *DeviceReloader) Stats() ([]PeerStats, error) {
+	device, deviceErr := r.client.Device(r.name)
+	if deviceErr != nil {
+		return nil, fmt.Errorf("failed to read Wireguard interface %s: %w", r.name, deviceErr)
+	}
+	stats := make([]PeerStats, 0, len(device.Peers))
+	for _, peer := range device.Peers {
+		endpoint := ""
+		if peer.Endpoint != nil {
+			endpoint = peer.Endpoint.String()
+		}
+		stats = append(stats, PeerStats{
+			PublicKey:     peer.PublicKey.String(),
+			Endpoint:      endpoint,
+			LastHandshake: peer.LastHandshakeTime,
+			ReceiveBytes:  peer.ReceiveBytes,
+			TransmitBytes: peer.TransmitBytes,
+		})
+	}
+	return stats, nil
+}
+
+// deviceConfig returns the changes, that turn the current state of the device into settings
+func deviceConfig(settings Config, device *wgtypes.Device) (wgtypes.Config, error) {
+	privateKey, keyErr := wgtypes.ParseKey(settings.PrivateKey)
+	if keyErr != nil {
+		return wgtypes.Config{}, fmt.Errorf("invalid private key: %w", keyErr)
+	}
+	cfg := wgtypes.Config{PrivateKey: &privateKey}
+	if settings.ListenPort != 0 {
+		cfg.ListenPort = &settings.ListenPort
+	}
+	desired := make(map[wgtypes.Key]struct{}, len(settings.Peers))
+	for _, peer := range settings.Peers {
+		peerCfg, peerErr := devicePeerConfig(peer)
+		if peerErr != nil {
+			return wgtypes.Config{}, peerErr
+		}
+		desired[peerCfg.PublicKey] = struct{}{}
+		cfg.Peers = append(cfg.Peers, peerCfg)
+	}
+	for _, peer := range device.Peers {
+		if _, ok := desired[peer.PublicKey]; !ok {
+			cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{PublicKey: peer.PublicKey, Remove: true})
+		}
+	}
+	return cfg, nil
+}
+
+func devicePeerConfig(peer Peer) (wgtypes.PeerConfig, error) {
+	publicKey, keyErr := wgtypes.ParseKey(peer.PublicKey)
+	if keyErr != nil {
+		return wgtypes.PeerConfig{}, fmt.Errorf("invalid public key of peer %s: %w", peer.Name, keyErr)
+	}
+	peerCfg := wgtypes.PeerConfig{
+		PublicKey:         publicKey,
+		ReplaceAllowedIPs: true,
+	}
+	if peer.Endpoint != "" {
+		endpoint, resolveErr := net.ResolveUDPAddr("udp", peer.Endpoint)
+		if resolveErr != nil {
+			return wgtypes.PeerConfig{}, fmt.Errorf("invalid endpoint of peer %s: %w", peer.Name, resolveErr)
+		}
+		peerCfg.Endpoint = endpoint
+	}
+	if peer.PersistentKeepalive > 0 {
+		keepalive := time.Duration(peer.PersistentKeepalive) * time.Second
+		peerCfg.PersistentKeepaliveInterval = &keepalive
+	}
+	for _, allowedIP := range strings.Split(peer.AllowedIPs, ",") {
+		if allowedIP = strings.TrimSpace(allowedIP); allowedIP == "" {
+			continue
+		}
+		_, ipNet, parseErr := net.ParseCIDR(allowedIP)
+		if parseErr != nil {
+			return wgtypes.PeerConfig{}, fmt.Errorf("invalid allowed IP of peer %s: %w", peer.Name, parseErr)
+		}
+		peerCfg.AllowedIPs = append(peerCfg.AllowedIPs, *ipNet)
+	}
+	return peerCfg, nil
+}
+
+// NewDeviceReloader creates a new DeviceReloader instance, that configures the Wireguard
+// interface with the given name
+func NewDeviceReloader(name string) (*DeviceReloader, error) {
+	client, clientErr := wgctrl.New()
+	if clientErr != nil {
+		return nil, fmt.Errorf("failed to open wgctrl client: %w", clientErr)
+	}
+	return &DeviceReloader{
+		name:   name,
+		client: client,
+	}, nil
+}
@@ -0,0 +1,125 @@
+package wg
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+type mockDeviceClient struct {
+	device     *wgtypes.Device
+	configured []wgtypes.Config
+}
+
+func (c *mockDeviceClient) Device(_ string) (*wgtypes.Device, error) {
+	return c.device, nil
+}
+
+func (c *mockDeviceClient) ConfigureDevice(_ string, cfg wgtypes.Config) error {
+	c.configured = append(c.configured, cfg)
+	return nil
+}
+
+func generateTestKey(t *testing.T) wgtypes.Key {
+	key, keyErr := wgtypes.GeneratePrivateKey()
+	assert.NoError(t, keyErr)
+	return key.PublicKey()
+}
+
+func TestDeviceReloaderUpdateAddsAndRemovesPeers(t *testing.T) {
+	// given
+	privateKey, _, generateErr := GenerateKeyPair()
+	assert.NoError(t, generateErr)
+	kept, added, removed := generateTestKey(t), generateTestKey(t), generateTestKey(t)
+	client := &mockDeviceClient{device: &wgtypes.Device{Peers: []wgtypes.Peer{
+		{PublicKey: kept}, {PublicKey: removed},
+	}}}
+	reloader := &DeviceReloader{name: "wg0", client: client}
+
+	// when
+	updateErr := reloader.Update(Config{
+		PrivateKey: privateKey,
+		ListenPort: 51820,
+		Peers: []Peer{
+			{Name: "kept", PublicKey: kept.String(), AllowedIPs: "10.188.0.2/32"},
+			{
+				Name:                "added",
+				PublicKey:           added.String(),
+				AllowedIPs:          "10.188.0.3/32,10.188.0.1/32",
+				Endpoint:            "127.0.0.1:51820",
+				PersistentKeepalive: 10,
+			},
+		},
+	})
+
+	// then
+	assert.NoError(t, updateErr)
+	assert.Len(t, client.configured, 1)
+	cfg := client.configured[0]
+	assert.Equal(t, 51820, *cfg.ListenPort)
+	assert.False(t, cfg.ReplacePeers)
+	assert.Len(t, cfg.Peers, 3)
+	assert.Equal(t, kept, cfg.Peers[0].PublicKey)
+	assert.Equal(t, []string{"10.188.0.2/32"}, ipNetStrings(cfg.Peers[0].AllowedIPs))
+	assert.Equal(t, added, cfg.Peers[1].PublicKey)
+	assert.Equal(t, []string{"10.188.0.3/32", "10.188.0.1/32"}, ipNetStrings(cfg.Peers[1].AllowedIPs))
+	assert.Equal(t, "127.0.0.1:51820", cfg.Peers[1].Endpoint.String())
+	assert.Equal(t, 10*time.Second, *cfg.Peers[1].PersistentKeepaliveInterval)
+	assert.Equal(t, wgtypes.PeerConfig{PublicKey: removed, Remove: true}, cfg.Peers[2])
+}
+
+func TestDeviceReloaderReconcileAppliesLastConfig(t *testing.T) {
+	// given
+	privateKey, _, generateErr := GenerateKeyPair()
+	assert.NoError(t, generateErr)
+	client := &mockDeviceClient{device: &wgtypes.Device{}}
+	reloader := &DeviceReloader{name: "wg0", client: client}
+	assert.NoError(t, reloader.Reconcile())
+	assert.NoError(t, reloader.Update(Config{PrivateKey: privateKey}))
+
+	// when
+	reconcileErr := reloader.Reconcile()
+
+	// then
+	assert.NoError(t, reconcileErr)
+	assert.Len(t, client.configured, 2)
+	assert.Equal(t, client.configured[0], client.configured[1])
+}
+
+func TestDeviceReloaderStats(t *testing.T) {
+	// given
+	peer := generateTestKey(t)
+	handshake := time.Now()
+	client := &mockDeviceClient{device: &wgtypes.Device{Peers: []wgtypes.Peer{{
+		PublicKey:         peer,
+		Endpoint:          &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 51820},
+		LastHandshakeTime: handshake,
+		ReceiveBytes:      100,
+		TransmitBytes:     200,
+	}}}}
+	reloader := &DeviceReloader{name: "wg0", client: client}
+
+	// when
+	stats, statsErr := reloader.Stats()
+
+	// then
+	assert.NoError(t, statsErr)
+	assert.Equal(t, []PeerStats{{
+		PublicKey:     peer.String(),
+		Endpoint:      "192.168.1.10:51820",
+		LastHandshake: handshake,
+		ReceiveBytes:  100,
+		TransmitBytes: 200,
+	}}, stats)
+}
+
+func ipNetStrings(ipNets []net.IPNet) []string {
+	result := make([]string, 0, len(ipNets))
+	for _, ipNet := range ipNets {
+		result = append(result, ipNet.String())
+	}
+	return result
+}
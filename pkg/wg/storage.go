@@ -2,6 +2,7 @@ package wg
 
 import (
 	"errors"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
@@ -9,10 +10,19 @@ import (
 	bolt "go.etcd.io/bbolt"
 )
 
+// ErrNoPendingKeyPair is returned by LoadPending, when no key rotation is in progress
+var ErrNoPendingKeyPair = errors.New("no pending key pair stored")
+
 // KeyStorage is responsible for storing and loading WireGuard key pair
 type KeyStorage interface {
 	Store(private, public string) error
 	Load() (private, public string, err error)
+
+	// StorePending keeps the key pair, that the keys are being rotated to, so the rotation
+	// can be resumed after a restart. The switch time is zero, if there's none.
+	StorePending(private, public string, switchAt time.Time) error
+	LoadPending() (private, public string, switchAt time.Time, err error)
+	ClearPending() error
 }
 
 type boltDbKeyStorage struct {
@@ -42,6 +52,55 @@ func (s *boltDbKeyStorage) Load() (private, public string, err error) {
 	return private, public, err
 }
 
+func (s *boltDbKeyStorage) StorePending(private, public string, switchAt time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("keys"))
+		if err := b.Put([]byte("pending_private"), []byte(private)); err != nil {
+			return err
+		}
+		if err := b.Put([]byte("pending_public"), []byte(public)); err != nil {
+			return err
+		}
+		return b.Put([]byte("pending_switch_at"), []byte(switchAt.Format(time.RFC3339Nano)))
+	})
+}
+
+func (s *boltDbKeyStorage) LoadPending() (private, public string, switchAt time.Time, err error) {
+	var rawSwitchAt string
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("keys"))
+		private = string(b.Get([]byte("pending_private")))
+		public = string(b.Get([]byte("pending_public")))
+		rawSwitchAt = string(b.Get([]byte("pending_switch_at")))
+		return nil
+	})
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	if private == "" || public == "" {
+		return "", "", time.Time{}, ErrNoPendingKeyPair
+	}
+	switchAt, err = time.Parse(time.RFC3339Nano, rawSwitchAt)
+	return private, public, switchAt, err
+}
+
+func (s *boltDbKeyStorage) ClearPending() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("keys"))
+		for _, key := range []string{"pending_private", "pending_public", "pending_switch_at"} {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the database
+func (s *boltDbKeyStorage) Close() error {
+	return s.db.Close()
+}
+
 // NewBoltKeyStorage creates a new KeyStorage that stores keys in a BoltDB database
 func NewBoltKeyStorage(path string) KeyStorage {
 	db, err := bolt.Open(path, 0600, nil)
@@ -59,6 +118,13 @@ func NewBoltKeyStorage(path string) KeyStorage {
 
 type inMemoryKeyStorage struct {
 	private, public string
+
+	pending *inMemoryPendingKeyPair
+}
+
+type inMemoryPendingKeyPair struct {
+	private, public string
+	switchAt        time.Time
 }
 
 func (s *inMemoryKeyStorage) Store(private, public string) error {
@@ -73,6 +139,23 @@ func (s *inMemoryKeyStorage) Load() (private, public string, err error) {
 	return s.private, s.public, nil
 }
 
+func (s *inMemoryKeyStorage) StorePending(private, public string, switchAt time.Time) error {
+	s.pending = &inMemoryPendingKeyPair{private: private, public: public, switchAt: switchAt}
+	return nil
+}
+
+func (s *inMemoryKeyStorage) LoadPending() (private, public string, switchAt time.Time, err error) {
+	if s.pending == nil {
+		return "", "", time.Time{}, ErrNoPendingKeyPair
+	}
+	return s.pending.private, s.pending.public, s.pending.switchAt, nil
+}
+
+func (s *inMemoryKeyStorage) ClearPending() error {
+	s.pending = nil
+	return nil
+}
+
 type noStorage struct{}
 
 func (s *noStorage) Store(_, _ string) error {
@@ -83,6 +166,18 @@ func (s *noStorage) Load() (_, _ string, err error) {
 	return "", "", errors.New("no storage")
 }
 
+func (s *noStorage) StorePending(_, _ string, _ time.Time) error {
+	return nil
+}
+
+func (s *noStorage) LoadPending() (_, _ string, _ time.Time, err error) {
+	return "", "", time.Time{}, ErrNoPendingKeyPair
+}
+
+func (s *noStorage) ClearPending() error {
+	return nil
+}
+
 // NewNoStorage creates a new KeyStorage that does not store keys
 func NewNoStorage() KeyStorage {
 	return &noStorage{}
@@ -99,16 +194,23 @@ func GetOrGenerateKeyPair(storage KeyStorage) (string, string, error) {
 	if err == nil {
 		return private, public, nil
 	}
-	pkey, keyErr := wgtypes.GeneratePrivateKey()
+	private, public, keyErr := GenerateKeyPair()
 	if keyErr != nil {
 		return "", "", keyErr
 	}
 
-	private, public = pkey.String(), pkey.PublicKey().String()
-
 	if err := storage.Store(private, public); err != nil {
 		return "", "", err
 	}
 
 	return private, public, nil
 }
+
+// GenerateKeyPair generates a new key pair, without storing it
+func GenerateKeyPair() (string, string, error) {
+	pkey, keyErr := wgtypes.GeneratePrivateKey()
+	if keyErr != nil {
+		return "", "", keyErr
+	}
+	return pkey.String(), pkey.PublicKey().String(), nil
+}
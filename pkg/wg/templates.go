@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"net"
 	"path/filepath"
 	"text/template"
 
@@ -46,6 +48,20 @@ func (c *Config) Upsert(p Peer) {
 	c.Peers = append(c.Peers, p)
 }
 
+// HostMask returns the prefix length of a single host with the given address: 128 for IPv6
+// addresses and 32 for the other ones
+func HostMask(address string) string {
+	if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+		return "128"
+	}
+	return "32"
+}
+
+// HostCIDR returns the CIDR of a single host with the given address, for example 10.188.0.2/32
+func HostCIDR(address string) string {
+	return fmt.Sprintf("%s/%s", address, HostMask(address))
+}
+
 // DeleteByPublicKey removes a peer from the configuration by its public key
 func (c *Config) DeleteByPublicKey(publicKey string) {
 	for i, peer := range c.Peers {
@@ -0,0 +1,23 @@
+package wg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostCIDR(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{address: "10.188.0.2", expected: "10.188.0.2/32"},
+		{address: "fd00:188::2", expected: "fd00:188::2/128"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			assert.Equal(t, tt.expected, HostCIDR(tt.address))
+		})
+	}
+}
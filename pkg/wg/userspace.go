@@ -0,0 +1,209 @@
+package wg
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// defaultUserspaceMTU is the MTU of the userspace interface, the same as wg-quick uses by default
+const defaultUserspaceMTU = 1420
+
+// UserspaceDevice is a Wireguard interface running entirely in the process, using wireguard-go
+// and the gVisor network stack. It requires neither the kernel module nor any privileges, but
+// the tunnel is not visible to the other processes - it can be used only using DialContext
+// and Listen methods.
+type UserspaceDevice struct {
+	lock    sync.Mutex
+	mtu     int
+	address string
+	device  *device.Device
+	net     *netstack.Net
+}
+
+// Update implements WireguardConfigReloader, applying the configuration to the device. The
+// interface is created on the first update and recreated, when the address changes.
+func (d *UserspaceDevice) Update(settings Config) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	uapi, uapiErr := uapiConfig(settings)
+	if uapiErr != nil {
+		return uapiErr
+	}
+	if d.device != nil && d.address != settings.Address {
+		logrus.Infof("Address of the userspace Wireguard interface changed to %s, recreating it", settings.Address)
+		d.device.Close()
+		d.device, d.net = nil, nil
+	}
+	if d.device == nil {
+		if createErr := d.create(settings.Address); createErr != nil {
+			return createErr
+		}
+	}
+	if setErr := d.device.IpcSet(uapi); setErr != nil {
+		return fmt.Errorf("failed to configure userspace Wireguard interface: %w", setErr)
+	}
+	return d.device.Up()
+}
+
+func (d *UserspaceDevice) create(address string) error {
+	addr, parseErr := netip.ParseAddr(address)
+	if parseErr != nil {
+		return fmt.Errorf("invalid address of the Wireguard interface: %w", parseErr)
+	}
+	tunDevice, tnet, tunErr := netstack.CreateNetTUN([]netip.Addr{addr}, nil, d.mtu)
+	if tunErr != nil {
+		return fmt.Errorf("failed to create userspace network stack: %w", tunErr)
+	}
+	d.device = device.NewDevice(tunDevice, conn.NewDefaultBind(), &device.Logger{
+		Verbosef: logrus.Debugf,
+		Errorf:   logrus.Errorf,
+	})
+	d.net = tnet
+	d.address = address
+	logrus.Infof("Created userspace Wireguard interface with address %s", address)
+	return nil
+}
+
+func (d *UserspaceDevice) netstack() (*netstack.Net, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.net == nil {
+		return nil, errors.New("userspace Wireguard interface is not configured yet")
+	}
+	return d.net, nil
+}
+
+// DialContext connects to the address over the tunnel
+func (d *UserspaceDevice) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	tnet, netErr := d.netstack()
+	if netErr != nil {
+		return nil, netErr
+	}
+	return tnet.DialContext(ctx, network, address)
+}
+
+// Listen listens for TCP connections coming over the tunnel on the given address
+func (d *UserspaceDevice) Listen(network, address string) (net.Listener, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("network %s is not supported by the userspace Wireguard interface", network)
+	}
+	tnet, netErr := d.netstack()
+	if netErr != nil {
+		return nil, netErr
+	}
+	addrPort, parseErr := netip.ParseAddrPort(address)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return tnet.ListenTCPAddrPort(addrPort)
+}
+
+// Ping sends a single ICMP echo request over the tunnel and waits for the reply
+func (d *UserspaceDevice) Ping(address string) error {
+	tnet, netErr := d.netstack()
+	if netErr != nil {
+		return netErr
+	}
+	addr, parseErr := netip.ParseAddr(address)
+	if parseErr != nil {
+		return parseErr
+	}
+	network, protocol := "ping4", 1
+	var request icmp.Type = ipv4.ICMPTypeEcho
+	if addr.Is6() {
+		network, protocol, request = "ping6", 58, ipv6.ICMPTypeEchoRequest
+	}
+	pingConn, dialErr := tnet.Dial(network, addr.String())
+	if dialErr != nil {
+		return dialErr
+	}
+	defer pingConn.Close()
+	msg, marshalErr := (&icmp.Message{
+		Type: request,
+		Body: &icmp.Echo{ID: 1, Seq: 1, Data: []byte("wormhole")},
+	}).Marshal(nil)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	if deadlineErr := pingConn.SetDeadline(time.Now().Add(time.Second * 5)); deadlineErr != nil {
+		return deadlineErr
+	}
+	if _, writeErr := pingConn.Write(msg); writeErr != nil {
+		return writeErr
+	}
+	reply := make([]byte, 1500)
+	n, readErr := pingConn.Read(reply)
+	if readErr != nil {
+		return readErr
+	}
+	parsed, parseReplyErr := icmp.ParseMessage(protocol, reply[:n])
+	if parseReplyErr != nil {
+		return parseReplyErr
+	}
+	if parsed.Type != ipv4.ICMPTypeEchoReply && parsed.Type != ipv6.ICMPTypeEchoReply {
+		return fmt.Errorf("unexpected ICMP reply from %s: %v", address, parsed.Type)
+	}
+	return nil
+}
+
+// uapiConfig renders the configuration in the format of the cross-platform userspace API
+// of Wireguard, see https://www.wireguard.com/xplatform/
+func uapiConfig(settings Config) (string, error) {
+	var b strings.Builder
+	privateKey, keyErr := wgtypes.ParseKey(settings.PrivateKey)
+	if keyErr != nil {
+		return "", fmt.Errorf("invalid private key: %w", keyErr)
+	}
+	fmt.Fprintf(&b, "private_key=%s\n", hex.EncodeToString(privateKey[:]))
+	if settings.ListenPort != 0 {
+		fmt.Fprintf(&b, "listen_port=%d\n", settings.ListenPort)
+	}
+	b.WriteString("replace_peers=true\n")
+	for _, peer := range settings.Peers {
+		publicKey, peerKeyErr := wgtypes.ParseKey(peer.PublicKey)
+		if peerKeyErr != nil {
+			return "", fmt.Errorf("invalid public key of peer %s: %w", peer.Name, peerKeyErr)
+		}
+		fmt.Fprintf(&b, "public_key=%s\n", hex.EncodeToString(publicKey[:]))
+		if peer.Endpoint != "" {
+			endpoint, resolveErr := net.ResolveUDPAddr("udp", peer.Endpoint)
+			if resolveErr != nil {
+				return "", fmt.Errorf("invalid endpoint of peer %s: %w", peer.Name, resolveErr)
+			}
+			fmt.Fprintf(&b, "endpoint=%s\n", endpoint)
+		}
+		if peer.PersistentKeepalive > 0 {
+			fmt.Fprintf(&b, "persistent_keepalive_interval=%d\n", peer.PersistentKeepalive)
+		}
+		b.WriteString("replace_allowed_ips=true\n")
+		for _, allowedIP := range strings.Split(peer.AllowedIPs, ",") {
+			if allowedIP = strings.TrimSpace(allowedIP); allowedIP != "" {
+				fmt.Fprintf(&b, "allowed_ip=%s\n", allowedIP)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// NewUserspaceDevice creates a new UserspaceDevice instance
+func NewUserspaceDevice() *UserspaceDevice {
+	return &UserspaceDevice{
+		mtu: defaultUserspaceMTU,
+	}
+}
@@ -0,0 +1,51 @@
+package wg
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUAPIConfig(t *testing.T) {
+	// given
+	privateKey, publicKey, generateErr := GenerateKeyPair()
+	assert.NoError(t, generateErr)
+	privateBytes, _ := base64.StdEncoding.DecodeString(privateKey)
+	publicBytes, _ := base64.StdEncoding.DecodeString(publicKey)
+
+	// when
+	uapi, uapiErr := uapiConfig(Config{
+		Address:    "10.188.0.2",
+		ListenPort: 51820,
+		PrivateKey: privateKey,
+		Peers: []Peer{{
+			Name:                "server",
+			PublicKey:           publicKey,
+			AllowedIPs:          "10.188.0.1/32, fd00:188::1/128",
+			Endpoint:            "127.0.0.1:51820",
+			PersistentKeepalive: 10,
+		}},
+	})
+
+	// then
+	assert.NoError(t, uapiErr)
+	assert.Equal(t, "private_key="+hex.EncodeToString(privateBytes)+"\n"+
+		"listen_port=51820\n"+
+		"replace_peers=true\n"+
+		"public_key="+hex.EncodeToString(publicBytes)+"\n"+
+		"endpoint=127.0.0.1:51820\n"+
+		"persistent_keepalive_interval=10\n"+
+		"replace_allowed_ips=true\n"+
+		"allowed_ip=10.188.0.1/32\n"+
+		"allowed_ip=fd00:188::1/128\n", uapi)
+}
+
+func TestUAPIConfigRejectsInvalidKeys(t *testing.T) {
+	// when
+	_, uapiErr := uapiConfig(Config{PrivateKey: "not a key"})
+
+	// then
+	assert.Error(t, uapiErr)
+}
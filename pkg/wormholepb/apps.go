@@ -0,0 +1,43 @@
+package wormholepb
+
+import "github.com/glothriel/wormhole/pkg/apps"
+
+// FromApps converts the apps to their protobuf counterparts
+func FromApps(theApps []apps.App) []*App {
+	if theApps == nil {
+		return nil
+	}
+	converted := make([]*App, 0, len(theApps))
+	for _, app := range theApps {
+		converted = append(converted, &App{
+			Name:         app.Name,
+			Address:      app.Address,
+			Peer:         app.Peer,
+			OriginalPort: app.OriginalPort,
+			TargetLabels: app.TargetLabels,
+			Protocol:     app.Protocol,
+			AllowedPeers: app.AllowedPeers,
+		})
+	}
+	return converted
+}
+
+// ToApps converts the protobuf apps back to apps.App
+func ToApps(theApps []*App) []apps.App {
+	if theApps == nil {
+		return nil
+	}
+	converted := make([]apps.App, 0, len(theApps))
+	for _, app := range theApps {
+		converted = append(converted, apps.App{
+			Name:         app.GetName(),
+			Address:      app.GetAddress(),
+			Peer:         app.GetPeer(),
+			OriginalPort: app.GetOriginalPort(),
+			TargetLabels: app.GetTargetLabels(),
+			Protocol:     app.GetProtocol(),
+			AllowedPeers: app.GetAllowedPeers(),
+		})
+	}
+	return converted
+}
@@ -0,0 +1,5 @@
+// Package wormholepb contains protobuf definitions of the messages exchanged between the
+// peers and the gRPC services used by the gRPC transports
+package wormholepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative wormhole.proto
@@ -0,0 +1,36 @@
+package wormholepb
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// payloadPrefix starts every protobuf payload. JSON payloads never start with it, which allows
+// the peers to accept both encodings and to respond using the one the other side used.
+const payloadPrefix byte = 0x02
+
+// ErrNotProtobufPayload is returned when unmarshalling payloads encoded differently
+var ErrNotProtobufPayload = errors.New("not a protobuf payload")
+
+// IsPayload checks if the data was encoded using Marshal
+func IsPayload(data []byte) bool {
+	return len(data) > 0 && data[0] == payloadPrefix
+}
+
+// Marshal encodes the message as a prefixed protobuf payload
+func Marshal(msg proto.Message) ([]byte, error) {
+	encoded, marshalErr := proto.Marshal(msg)
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+	return append([]byte{payloadPrefix}, encoded...), nil
+}
+
+// Unmarshal decodes a payload encoded using Marshal
+func Unmarshal(data []byte, msg proto.Message) error {
+	if !IsPayload(data) {
+		return ErrNotProtobufPayload
+	}
+	return proto.Unmarshal(data[1:], msg)
+}
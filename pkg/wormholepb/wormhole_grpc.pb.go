@@ -0,0 +1,231 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: wormhole.proto
+
+package wormholepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Pairing_Pair_FullMethodName = "/wormhole.v1.Pairing/Pair"
+)
+
+// PairingClient is the client API for Pairing service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PairingClient interface {
+	Pair(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Envelope, error)
+}
+
+type pairingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPairingClient(cc grpc.ClientConnInterface) PairingClient {
+	return &pairingClient{cc}
+}
+
+func (c *pairingClient) Pair(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Envelope, error) {
+	out := new(Envelope)
+	err := c.cc.Invoke(ctx, Pairing_Pair_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PairingServer is the server API for Pairing service.
+// All implementations must embed UnimplementedPairingServer
+// for forward compatibility
+type PairingServer interface {
+	Pair(context.Context, *Envelope) (*Envelope, error)
+	mustEmbedUnimplementedPairingServer()
+}
+
+// UnimplementedPairingServer must be embedded to have forward compatible implementations.
+type UnimplementedPairingServer struct {
+}
+
+func (UnimplementedPairingServer) Pair(context.Context, *Envelope) (*Envelope, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pair not implemented")
+}
+func (UnimplementedPairingServer) mustEmbedUnimplementedPairingServer() {}
+
+// UnsafePairingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PairingServer will
+// result in compilation errors.
+type UnsafePairingServer interface {
+	mustEmbedUnimplementedPairingServer()
+}
+
+func RegisterPairingServer(s grpc.ServiceRegistrar, srv PairingServer) {
+	s.RegisterService(&Pairing_ServiceDesc, srv)
+}
+
+func _Pairing_Pair_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PairingServer).Pair(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pairing_Pair_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PairingServer).Pair(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Pairing_ServiceDesc is the grpc.ServiceDesc for Pairing service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Pairing_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wormhole.v1.Pairing",
+	HandlerType: (*PairingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Pair",
+			Handler:    _Pairing_Pair_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "wormhole.proto",
+}
+
+const (
+	Syncing_Sync_FullMethodName = "/wormhole.v1.Syncing/Sync"
+)
+
+// SyncingClient is the client API for Syncing service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SyncingClient interface {
+	Sync(ctx context.Context, opts ...grpc.CallOption) (Syncing_SyncClient, error)
+}
+
+type syncingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSyncingClient(cc grpc.ClientConnInterface) SyncingClient {
+	return &syncingClient{cc}
+}
+
+func (c *syncingClient) Sync(ctx context.Context, opts ...grpc.CallOption) (Syncing_SyncClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Syncing_ServiceDesc.Streams[0], Syncing_Sync_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &syncingSyncClient{stream}
+	return x, nil
+}
+
+type Syncing_SyncClient interface {
+	Send(*Envelope) error
+	Recv() (*Envelope, error)
+	grpc.ClientStream
+}
+
+type syncingSyncClient struct {
+	grpc.ClientStream
+}
+
+func (x *syncingSyncClient) Send(m *Envelope) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *syncingSyncClient) Recv() (*Envelope, error) {
+	m := new(Envelope)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SyncingServer is the server API for Syncing service.
+// All implementations must embed UnimplementedSyncingServer
+// for forward compatibility
+type SyncingServer interface {
+	Sync(Syncing_SyncServer) error
+	mustEmbedUnimplementedSyncingServer()
+}
+
+// UnimplementedSyncingServer must be embedded to have forward compatible implementations.
+type UnimplementedSyncingServer struct {
+}
+
+func (UnimplementedSyncingServer) Sync(Syncing_SyncServer) error {
+	return status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (UnimplementedSyncingServer) mustEmbedUnimplementedSyncingServer() {}
+
+// UnsafeSyncingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SyncingServer will
+// result in compilation errors.
+type UnsafeSyncingServer interface {
+	mustEmbedUnimplementedSyncingServer()
+}
+
+func RegisterSyncingServer(s grpc.ServiceRegistrar, srv SyncingServer) {
+	s.RegisterService(&Syncing_ServiceDesc, srv)
+}
+
+func _Syncing_Sync_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SyncingServer).Sync(&syncingSyncServer{stream})
+}
+
+type Syncing_SyncServer interface {
+	Send(*Envelope) error
+	Recv() (*Envelope, error)
+	grpc.ServerStream
+}
+
+type syncingSyncServer struct {
+	grpc.ServerStream
+}
+
+func (x *syncingSyncServer) Send(m *Envelope) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *syncingSyncServer) Recv() (*Envelope, error) {
+	m := new(Envelope)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Syncing_ServiceDesc is the grpc.ServiceDesc for Syncing service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Syncing_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wormhole.v1.Syncing",
+	HandlerType: (*SyncingServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Sync",
+			Handler:       _Syncing_Sync_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "wormhole.proto",
+}